@@ -0,0 +1,274 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/winiceo/genv/internal/config"
+	"github.com/winiceo/genv/internal/db"
+	"github.com/winiceo/genv/pkg/container"
+	"github.com/spf13/cobra"
+)
+
+var msgConfigChanged = `Warning: the config file has changed since the environment was created.
+
+Run "envctl apply" to bring the environment up to date.`
+
+func newApplyCmd(
+	ctl container.Controller,
+	s db.Store,
+	l config.Loader,
+) *cobra.Command {
+	applyDesc := "apply config changes to the current environment"
+	applyLongDesc := `apply - Apply config changes to the current environment
+
+"apply" compares the config file with the one the environment was created
+from, shows what needs to be done to bring the environment up to date, and
+then does as little as possible to get there:
+
+- a changed image, shell or mount rebuilds the image
+- changed variables, user, ports or resources recreate the container, and so
+  does an SSH agent that's moved since the container was created
+- changed bootstrap steps only run the bootstrap steps again
+
+Selecting a different profile counts as a config change too. Variables are
+compared by what they resolve to, so a changed env file or session variable
+recreates the container as well. Secrets are compared by their references, so
+to pick up a changed secret, recreate the environment.
+
+Use --dry-run to only show the plan.`
+
+	msgEnvOff := `The environment is off!
+
+To create it, run "envctl create".`
+
+	var dryRun bool
+
+	runApply := func(cmd *cobra.Command, args []string) {
+		err := applyConfig(ctl, s, l, dryRun)
+		if err == errEnvOff {
+			fmt.Println(msgEnvOff)
+			os.Exit(1)
+		}
+
+		if err != nil {
+			fmt.Printf("error applying config: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	applyCmd := &cobra.Command{
+		Use:   "apply",
+		Short: applyDesc,
+		Long:  applyLongDesc,
+		Run:   runApply,
+	}
+
+	applyCmd.Flags().BoolVar(
+		&dryRun,
+		"dry-run",
+		false,
+		"only show what would be done",
+	)
+
+	return applyCmd
+}
+
+// errEnvOff is returned by applyConfig when there's no environment to apply
+// the config to.
+var errEnvOff = errors.New("the environment is off")
+
+// applyConfig brings the environment in `s` up to date with the config loaded
+// by `l`, printing the plan before doing anything. With `dryRun` set, it stops
+// after printing the plan.
+func applyConfig(
+	ctl container.Controller,
+	s db.Store,
+	l config.Loader,
+	dryRun bool,
+) error {
+	env, err := s.Read()
+	if err != nil {
+		return fmt.Errorf("reading data store: %v", err)
+	}
+
+	if !env.Initialized() {
+		return errEnvOff
+	}
+
+	cfg, err := l.Load()
+	if err != nil {
+		return fmt.Errorf("reading config file: %v", err)
+	}
+
+	fp, err := fingerprintConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("fingerprinting config: %v", err)
+	}
+
+	change := env.Config.Diff(fp)
+
+	// The SSH agent's socket is only mounted when the container is created,
+	// so following it when it moves means recreating the container.
+	agentMoved := sshAgentMoved(env.Container)
+	if agentMoved {
+		fmt.Println("The SSH agent has moved since the environment was created.")
+
+		if change < config.ChangeContainer {
+			change = config.ChangeContainer
+		}
+	}
+
+	printPlan(change)
+
+	if dryRun || (env.Config == fp && !agentMoved) {
+		return nil
+	}
+
+	// Even when there's nothing to do, like when switching to a profile that
+	// doesn't change anything, or when the saved fingerprint is from before
+	// variables were fingerprinted, the new fingerprint still needs saving.
+	newMeta := env.Container
+	if change != config.ChangeNone {
+		newMeta, err = applyChange(ctl, env.Container, cfg, change)
+		if err != nil {
+			// The fingerprint the environment had is kept, so the next
+			// apply has the same plan and tries again.
+			s.Create(db.Environment{
+				Status:    db.StatusError,
+				Container: newMeta,
+				Config:    env.Config,
+				Profile:   env.Profile,
+			})
+			return err
+		}
+	}
+
+	fmt.Println("saving environment...")
+	err = s.Create(db.Environment{
+		Status:    db.StatusReady,
+		Container: newMeta,
+		Config:    fp,
+		Profile:   cfg.Profile,
+	})
+	if err != nil {
+		return fmt.Errorf("saving environment: %v", err)
+	}
+
+	return nil
+}
+
+// applyChange does the work needed for the environment running in `current` to
+// match `cfg`. It always returns the metadata of whatever container the
+// environment ends up with, even when something goes wrong, so that it can be
+// saved for "envctl destroy" to clean up.
+func applyChange(
+	ctl container.Controller,
+	current container.Metadata,
+	cfg config.Opts,
+	change config.Change,
+) (container.Metadata, error) {
+	if change == config.ChangeBootstrap {
+		return current, runBootstrap(ctl, current, cfg.Bootstrap)
+	}
+
+	meta, err := newMetadata(cfg)
+	if err != nil {
+		return current, err
+	}
+
+	meta.Ports, err = reservePorts(meta.Ports, current.Ports)
+	if err != nil {
+		return current, err
+	}
+
+	var newMeta container.Metadata
+
+	switch change {
+	case config.ChangeImage:
+		fmt.Println("rebuilding your environment...")
+
+		if err := ctl.Remove(current); err != nil {
+			return current, err
+		}
+
+		// The old container is gone by now, so whatever was created
+		// instead is all there is to clean up.
+		newMeta, err = ctl.Create(meta)
+		if err != nil {
+			return newMeta, err
+		}
+	case config.ChangeContainer:
+		fmt.Println("recreating your environment...")
+
+		meta.ID = current.ID
+		meta.ImageID = current.ImageID
+		meta.BaseName = current.BaseName
+
+		newMeta, err = ctl.Recreate(meta)
+		if err != nil {
+			return newMeta, err
+		}
+	}
+
+	if err := runBootstrap(ctl, newMeta, cfg.Bootstrap); err != nil {
+		return newMeta, err
+	}
+
+	// The new container doesn't have the dotfiles the old one had.
+	installDotfiles(ctl, newMeta)
+
+	return newMeta, nil
+}
+
+func printPlan(change config.Change) {
+	if change == config.ChangeNone {
+		fmt.Println("The environment is up to date with the config file.")
+		return
+	}
+
+	step := func(desc string, needed bool) {
+		action := "no"
+		if needed {
+			action = "yes"
+		}
+
+		fmt.Printf("  %-20v %v\n", desc, action)
+	}
+
+	fmt.Println("Plan:")
+	step("rebuild image", change >= config.ChangeImage)
+	step("recreate container", change >= config.ChangeContainer)
+	step("rerun bootstrap", change >= config.ChangeBootstrap)
+}
+
+// warnDrift prints a warning when the config has changed since `env` was
+// created.
+func warnDrift(env db.Environment, l config.Loader) {
+	if configDrifted(env, l) {
+		fmt.Println()
+		fmt.Println(msgConfigChanged)
+	}
+}
+
+// configDrifted returns whether the config has changed since `env` was
+// created. Environments created before fingerprints were saved are left alone,
+// as are configs that can't be loaded, since there's nothing to compare.
+func configDrifted(env db.Environment, l config.Loader) bool {
+	if !env.Initialized() || env.Config.Hash == "" {
+		return false
+	}
+
+	cfg, err := l.Load()
+	if err != nil {
+		return false
+	}
+
+	fp, err := fingerprintConfig(cfg)
+	if err != nil {
+		return false
+	}
+
+	return !env.Config.Same(fp)
+}
@@ -0,0 +1,431 @@
+package cmd
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/winiceo/genv/internal/config"
+	"github.com/winiceo/genv/internal/db"
+	"github.com/winiceo/genv/pkg/container"
+	"github.com/winiceo/genv/test_pkg"
+)
+
+// newAppliedEnv returns a store holding an environment created from `opts`,
+// as if "envctl create" had been run with it.
+func newAppliedEnv(t test_pkg.T, opts config.Opts) (*memStore, *mockCtl) {
+	cfg := memConfig{opts: opts}
+
+	loaded, err := cfg.Load()
+	if err != nil {
+		t.Fatal("loading config", nil, err)
+	}
+
+	fp, err := fingerprintConfig(loaded)
+	if err != nil {
+		t.Fatal("fingerprinting config", nil, err)
+	}
+
+	cnt := container.Metadata{
+		ID:        "foocnt",
+		ImageID:   "fooimg",
+		BaseName:  "fooenv",
+		BaseImage: opts.Image,
+		Shell:     opts.Shell,
+	}
+
+	s := &memStore{
+		env: db.Environment{
+			Status:    db.StatusReady,
+			Container: cnt,
+			Config:    fp,
+		},
+	}
+
+	return s, newMockCtl(&cnt)
+}
+
+func runApply(t test_pkg.T, ctl *mockCtl, s *memStore, opts config.Opts) {
+	cmd := newApplyCmd(ctl, s, memConfig{opts: opts})
+
+	// Hijacking here swallows the command output so that it doesn't clutter
+	// the output of `go test -v ./...`.
+	outch, errch := test_pkg.HijackStdout(func() {
+		cmd.Run(cmd, []string{})
+	})
+
+	select {
+	case err := <-errch:
+		t.Fatal("hijacking output", nil, err)
+	case <-outch:
+	}
+}
+
+// applyQuietly applies `opts` the way runApply does, but returns the error
+// rather than exiting.
+func applyQuietly(t test_pkg.T, ctl *mockCtl, s *memStore, opts config.Opts) error {
+	var err error
+	outch, errch := test_pkg.HijackStdout(func() {
+		err = applyConfig(ctl, s, memConfig{opts: opts}, false)
+	})
+
+	select {
+	case err := <-errch:
+		t.Fatal("hijacking output", nil, err)
+	case <-outch:
+	}
+
+	return err
+}
+
+func TestApplyUnchanged(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	opts := config.Opts{
+		Image: "test",
+		Shell: "/foo/sh",
+		Mount: "/foo/mnt",
+	}
+
+	s, ctl := newAppliedEnv(t, opts)
+
+	created := false
+	ctl.createFn = func(m container.Metadata) (container.Metadata, error) {
+		created = true
+		return m, nil
+	}
+
+	runApply(t, ctl, s, opts)
+
+	if created {
+		t.Fatal("rebuilding unchanged environment", false, created)
+	}
+
+	if ctl.current.ID != "foocnt" {
+		t.Fatal("container id", "foocnt", ctl.current.ID)
+	}
+}
+
+func TestApplyBootstrapChange(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	opts := config.Opts{
+		Image: "test",
+		Shell: "/foo/sh",
+		Mount: "/foo/mnt",
+	}
+
+	s, ctl := newAppliedEnv(t, opts)
+
+	ran := []string{}
+	ctl.runFn = func(m container.Metadata, cmds []string) error {
+		ran = append(ran, m.ID)
+		return nil
+	}
+
+	opts.Bootstrap = []config.Step{{Run: "echo foo"}}
+	runApply(t, ctl, s, opts)
+
+	if len(ran) != 1 || ran[0] != "foocnt" {
+		t.Fatal("bootstrap runs", []string{"foocnt"}, ran)
+	}
+
+	expected, _ := memConfig{opts: opts}.Load()
+	fp, _ := fingerprintConfig(expected)
+	if s.env.Config != fp {
+		t.Fatal("saved fingerprint", fp, s.env.Config)
+	}
+}
+
+func TestApplyContainerChange(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	opts := config.Opts{
+		Image: "test",
+		Shell: "/foo/sh",
+		Mount: "/foo/mnt",
+	}
+
+	s, ctl := newAppliedEnv(t, opts)
+
+	opts.Variables = map[string]string{"foo": "bar"}
+	runApply(t, ctl, s, opts)
+
+	if s.env.Container.ImageID != "fooimg" {
+		t.Fatal("reused image", "fooimg", s.env.Container.ImageID)
+	}
+
+	if s.env.Container.Envs[0] != "foo=bar" {
+		t.Fatal("variables", "foo=bar", s.env.Container.Envs[0])
+	}
+
+	if s.env.Status != db.StatusReady {
+		t.Fatal("environment status", db.StatusReady, s.env.Status)
+	}
+}
+
+func TestApplyEnvFileChange(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	dir, err := ioutil.TempDir("", "envctl-apply")
+	if err != nil {
+		t.Fatal("creating temp dir", nil, err)
+	}
+	defer os.RemoveAll(dir)
+
+	envFile := filepath.Join(dir, ".env")
+	secretFile := filepath.Join(dir, "token")
+	write := func(path, contents string) {
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal("writing "+path, nil, err)
+		}
+	}
+
+	write(envFile, "FOO=bar\n")
+	write(secretFile, "s3cret\n")
+
+	opts := config.Opts{
+		Image:     "test",
+		Shell:     "/foo/sh",
+		Mount:     "/foo/mnt",
+		EnvFiles:  []string{envFile},
+		Variables: map[string]string{"TOKEN": "file://" + secretFile},
+	}
+
+	s, ctl := newAppliedEnv(t, opts)
+	l := memConfig{opts: opts}
+
+	// Secrets are only fingerprinted by their references.
+	write(secretFile, "0th3r\n")
+	if configDrifted(s.env, l) {
+		t.Fatal("drifted after secret changed", false, true)
+	}
+
+	write(envFile, "FOO=baz\n")
+	if !configDrifted(s.env, l) {
+		t.Fatal("drifted after env file changed", true, false)
+	}
+
+	runApply(t, ctl, s, opts)
+
+	if s.env.Container.ImageID != "fooimg" {
+		t.Fatal("reused image", "fooimg", s.env.Container.ImageID)
+	}
+
+	expected := []string{"FOO=baz", "TOKEN=0th3r"}
+	if !reflect.DeepEqual(expected, s.env.Container.Envs) {
+		t.Fatal("variables", expected, s.env.Container.Envs)
+	}
+
+	if configDrifted(s.env, l) {
+		t.Fatal("drifted after applying", false, true)
+	}
+
+	// Environments saved before variables were fingerprinted aren't stale
+	// because of them, but get them saved by the next apply.
+	s.env.Config.Variables = ""
+	write(envFile, "FOO=qux\n")
+	if configDrifted(s.env, l) {
+		t.Fatal("drifted without fingerprinted variables", false, true)
+	}
+
+	recreated := false
+	ctl.recreateFn = func(m container.Metadata) (container.Metadata, error) {
+		recreated = true
+		return m, nil
+	}
+
+	runApply(t, ctl, s, opts)
+
+	if recreated {
+		t.Fatal("recreated without fingerprinted variables", false, recreated)
+	}
+
+	if s.env.Config.Variables == "" {
+		t.Fatal("saved variables fingerprint", "a hash", s.env.Config.Variables)
+	}
+}
+
+func TestApplyImageChange(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	opts := config.Opts{
+		Image: "test",
+		Shell: "/foo/sh",
+		Mount: "/foo/mnt",
+	}
+
+	s, ctl := newAppliedEnv(t, opts)
+
+	opts.Image = "test2"
+	runApply(t, ctl, s, opts)
+
+	if s.env.Container.ImageID == "fooimg" {
+		t.Fatal("rebuilt image", "a new image", s.env.Container.ImageID)
+	}
+
+	if s.env.Container.BaseImage != "test2" {
+		t.Fatal("base image", "test2", s.env.Container.BaseImage)
+	}
+
+	if s.env.Container.ID != ctl.current.ID {
+		t.Fatal("container id", ctl.current.ID, s.env.Container.ID)
+	}
+}
+
+func TestApplyProfileChange(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	opts := config.Opts{
+		Image: "test",
+		Shell: "/foo/sh",
+		Mount: "/foo/mnt",
+	}
+
+	s, ctl := newAppliedEnv(t, opts)
+
+	ran := 0
+	ctl.runFn = func(m container.Metadata, cmds []string) error {
+		ran++
+		return nil
+	}
+
+	opts.Profile = "debug"
+	runApply(t, ctl, s, opts)
+
+	if ran != 0 {
+		t.Fatal("bootstrap runs", 0, ran)
+	}
+
+	if s.env.Profile != "debug" {
+		t.Fatal("saved profile", "debug", s.env.Profile)
+	}
+
+	if s.env.Container.ID != "foocnt" {
+		t.Fatal("container id", "foocnt", s.env.Container.ID)
+	}
+}
+
+func TestApplyRetriesFailedChange(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	opts := config.Opts{
+		Image: "test",
+		Shell: "/foo/sh",
+		Mount: "/foo/mnt",
+	}
+
+	s, ctl := newAppliedEnv(t, opts)
+	old := s.env.Config
+
+	ran := 0
+	ctl.runFn = func(m container.Metadata, cmds []string) error {
+		ran++
+		return errors.New("bootstrap failed")
+	}
+
+	opts.Bootstrap = []config.Step{{Run: "false"}}
+	if err := applyQuietly(t, ctl, s, opts); err == nil {
+		t.Fatal("applying a failing bootstrap", "an error", err)
+	}
+
+	if s.env.Status != db.StatusError {
+		t.Fatal("environment status", db.StatusError, s.env.Status)
+	}
+
+	if s.env.Config != old {
+		t.Fatal("saved fingerprint", old, s.env.Config)
+	}
+
+	ctl.runFn = func(m container.Metadata, cmds []string) error {
+		ran++
+		return nil
+	}
+
+	if err := applyQuietly(t, ctl, s, opts); err != nil {
+		t.Fatal("applying again", nil, err)
+	}
+
+	if ran != 2 {
+		t.Fatal("bootstrap runs", 2, ran)
+	}
+
+	if s.env.Status != db.StatusReady {
+		t.Fatal("environment status", db.StatusReady, s.env.Status)
+	}
+}
+
+func TestApplyImageChangeFails(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	opts := config.Opts{
+		Image: "test",
+		Shell: "/foo/sh",
+		Mount: "/foo/mnt",
+	}
+
+	s, ctl := newAppliedEnv(t, opts)
+
+	removed := []string{}
+	ctl.removeFn = func(m container.Metadata) error {
+		removed = append(removed, m.ID)
+		return nil
+	}
+
+	// The image is built, but the container can't be created from it.
+	ctl.createFn = func(m container.Metadata) (container.Metadata, error) {
+		m.ImageID = "barimg"
+		return m, errors.New("port is already allocated")
+	}
+
+	opts.Image = "test2"
+	if err := applyQuietly(t, ctl, s, opts); err == nil {
+		t.Fatal("applying with a failing create", "an error", err)
+	}
+
+	if len(removed) != 1 || removed[0] != "foocnt" {
+		t.Fatal("removed containers", []string{"foocnt"}, removed)
+	}
+
+	if s.env.Status != db.StatusError {
+		t.Fatal("environment status", db.StatusError, s.env.Status)
+	}
+
+	// What's saved is what exists now, for destroy to clean up, rather than
+	// the container that was removed.
+	if s.env.Container.ID != "" || s.env.Container.ImageID != "barimg" {
+		t.Fatal("saved container", "barimg and no container",
+			[]string{s.env.Container.ImageID, s.env.Container.ID})
+	}
+}
+
+func TestApplyContainerChangeFails(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	opts := config.Opts{
+		Image: "test",
+		Shell: "/foo/sh",
+		Mount: "/foo/mnt",
+	}
+
+	s, ctl := newAppliedEnv(t, opts)
+
+	// The old container is removed, but the new one can't be created.
+	ctl.recreateFn = func(m container.Metadata) (container.Metadata, error) {
+		m.ID = ""
+		return m, errors.New("port is already allocated")
+	}
+
+	opts.Variables = map[string]string{"foo": "bar"}
+	if err := applyQuietly(t, ctl, s, opts); err == nil {
+		t.Fatal("applying with a failing recreate", "an error", err)
+	}
+
+	if s.env.Container.ID != "" || s.env.Container.ImageID != "fooimg" {
+		t.Fatal("saved container", "fooimg and no container",
+			[]string{s.env.Container.ImageID, s.env.Container.ID})
+	}
+}
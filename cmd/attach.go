@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/winiceo/genv/internal/config"
+	"github.com/winiceo/genv/internal/db"
+	"github.com/winiceo/genv/pkg/container"
+	"github.com/spf13/cobra"
+)
+
+func newAttachCmd(ctl container.Controller, s db.Store) *cobra.Command {
+	attachDesc := "attach to a detached session"
+	attachLongDesc := `attach - Attach to a detached session
+
+"attach" attaches to a login session that was detached from, right where it
+was left. Without a session name it picks the detached one, as long as there's
+only one of them. "envctl sessions" lists the sessions there are.
+
+Attaching to a session that's attached somewhere else moves it here.`
+
+	msgEnvOff := `Wait! The environment isn't ready yet!
+
+To get it ready, run "envctl create".`
+
+	msgNoDetached := `There aren't any detached sessions to attach to.
+
+Run "envctl login" to start one.`
+
+	var keys string
+
+	runAttach := func(cmd *cobra.Command, args []string) {
+		env, err := s.Read()
+		if err != nil {
+			fmt.Printf("error reading data store: %v\n", err)
+			os.Exit(1)
+		}
+
+		if !env.Initialized() {
+			fmt.Println(msgEnvOff)
+			os.Exit(1)
+		}
+
+		sessions, err := ctl.Sessions(env.Container)
+		if err != nil {
+			fmt.Printf("error listing sessions: %v\n", err)
+			os.Exit(1)
+		}
+
+		name, err := pickSession(sessions, args)
+		if err == errNoDetached {
+			fmt.Println(msgNoDetached)
+			os.Exit(1)
+		} else if err != nil {
+			fmt.Printf("error: %v\n", err)
+			os.Exit(1)
+		}
+
+		opts, err := attachOptions(name, keys)
+		if err != nil {
+			fmt.Printf("error: %v\n", err)
+			os.Exit(1)
+		}
+
+		err = ctl.Attach(env.Container, opts)
+		if err != nil && !printDetached(err) {
+			fmt.Printf("error attaching to session: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	attachCmd := &cobra.Command{
+		Use:   "attach [session]",
+		Short: attachDesc,
+		Long:  attachLongDesc,
+		Args:  cobra.MaximumNArgs(1),
+		Run:   runAttach,
+	}
+
+	addDetachKeysFlag(attachCmd, &keys)
+
+	return attachCmd
+}
+
+var errNoDetached = errors.New("there aren't any detached sessions")
+
+// pickSession returns the name of the session to attach to out of
+// `sessions`: the one named in `args`, or else the only detached one.
+func pickSession(sessions []container.Session, args []string) (string, error) {
+	if len(args) > 0 {
+		for _, s := range sessions {
+			if s.Name == args[0] {
+				return s.Name, nil
+			}
+		}
+
+		return "", fmt.Errorf(`there's no session %v, run "envctl sessions" to list them`, args[0])
+	}
+
+	detached := []string{}
+	for _, s := range sessions {
+		if !s.Attached {
+			detached = append(detached, s.Name)
+		}
+	}
+
+	switch len(detached) {
+	case 0:
+		return "", errNoDetached
+	case 1:
+		return detached[0], nil
+	}
+
+	return "", fmt.Errorf("there are %v detached sessions, pick one of %v",
+		len(detached), strings.Join(detached, ", "))
+}
+
+// attachOptions returns the options to attach to `session` with. The detach
+// keys are `keys` if they're set, then the ones in the user config, and
+// config.DefaultDetachKeys otherwise.
+func attachOptions(session, keys string) (container.AttachOptions, error) {
+	if keys == "" {
+		ucfg, err := loadUserConfig()
+		if err != nil {
+			return container.AttachOptions{}, err
+		}
+
+		keys = ucfg.DetachKeys
+	}
+
+	if keys == "" {
+		keys = config.DefaultDetachKeys
+	}
+
+	if err := config.CheckDetachKeys(keys); err != nil {
+		return container.AttachOptions{}, err
+	}
+
+	return container.AttachOptions{Session: session, DetachKeys: keys}, nil
+}
+
+// printDetached tells the user how to attach to the session again if `err`
+// says it was detached from, and returns whether it did.
+func printDetached(err error) bool {
+	detached, ok := err.(*container.DetachedError)
+	if !ok {
+		return false
+	}
+
+	if detached.Session == "" {
+		fmt.Println("\nDetached. The environment doesn't have tmux, so the session was ended.")
+		return true
+	}
+
+	fmt.Printf("\nDetached from session %v.\n\nRun \"envctl attach %v\" to attach to it again.\n",
+		detached.Session, detached.Session)
+
+	return true
+}
+
+func addDetachKeysFlag(cmd *cobra.Command, keys *string) {
+	cmd.Flags().StringVar(
+		keys,
+		"detach-keys",
+		"",
+		`key sequence that detaches from the session, like "ctrl-a,d" (default is the user config's detach_keys, or ctrl-p,ctrl-q)`,
+	)
+}
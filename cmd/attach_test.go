@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/winiceo/genv/internal/config"
+	"github.com/winiceo/genv/pkg/container"
+	"github.com/winiceo/genv/test_pkg"
+)
+
+func TestPickSession(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	sessions := []container.Session{
+		{Name: "1", Attached: true},
+		{Name: "2"},
+	}
+
+	if name, err := pickSession(sessions, nil); err != nil || name != "2" {
+		t.Fatal("picking the detached session", "2", name)
+	}
+
+	if name, err := pickSession(sessions, []string{"1"}); err != nil || name != "1" {
+		t.Fatal("picking a named session", "1", name)
+	}
+
+	expected := `there's no session 3, run "envctl sessions" to list them`
+	if _, err := pickSession(sessions, []string{"3"}); err == nil || err.Error() != expected {
+		t.Fatal("picking a missing session", expected, err)
+	}
+
+	if _, err := pickSession(sessions[:1], nil); err != errNoDetached {
+		t.Fatal("picking without detached sessions", errNoDetached, err)
+	}
+
+	expected = "there are 2 detached sessions, pick one of 2, 3"
+	sessions = append(sessions, container.Session{Name: "3"})
+	if _, err := pickSession(sessions, nil); err == nil || err.Error() != expected {
+		t.Fatal("picking between detached sessions", expected, err)
+	}
+}
+
+func TestAttachOptions(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	defer func(f func() (config.UserConfig, error)) { loadUserConfig = f }(loadUserConfig)
+
+	opts, err := attachOptions("1", "")
+	if err != nil || opts.DetachKeys != config.DefaultDetachKeys {
+		t.Fatal("default detach keys", config.DefaultDetachKeys, opts.DetachKeys)
+	}
+
+	loadUserConfig = func() (config.UserConfig, error) {
+		return config.UserConfig{DetachKeys: "ctrl-a,d"}, nil
+	}
+
+	opts, err = attachOptions("1", "")
+	if err != nil || opts.DetachKeys != "ctrl-a,d" {
+		t.Fatal("user config's detach keys", "ctrl-a,d", opts.DetachKeys)
+	}
+
+	opts, err = attachOptions("1", "ctrl-x,x")
+	if err != nil || opts.DetachKeys != "ctrl-x,x" {
+		t.Fatal("flag's detach keys", "ctrl-x,x", opts.DetachKeys)
+	}
+
+	if opts.Session != "1" {
+		t.Fatal("session", "1", opts.Session)
+	}
+
+	expected := `detach keys "ctrl-foo" aren't valid, should be like "ctrl-p,ctrl-q"`
+	if _, err := attachOptions("", "ctrl-foo"); err == nil || err.Error() != expected {
+		t.Fatal("invalid detach keys", expected, err)
+	}
+}
@@ -0,0 +1,265 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/winiceo/genv/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func newConfigCmd() *cobra.Command {
+	configDesc := "inspect the config file and edit the user config"
+	configLongDesc := `config - Inspect the config file and edit the user config
+
+Besides the project's config file, envctl reads a config of your own from
+$XDG_CONFIG_HOME/envctl/config.yaml, for personal settings and defaults. Use
+"get" and "set" to edit it.`
+
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: configDesc,
+		Long:  configLongDesc,
+	}
+
+	configCmd.AddCommand(newConfigShowCmd())
+	configCmd.AddCommand(newConfigSchemaCmd())
+	configCmd.AddCommand(newConfigMigrateCmd())
+	configCmd.AddCommand(newConfigGetCmd())
+	configCmd.AddCommand(newConfigSetCmd())
+
+	return configCmd
+}
+
+func newConfigShowCmd() *cobra.Command {
+	showDesc := "print the config file"
+	showLongDesc := `show - Print the config file
+
+"show" prints the config file as it is. With --resolved, it prints the config
+envctl actually uses instead: the config file merged onto the files it extends,
+with the local overlay and the selected profile merged on top. Every value is
+followed by a comment saying which file it came from.`
+
+	var resolved bool
+
+	runShow := func(cmd *cobra.Command, args []string) {
+		if !resolved {
+			f, err := os.Open(cfgFile)
+			if err != nil {
+				fmt.Printf("error opening %v: %v\n", cfgFile, err)
+				os.Exit(1)
+			}
+			defer f.Close()
+
+			if _, err := io.Copy(os.Stdout, f); err != nil {
+				fmt.Printf("error reading %v: %v\n", cfgFile, err)
+				os.Exit(1)
+			}
+
+			return
+		}
+
+		doc, err := config.Resolve(cfgFile)
+		if err != nil {
+			fmt.Printf("error reading config file: %v\n", err)
+			os.Exit(1)
+		}
+
+		doc, err = doc.WithProfile(profile)
+		if err != nil {
+			fmt.Printf("error selecting profile: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := doc.Write(os.Stdout); err != nil {
+			fmt.Printf("error printing config: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	showCmd := &cobra.Command{
+		Use:   "show",
+		Short: showDesc,
+		Long:  showLongDesc,
+		Run:   runShow,
+	}
+
+	showCmd.Flags().BoolVar(
+		&resolved,
+		"resolved",
+		false,
+		"print the merged config along with where each value came from",
+	)
+
+	return showCmd
+}
+
+func newConfigSchemaCmd() *cobra.Command {
+	schemaDesc := "print a JSON Schema for the config file"
+	schemaLongDesc := `schema - Print a JSON Schema for the config file
+
+"schema" prints a JSON Schema describing the config file, which editors can use
+to check and complete it. For example, with the YAML language server, save it
+and add this to the top of "envctl.yaml":
+
+    # yaml-language-server: $schema=./envctl.schema.json`
+
+	runSchema := func(cmd *cobra.Command, args []string) {
+		schema, err := config.Schema()
+		if err != nil {
+			fmt.Printf("error generating schema: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Println(string(schema))
+	}
+
+	return &cobra.Command{
+		Use:   "schema",
+		Short: schemaDesc,
+		Long:  schemaLongDesc,
+		Run:   runSchema,
+	}
+}
+
+func newConfigMigrateCmd() *cobra.Command {
+	migrateDesc := "upgrade the config file to the current format"
+	migrateLongDesc := fmt.Sprintf(`migrate - Upgrade the config file to the current format
+
+"migrate" rewrites the config file in version %v of the config format. Older
+files keep working, since they're upgraded whenever they're loaded, but some
+settings are only available in newer versions.
+
+YAML files keep their comments and formatting. JSON and TOML files are written
+out again from scratch. HCL files can't be rewritten, so they have to be
+upgraded by hand.
+
+With --dry-run, the upgraded file is printed instead of written.`, config.Version)
+
+	var dryRun bool
+
+	runMigrate := func(cmd *cobra.Command, args []string) {
+		info, err := os.Stat(cfgFile)
+		if err != nil {
+			fmt.Printf("error reading config file: %v\n", err)
+			os.Exit(1)
+		}
+
+		raw, err := ioutil.ReadFile(cfgFile)
+		if err != nil {
+			fmt.Printf("error reading config file: %v\n", err)
+			os.Exit(1)
+		}
+
+		out, err := config.Migrate(cfgFile, raw)
+		if err != nil {
+			fmt.Printf("error migrating config file: %v\n", err)
+			os.Exit(1)
+		}
+
+		if dryRun {
+			os.Stdout.Write(out)
+			return
+		}
+
+		if bytes.Equal(raw, out) {
+			fmt.Printf("%v is already at version %v\n", displayPath(cfgFile), config.Version)
+			return
+		}
+
+		if err := ioutil.WriteFile(cfgFile, out, info.Mode()); err != nil {
+			fmt.Printf("error writing config file: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("migrated %v to version %v\n", displayPath(cfgFile), config.Version)
+	}
+
+	migrateCmd := &cobra.Command{
+		Use:   "migrate",
+		Short: migrateDesc,
+		Long:  migrateLongDesc,
+		Run:   runMigrate,
+	}
+
+	migrateCmd.Flags().BoolVar(
+		&dryRun,
+		"dry-run",
+		false,
+		"print the upgraded config instead of writing it",
+	)
+
+	return migrateCmd
+}
+
+// userSettingsHelp lists the settings in the user config, for the help of the
+// commands that edit it.
+func userSettingsHelp() string {
+	return "Settings:\n  " + strings.Join(config.UserSettings(), "\n  ")
+}
+
+func newConfigGetCmd() *cobra.Command {
+	getDesc := "print a setting from the user config"
+	getLongDesc := `get - Print a setting from the user config
+
+"get" prints the value of a setting in the user config, like "resources.memory".
+Lists are printed as comma separated values. Nothing is printed for settings
+that aren't set, and the exit status is 1.
+
+` + userSettingsHelp()
+
+	runGet := func(cmd *cobra.Command, args []string) {
+		value, ok, err := config.GetUserSetting(args[0])
+		if err != nil {
+			fmt.Printf("error reading user config: %v\n", err)
+			os.Exit(1)
+		}
+
+		if !ok {
+			os.Exit(1)
+		}
+
+		fmt.Println(value)
+	}
+
+	return &cobra.Command{
+		Use:   "get <setting>",
+		Short: getDesc,
+		Long:  getLongDesc,
+		Args:  cobra.ExactArgs(1),
+		Run:   runGet,
+	}
+}
+
+func newConfigSetCmd() *cobra.Command {
+	setDesc := "change a setting in the user config"
+	setLongDesc := `set - Change a setting in the user config
+
+"set" changes a setting in the user config, like "resources.memory", creating
+the config if there isn't one yet. Lists are given as comma separated values,
+and an empty value removes the setting:
+
+    envctl config set forward ssh_agent,git_config
+    envctl config set resources.memory ""
+
+` + userSettingsHelp()
+
+	runSet := func(cmd *cobra.Command, args []string) {
+		if err := config.SetUserSetting(args[0], args[1]); err != nil {
+			fmt.Printf("error changing user config: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	return &cobra.Command{
+		Use:   "set <setting> <value>",
+		Short: setDesc,
+		Long:  setLongDesc,
+		Args:  cobra.ExactArgs(2),
+		Run:   runSet,
+	}
+}
@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/winiceo/genv/internal/archive"
+	"github.com/winiceo/genv/internal/db"
+	"github.com/winiceo/genv/pkg/container"
+	"github.com/spf13/cobra"
+)
+
+// copyPath is one end of a copy, a path on the host or in the environment.
+// The path "-" is a tar stream on stdin or stdout.
+type copyPath struct {
+	env  bool
+	path string
+}
+
+// parseCopyPath parses a path like "env:/etc/hosts" or "host:bin/tool". Paths
+// without a prefix are on the host.
+func parseCopyPath(s string) copyPath {
+	switch {
+	case strings.HasPrefix(s, "env:"):
+		return copyPath{env: true, path: s[len("env:"):]}
+	case strings.HasPrefix(s, "host:"):
+		return copyPath{path: s[len("host:"):]}
+	}
+
+	return copyPath{path: s}
+}
+
+func newCpCmd(ctl container.Controller, s db.Store) *cobra.Command {
+	cpDesc := "copy files between the host and the environment"
+	cpLongDesc := `cp - Copy files between the host and the environment
+
+"cp" copies a file or a directory, with everything in it, from the host into
+the environment or the other way around. Paths in the environment start with
+"env:", and paths on the host can start with "host:". Relative paths in the
+environment are relative to where the project is mounted.
+
+Like cp, when the destination is a directory that exists, what's copied goes
+into it, and otherwise it's copied to the destination under that name. Modes
+and symlinks are kept. Files copied into the environment belong to the
+environment's user.
+
+Use "-" instead of a path on the host to read a tar archive from stdin and
+extract it into a directory in the environment, or to write a tar archive to
+stdout. Files from an archive keep the owners they have in it.
+
+Examples:
+  envctl cp env:/etc/nginx/nginx.conf .
+  envctl cp bin/tool env:/usr/local/bin
+  tar -c dist | envctl cp - env:/srv`
+
+	msgEnvOff := `The environment is off!
+
+To create it, run "envctl create".`
+
+	runCp := func(cmd *cobra.Command, args []string) {
+		src, dst := parseCopyPath(args[0]), parseCopyPath(args[1])
+		if src.env == dst.env {
+			fmt.Println(`error: one path has to be in the environment, starting with "env:", and the other on the host`)
+			os.Exit(1)
+		}
+
+		env, err := s.Read()
+		if err != nil {
+			fmt.Printf("error reading data store: %v\n", err)
+			os.Exit(1)
+		}
+
+		if !env.Initialized() {
+			fmt.Println(msgEnvOff)
+			os.Exit(1)
+		}
+
+		if dst.env {
+			err = copyToEnv(ctl, env.Container, src.path, envPath(env.Container, dst.path))
+		} else {
+			err = copyFromEnv(ctl, env.Container, envPath(env.Container, src.path), dst.path)
+		}
+
+		if err != nil {
+			fmt.Printf("error copying: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	return &cobra.Command{
+		Use:   "cp <source> <destination>",
+		Short: cpDesc,
+		Long:  cpLongDesc,
+		Args:  cobra.ExactArgs(2),
+		Run:   runCp,
+	}
+}
+
+// envPath makes `p`, a path in the environment, absolute.
+func envPath(m container.Metadata, p string) string {
+	if path.IsAbs(p) {
+		return p
+	}
+
+	return path.Join(m.Mount.Destination, p)
+}
+
+// copyToEnv copies `src` on the host to `dst` in the environment.
+func copyToEnv(ctl container.Controller, m container.Metadata, src, dst string) error {
+	if src == "-" {
+		return ctl.CopyTo(m, dst, os.Stdin)
+	}
+
+	if _, err := os.Lstat(src); err != nil {
+		return err
+	}
+
+	// Paths like "." are named by the directory they're in.
+	abs, err := filepath.Abs(src)
+	if err != nil {
+		return err
+	}
+
+	dir, name := dst, filepath.Base(abs)
+	if stat, err := ctl.Stat(m, dst); err != nil || !stat.Mode.IsDir() {
+		if strings.HasSuffix(dst, "/") {
+			return fmt.Errorf("%v isn't a directory in the environment", dst)
+		}
+
+		dir, name = path.Dir(dst), path.Base(dst)
+	}
+
+	owner, known := copyOwner(m)
+
+	// The archive is streamed, since a directory can be any size.
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(archive.DirAs(w, src, name, owner))
+	}()
+
+	err = ctl.CopyTo(m, dir, r)
+	r.Close()
+
+	if err != nil || known {
+		return err
+	}
+
+	return chownInEnv(ctl, m, path.Join(dir, name))
+}
+
+// copyOwner returns who files copied into the environment with the metadata
+// `m` belong to in the archive, and whether that's its user. Only the IDs of
+// root and the host user are known outside of the environment.
+func copyOwner(m container.Metadata) (archive.Owner, bool) {
+	if m.HostUser != nil {
+		return archive.Owner{UID: m.HostUser.UID, GID: m.HostUser.GID}, true
+	}
+
+	return archive.Owner{}, m.User == "" || m.User == "root"
+}
+
+// chownInEnv hands `p` in the environment with the metadata `m`, and
+// everything in it, over to the environment's user.
+func chownInEnv(ctl container.Controller, m container.Metadata, p string) error {
+	script := `chown -R "$(id -u "$0")":"$(id -g "$0")" "$1"`
+	if strings.Contains(m.User, ":") {
+		script = `chown -R "$0" "$1"`
+	}
+
+	asRoot := m
+	asRoot.User = "root"
+
+	if err := ctl.Run(asRoot, []string{"sh", "-c", script, m.User, p}); err != nil {
+		return fmt.Errorf("handing %v over to %v: %v", p, m.User, err)
+	}
+
+	return nil
+}
+
+// copyFromEnv copies `src` in the environment to `dst` on the host.
+func copyFromEnv(ctl container.Controller, m container.Metadata, src, dst string) error {
+	content, err := ctl.CopyFrom(m, src)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	if dst == "-" {
+		_, err := io.Copy(os.Stdout, content)
+		return err
+	}
+
+	if info, err := os.Stat(dst); err == nil && info.IsDir() {
+		return archive.Extract(content, dst, "")
+	}
+
+	if strings.HasSuffix(dst, "/") || strings.HasSuffix(dst, string(filepath.Separator)) {
+		return fmt.Errorf("%v isn't a directory", dst)
+	}
+
+	return archive.Extract(content, filepath.Dir(dst), filepath.Base(dst))
+}
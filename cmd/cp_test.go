@@ -0,0 +1,275 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/winiceo/genv/internal/archive"
+	"github.com/winiceo/genv/pkg/container"
+	"github.com/winiceo/genv/test_pkg"
+)
+
+func TestParseCopyPath(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	cases := map[string]copyPath{
+		"env:/etc/hosts":  {env: true, path: "/etc/hosts"},
+		"env:build":       {env: true, path: "build"},
+		"host:bin/tool":   {path: "bin/tool"},
+		"bin/tool":        {path: "bin/tool"},
+		"-":               {path: "-"},
+		"C:\\Users\\test": {path: "C:\\Users\\test"},
+	}
+
+	for s, expected := range cases {
+		if actual := parseCopyPath(s); !reflect.DeepEqual(expected, actual) {
+			t.Fatal("parsing "+s, expected, actual)
+		}
+	}
+}
+
+// tarEntries returns the names of the entries in the tar archive in `r`.
+func tarEntries(r io.Reader) ([]string, error) {
+	entries := []string{}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, hdr.Name)
+	}
+}
+
+func TestCopyToEnv(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	src, err := ioutil.TempDir("", "envctl-cp")
+	if err != nil {
+		t.Fatal("creating temp dir", nil, err)
+	}
+	defer os.RemoveAll(src)
+
+	if err := ioutil.WriteFile(filepath.Join(src, "tool"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal("writing file", nil, err)
+	}
+
+	ctl := newMockCtl(&container.Metadata{})
+	ctl.statFn = func(m container.Metadata, p string) (container.PathStat, error) {
+		if p == "/usr/local/bin" {
+			return container.PathStat{Name: "bin", Mode: os.ModeDir | 0755}, nil
+		}
+
+		return newMockCtl(nil).statFn(m, p)
+	}
+
+	var dir string
+	var entries []string
+	ctl.copyToFn = func(m container.Metadata, d string, content io.Reader) error {
+		dir = d
+		entries, err = tarEntries(content)
+		return err
+	}
+
+	cases := []struct {
+		src, dst string
+		dir      string
+		entries  []string
+	}{
+		{filepath.Join(src, "tool"), "/usr/local/bin", "/usr/local/bin", []string{"tool"}},
+		{filepath.Join(src, "tool"), "/usr/local/bin/other", "/usr/local/bin", []string{"other"}},
+		{src, "/srv/app", "/srv", []string{"app/", "app/tool"}},
+	}
+
+	for _, c := range cases {
+		if err := copyToEnv(ctl, container.Metadata{}, c.src, c.dst); err != nil {
+			t.Fatal("copying to "+c.dst, nil, err)
+		}
+
+		if dir != c.dir {
+			t.Fatal("directory "+c.dst+" is copied into", c.dir, dir)
+		}
+
+		if !reflect.DeepEqual(c.entries, entries) {
+			t.Fatal("entries copied to "+c.dst, c.entries, entries)
+		}
+	}
+
+	expected := "/missing/ isn't a directory in the environment"
+	err = copyToEnv(ctl, container.Metadata{}, filepath.Join(src, "tool"), "/missing/")
+	if err == nil || err.Error() != expected {
+		t.Fatal("copying into a missing directory", expected, err)
+	}
+}
+
+func TestCopyToEnvOwner(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	src, err := ioutil.TempDir("", "envctl-cp")
+	if err != nil {
+		t.Fatal("creating temp dir", nil, err)
+	}
+	defer os.RemoveAll(src)
+
+	if err := ioutil.WriteFile(filepath.Join(src, "tool"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal("writing file", nil, err)
+	}
+
+	var owners [][]int
+	var run []string
+	var runAs string
+
+	ctl := newMockCtl(&container.Metadata{})
+	ctl.copyToFn = func(m container.Metadata, d string, content io.Reader) error {
+		tr := tar.NewReader(content)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+
+			owners = append(owners, []int{hdr.Uid, hdr.Gid})
+		}
+	}
+	ctl.runFn = func(m container.Metadata, cmds []string) error {
+		run, runAs = cmds, m.User
+		return nil
+	}
+
+	cases := []struct {
+		m      container.Metadata
+		owners [][]int
+		run    []string
+	}{
+		{container.Metadata{User: "root"}, [][]int{{0, 0}, {0, 0}}, nil},
+		{
+			container.Metadata{
+				User:     "dev",
+				HostUser: &container.HostUser{Name: "dev", UID: 1000, GID: 100},
+			},
+			[][]int{{1000, 100}, {1000, 100}},
+			nil,
+		},
+		{
+			container.Metadata{User: "app"},
+			[][]int{{0, 0}, {0, 0}},
+			[]string{"sh", "-c", `chown -R "$(id -u "$0")":"$(id -g "$0")" "$1"`, "app", "/srv/app"},
+		},
+		{
+			container.Metadata{User: "app:staff"},
+			[][]int{{0, 0}, {0, 0}},
+			[]string{"sh", "-c", `chown -R "$0" "$1"`, "app:staff", "/srv/app"},
+		},
+	}
+
+	for _, c := range cases {
+		owners, run, runAs = nil, nil, ""
+
+		if err := copyToEnv(ctl, c.m, src, "/srv/app"); err != nil {
+			t.Fatal("copying as "+c.m.User, nil, err)
+		}
+
+		if !reflect.DeepEqual(c.owners, owners) {
+			t.Fatal("owners copying as "+c.m.User, c.owners, owners)
+		}
+
+		if !reflect.DeepEqual(c.run, run) {
+			t.Fatal("commands copying as "+c.m.User, c.run, run)
+		}
+
+		if run != nil && runAs != "root" {
+			t.Fatal("user handing files over to "+c.m.User, "root", runAs)
+		}
+	}
+}
+
+func TestCopyFromEnv(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	src, err := ioutil.TempDir("", "envctl-cp")
+	if err != nil {
+		t.Fatal("creating temp dir", nil, err)
+	}
+	defer os.RemoveAll(src)
+
+	dst, err := ioutil.TempDir("", "envctl-cp")
+	if err != nil {
+		t.Fatal("creating temp dir", nil, err)
+	}
+	defer os.RemoveAll(dst)
+
+	if err := ioutil.WriteFile(filepath.Join(src, "nginx.conf"), []byte("worker_processes 1;\n"), 0600); err != nil {
+		t.Fatal("writing file", nil, err)
+	}
+
+	ctl := newMockCtl(&container.Metadata{})
+	ctl.copyFromFn = func(m container.Metadata, p string) (io.ReadCloser, error) {
+		if p != "/etc/nginx/nginx.conf" {
+			t.Fatal("path copied from", "/etc/nginx/nginx.conf", p)
+		}
+
+		buf := &bytes.Buffer{}
+		err := archive.Dir(buf, filepath.Join(src, "nginx.conf"), "nginx.conf")
+		return ioutil.NopCloser(buf), err
+	}
+
+	for _, target := range []string{dst, filepath.Join(dst, "renamed.conf")} {
+		if err := copyFromEnv(ctl, container.Metadata{}, "/etc/nginx/nginx.conf", target); err != nil {
+			t.Fatal("copying to "+target, nil, err)
+		}
+	}
+
+	for _, name := range []string{"nginx.conf", "renamed.conf"} {
+		info, err := os.Stat(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatal("copied file "+name, nil, err)
+		}
+
+		if info.Mode().Perm() != 0600 {
+			t.Fatal("mode of "+name, os.FileMode(0600), info.Mode().Perm())
+		}
+	}
+
+	outch, errch := test_pkg.HijackStdout(func() {
+		if err := copyFromEnv(ctl, container.Metadata{}, "/etc/nginx/nginx.conf", "-"); err != nil {
+			t.Fatal("copying to stdout", nil, err)
+		}
+	})
+
+	select {
+	case err := <-errch:
+		t.Fatal("hijacking output", nil, err)
+	case out := <-outch:
+		entries, err := tarEntries(bytes.NewReader(out))
+		if err != nil || strings.Join(entries, ",") != "nginx.conf" {
+			t.Fatal("archive on stdout", "nginx.conf", entries)
+		}
+	}
+}
+
+func TestEnvPath(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	m := container.Metadata{Mount: container.Mount{Destination: "/src"}}
+
+	if actual := envPath(m, "build/out"); actual != "/src/build/out" {
+		t.Fatal("relative path", "/src/build/out", actual)
+	}
+
+	if actual := envPath(m, "/etc/hosts"); actual != "/etc/hosts" {
+		t.Fatal("absolute path", "/etc/hosts", actual)
+	}
+}
@@ -3,11 +3,19 @@ package cmd
 import (
 	"bytes"
 	"fmt"
-	"io"
 	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/winiceo/genv/internal/config"
 	"github.com/winiceo/genv/internal/db"
+	"github.com/winiceo/genv/internal/dotenv"
+	"github.com/winiceo/genv/internal/secret"
 	"github.com/winiceo/genv/pkg/container"
 	"github.com/google/uuid"
 	"github.com/spf13/cobra"
@@ -47,40 +55,22 @@ To use it, run "envctl login", or destroy it with "envctl destroy".`
 			os.Exit(1)
 		}
 
-		name := uuid.New().String()
-		baseImage := cfg.Image
-		shell := cfg.Shell
-		mount := cfg.Mount
-
-		if mount == "" {
-			fmt.Println("no mount specified, defaulting to /mnt/repo...")
-			mount = "/mnt/repo"
-		}
-
-		envs, err := parseVariables(cfg)
+		meta, err := newMetadata(cfg)
 		if err != nil {
-			fmt.Printf("error getting environment variables: %v\n", err)
+			fmt.Printf("error creating environment: %v\n", err)
 			os.Exit(1)
 		}
 
-		pwd, err := os.Getwd()
+		fp, err := fingerprintConfig(cfg)
 		if err != nil {
-			fmt.Printf("error getting current working directory: %v\n", err)
+			fmt.Printf("error fingerprinting config: %v\n", err)
 			os.Exit(1)
 		}
 
-		meta := container.Metadata{
-			BaseName:  name,
-			BaseImage: baseImage,
-			Shell:     shell,
-			Mount: container.Mount{
-				Source:      pwd,
-				Destination: mount,
-			},
-			Envs:    envs,
-			NoCache: !(*cfg.CacheImage),
-			User:    cfg.User,
-			Ports:   cfg.Ports,
+		meta.Ports, err = reservePorts(meta.Ports, nil)
+		if err != nil {
+			fmt.Printf("error creating environment: %v\n", err)
+			os.Exit(1)
 		}
 
 		fmt.Println("creating your environment...")
@@ -91,56 +81,25 @@ To use it, run "envctl login", or destroy it with "envctl destroy".`
 			os.Exit(1)
 		}
 
-		rawcmds := cfg.Bootstrap
-		if len(rawcmds) > 0 {
-			fmt.Println("running bootstrap steps...")
-
-			script := &bytes.Buffer{}
-			for _, rawcmd := range rawcmds {
-				_, err := script.WriteString(fmt.Sprintf("%v\n", rawcmd))
-				if err != nil {
-					fmt.Printf("error generating bootstrap script: %v\n", err)
-					s.Create(db.Environment{
-						Status:    db.StatusError,
-						Container: newMeta,
-					})
-					os.Exit(1)
-				}
-			}
-
-			fname := ".envctl/" + uuid.New().String()
-			f, err := os.OpenFile(fname, os.O_CREATE|os.O_RDWR, os.ModePerm)
-			if err != nil {
-				fmt.Printf("error opening tmp script for writing: %v\n", err)
-				os.Exit(1)
-			}
-
-			if _, err := io.Copy(f, script); err != nil {
-				fmt.Printf("error writing bootstrap script: %v\n", err)
-				s.Create(db.Environment{
-					Status:    db.StatusError,
-					Container: newMeta,
-				})
-				os.Exit(1)
-			}
-
-			cmdarr := []string{shell, fname}
-
-			err = ctl.Run(newMeta, cmdarr)
-			if err != nil {
-				fmt.Printf("error running %v: %v\n", cmdarr, err)
-				s.Create(db.Environment{
-					Status:    db.StatusError,
-					Container: newMeta,
-				})
-				os.Exit(1)
-			}
+		if err := runBootstrap(ctl, newMeta, cfg.Bootstrap); err != nil {
+			fmt.Printf("error bootstrapping environment: %v\n", err)
+			s.Create(db.Environment{
+				Status:    db.StatusError,
+				Container: newMeta,
+				Config:    fp,
+				Profile:   cfg.Profile,
+			})
+			os.Exit(1)
 		}
 
+		installDotfiles(ctl, newMeta)
+
 		fmt.Println("saving environment...")
 		err = s.Create(db.Environment{
 			Status:    db.StatusReady,
 			Container: newMeta,
+			Config:    fp,
+			Profile:   cfg.Profile,
 		})
 		if err != nil {
 			fmt.Printf("error saving environment: %v\n", err)
@@ -156,24 +115,361 @@ To use it, run "envctl login", or destroy it with "envctl destroy".`
 	}
 }
 
-func parseVariables(cfg config.Opts) ([]string, error) {
+// newMetadata describes the container for an environment configured by `cfg`.
+func newMetadata(cfg config.Opts) (container.Metadata, error) {
+	mount := cfg.Mount
+	if mount == "" {
+		fmt.Println("no mount specified, defaulting to /mnt/repo...")
+		mount = "/mnt/repo"
+	}
+
+	envs, vars, err := parseVariables(cfg)
+	if err != nil {
+		return container.Metadata{}, err
+	}
+
+	ports, err := portMappings(cfg.Ports)
+	if err != nil {
+		return container.Metadata{}, err
+	}
+
+	resources, err := resourceLimits(cfg.Resources)
+	if err != nil {
+		return container.Metadata{}, err
+	}
+
+	ucfg, err := loadUserConfig()
+	if err != nil {
+		return container.Metadata{}, err
+	}
+
+	m := container.Metadata{
+		BaseName:  uuid.New().String(),
+		BaseImage: config.MirrorImage(cfg.Image, ucfg.RegistryMirror),
+		Shell:     cfg.Shell,
+		Mount: container.Mount{
+			Source:      projectDir,
+			Destination: mount,
+		},
+		Envs:      envs,
+		Variables: vars,
+		NoCache:   !(*cfg.CacheImage),
+		User:      cfg.User,
+		Ports:     ports,
+		Resources: resources,
+	}
+
+	if cfg.User == config.HostUser {
+		m.HostUser, err = hostUser()
+		if err != nil {
+			return container.Metadata{}, err
+		}
+
+		m.User = m.HostUser.Name
+	}
+
+	return addForwards(m, cfg.Forward), nil
+}
+
+// currentUser returns the user running envctl.
+var currentUser = user.Current
+
+// validUsername matches the names a host user can keep in the container.
+var validUsername = regexp.MustCompile(`^[a-z_][a-z0-9_.-]*$`)
+
+// hostUser describes the user running envctl, for "user: host".
+func hostUser() (*container.HostUser, error) {
+	u, err := currentUser()
+	if err != nil {
+		return nil, fmt.Errorf("looking up the host user: %v", err)
+	}
+
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return nil, fmt.Errorf("user: host needs numeric user IDs, not %q", u.Uid)
+	}
+
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return nil, fmt.Errorf("user: host needs numeric group IDs, not %q", u.Gid)
+	}
+
+	// Names that can't be used in the container get a name that can, the IDs
+	// are what matter for the files on the mount.
+	name := u.Username
+	if !validUsername.MatchString(name) {
+		name = "envctl"
+	}
+
+	home := u.HomeDir
+	if !path.IsAbs(home) || strings.ContainsAny(home, "':\n") {
+		home = "/home/" + name
+	}
+
+	return &container.HostUser{
+		Name: name,
+		UID:  uid,
+		GID:  gid,
+		Home: home,
+	}, nil
+}
+
+// resourceLimits parses the resource limits in `r`.
+func resourceLimits(r config.Resources) (container.Resources, error) {
+	l, err := r.Parse()
+	if err != nil {
+		return container.Resources{}, err
+	}
+
+	resources := container.Resources{
+		NanoCPUs:   l.NanoCPUs,
+		Memory:     l.Memory,
+		MemorySwap: l.MemorySwap,
+		PidsLimit:  l.PidsLimit,
+		ShmSize:    l.ShmSize,
+	}
+
+	for _, u := range l.Ulimits {
+		resources.Ulimits = append(resources.Ulimits, container.Ulimit{
+			Name: u.Name,
+			Soft: u.Soft,
+			Hard: u.Hard,
+		})
+	}
+
+	return resources, nil
+}
+
+// portMappings expands the port specs in `ports` into a mapping for each port,
+// ordered by protocol. Automatic host ports are left at 0.
+func portMappings(ports config.L3Ports) ([]container.PortMapping, error) {
+	protos := make([]string, 0, len(ports))
+	for proto := range ports {
+		protos = append(protos, proto)
+	}
+	sort.Strings(protos)
+
+	mappings := []container.PortMapping{}
+	for _, proto := range protos {
+		for _, spec := range ports[proto] {
+			r, err := spec.Parse()
+			if err != nil {
+				return nil, err
+			}
+
+			for p := r.Start; p <= r.End; p++ {
+				m := container.PortMapping{
+					Protocol:      proto,
+					HostIP:        r.HostIP,
+					ContainerPort: p,
+					Auto:          r.Auto,
+				}
+
+				// Automatic host ports are only picked when the environment
+				// is created.
+				if !r.Auto {
+					m.HostPort = r.HostStart + p - r.Start
+				}
+
+				mappings = append(mappings, m)
+			}
+		}
+	}
+
+	return mappings, nil
+}
+
+// runBootstrap runs the bootstrap steps in the environment. Steps that run as
+// the same user one after the other are run together, as a single script.
+func runBootstrap(
+	ctl container.Controller,
+	m container.Metadata,
+	steps []config.Step,
+) error {
+	if len(steps) == 0 {
+		return nil
+	}
+
+	fmt.Println("running bootstrap steps...")
+
+	for len(steps) > 0 {
+		user := steps[0].User
+
+		rawcmds := []string{}
+		for len(steps) > 0 && steps[0].User == user {
+			rawcmds = append(rawcmds, steps[0].Run)
+			steps = steps[1:]
+		}
+
+		runAs := m
+		if user != "" {
+			runAs.User = user
+		}
+
+		if err := runScript(ctl, runAs, rawcmds); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runScript runs a list of commands in the environment as a single script, so
+// that one command can rely on what the previous ones did.
+func runScript(
+	ctl container.Controller,
+	m container.Metadata,
+	rawcmds []string,
+) error {
+	script := &bytes.Buffer{}
+	for _, rawcmd := range rawcmds {
+		_, err := script.WriteString(fmt.Sprintf("%v\n", rawcmd))
+		if err != nil {
+			return err
+		}
+	}
+
+	// The script is passed to the shell directly rather than through a file,
+	// since the state directory isn't necessarily mounted in the environment.
+	cmdarr := []string{m.Shell, "-c", script.String()}
+
+	if err := ctl.Run(m, cmdarr); err != nil {
+		return fmt.Errorf("running %v: %v", rawcmds, err)
+	}
+
+	return nil
+}
+
+// parseVariables resolves the values of the variables in `cfg`, returning them
+// as "KEY=value" strings sorted by key, along with where each of them came
+// from.
+//
+// Variables come from the env files first, with later files overriding earlier
+// ones, and then from "variables", which override the env files. The values in
+// "variables" can refer to other variables, which are looked up in the host's
+// environment first and then in the env files. Once they're expanded, values
+// that reference a secret, like "cmd://pass show db", are replaced with the
+// secret.
+func parseVariables(cfg config.Opts) ([]string, []container.Variable, error) {
+	secrets := secret.Resolver{Dir: projectDir, Keyring: secret.DefaultKeyring()}
+	return resolveVariables(cfg, secrets.Resolve)
+}
+
+// fingerprintConfig fingerprints `cfg` along with what its variables resolve
+// to. Secrets are left as their references, so nothing is run to resolve them
+// and what they resolve to doesn't end up in the state.
+func fingerprintConfig(cfg config.Opts) (config.Fingerprint, error) {
+	fp, err := cfg.Fingerprint()
+	if err != nil {
+		return config.Fingerprint{}, err
+	}
+
+	envs, _, err := resolveVariables(cfg, func(ref string) (string, error) {
+		return ref, nil
+	})
+	if err != nil {
+		return config.Fingerprint{}, err
+	}
+
+	return fp.WithVariables(envs)
+}
+
+// resolveVariables does the work of parseVariables, with secrets resolved by
+// `resolveSecret`.
+func resolveVariables(
+	cfg config.Opts,
+	resolveSecret func(ref string) (string, error),
+) ([]string, []container.Variable, error) {
 	rawenvs := cfg.Variables
 
+	fileenvs := map[string]string{}
+	filesources := map[string]string{}
+	for _, path := range cfg.EnvFiles {
+		vars, err := dotenv.Read(path)
+		if err != nil {
+			return []string{}, []container.Variable{}, err
+		}
+
+		source := path
+		if rel, err := filepath.Rel(projectDir, path); err == nil {
+			source = rel
+		}
+
+		for k, v := range vars {
+			fileenvs[k] = v
+			filesources[k] = source
+		}
+	}
+
+	lookup := func(name string) (string, bool) {
+		if v, ok := os.LookupEnv(name); ok {
+			return v, true
+		}
+
+		v, ok := fileenvs[name]
+		return v, ok
+	}
+
+	keys := make([]string, 0, len(rawenvs)+len(fileenvs))
+	for k := range fileenvs {
+		if _, ok := rawenvs[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+
+	for k := range rawenvs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
 	// This supports dynamic evaluation of environment variables so secrets
 	// don't have to be checked into the repo, but config files don't have
-	// to be generated from templates either.
+	// to be generated from templates either. Everything that's missing is
+	// collected into a single error, so it can all be fixed in one go.
 	envs := []string{}
-	for k, v := range rawenvs {
-		if v[0] == '$' {
-			v = os.Getenv(v[1:])
+	vars := []container.Variable{}
+	missing := []string{}
+	for _, k := range keys {
+		raw, ok := rawenvs[k]
+		if !ok {
+			envs = append(envs, fmt.Sprintf("%v=%v", k, fileenvs[k]))
+			vars = append(vars, container.Variable{Name: k, Source: filesources[k]})
+			continue
 		}
 
-		if v == "" {
-			return []string{}, fmt.Errorf("missing variable %v", k)
+		// Secrets are resolved from the reference as it's written in the
+		// config, so a value from the host can't turn a variable into a
+		// reference, or change what it refers to. They're described by the
+		// reference too, since what it resolves to is secret.
+		if secret.IsRef(raw) {
+			v, err := resolveSecret(raw)
+			if err != nil {
+				err = fmt.Errorf("resolving %v: %v", k, err)
+				return []string{}, []container.Variable{}, err
+			}
+
+			envs = append(envs, fmt.Sprintf("%v=%v", k, v))
+			vars = append(vars, container.Variable{Name: k, Source: raw, Secret: true})
+			continue
+		}
+
+		v, err := config.Interpolate(raw, lookup)
+		if merr, ok := err.(*config.MissingError); ok {
+			missing = append(missing, merr.Problems...)
+			continue
+		}
+
+		if err != nil {
+			return []string{}, []container.Variable{}, err
 		}
 
 		envs = append(envs, fmt.Sprintf("%v=%v", k, v))
+		vars = append(vars, container.Variable{Name: k, Source: "variables"})
+	}
+
+	if len(missing) > 0 {
+		return []string{}, []container.Variable{}, &config.MissingError{Problems: missing}
 	}
 
-	return envs, nil
+	return envs, vars, nil
 }
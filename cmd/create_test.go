@@ -1,7 +1,12 @@
 package cmd
 
 import (
+	"io/ioutil"
 	"os"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/winiceo/genv/internal/config"
@@ -227,7 +232,7 @@ func TestParseMissingVariables(got *testing.T) {
 		},
 	}
 
-	envs, err := parseVariables(opts)
+	envs, _, err := parseVariables(opts)
 	if err == nil {
 		t.Fatal("error parsing variables", "missing variable ENVCTL_TESTING", err)
 	}
@@ -316,6 +321,74 @@ func TestAlternateUser(got *testing.T) {
 	}
 }
 
+func TestHostUser(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	defer func(f func() (*user.User, error)) { currentUser = f }(currentUser)
+	currentUser = func() (*user.User, error) {
+		return &user.User{
+			Uid:      "1000",
+			Gid:      "1001",
+			Username: "Alice Smith",
+			HomeDir:  "/home/alice",
+		}, nil
+	}
+
+	cfg := memConfig{
+		opts: config.Opts{
+			Image:      "test",
+			Shell:      "/foo/sh",
+			Mount:      "/foo/mnt",
+			CacheImage: config.NoCacheImage,
+			User:       config.HostUser,
+			Bootstrap: []config.Step{
+				{Run: "apt-get install -y make", User: "root"},
+				{Run: "make deps"},
+			},
+		},
+	}
+
+	ctl := newMockCtl(nil)
+
+	users := []string{}
+	ctl.runFn = func(m container.Metadata, cmds []string) error {
+		users = append(users, m.User)
+		return nil
+	}
+
+	s := &memStore{
+		env: db.Environment{
+			Status: db.StatusOff,
+		},
+	}
+
+	cmd := newCreateCmd(ctl, s, cfg)
+
+	outch, errch := test_pkg.HijackStdout(func() {
+		cmd.Run(cmd, []string{})
+	})
+
+	select {
+	case err := <-errch:
+		t.Fatal("hijacking output", nil, err)
+	case <-outch:
+	}
+
+	expected := &container.HostUser{Name: "envctl", UID: 1000, GID: 1001, Home: "/home/alice"}
+	if !reflect.DeepEqual(expected, s.env.Container.HostUser) {
+		t.Fatal("host user", expected, s.env.Container.HostUser)
+	}
+
+	if s.env.Container.User != "envctl" {
+		t.Fatal("setting user", "envctl", s.env.Container.User)
+	}
+
+	// Root-only steps still run as root.
+	if strings.Join(users, ",") != "root,envctl" {
+		t.Fatal("bootstrap users", "root,envctl", strings.Join(users, ","))
+	}
+}
+
 func TestPortMappings(got *testing.T) {
 	t := test_pkg.NewT(got)
 
@@ -326,14 +399,10 @@ func TestPortMappings(got *testing.T) {
 			Mount:      "/foo/mnt",
 			CacheImage: config.NoCacheImage,
 			User:       "foouser",
-			Ports: config.L3Ports(map[string][]int{
-				"tcp": []int{
-					99999,
-				},
-				"udp": []int{
-					88888,
-				},
-			}),
+			Ports: config.L3Ports{
+				"tcp": []config.PortSpec{"8080:80", "0.0.0.0:9000-9001:3000-3001"},
+				"udp": []config.PortSpec{"5353"},
+			},
 		},
 	}
 
@@ -359,23 +428,188 @@ func TestPortMappings(got *testing.T) {
 	case <-outch:
 	}
 
-	t.Logf("%v", s.env.Container.Ports)
+	expected := []container.PortMapping{
+		{Protocol: "tcp", HostIP: "127.0.0.1", HostPort: 8080, ContainerPort: 80},
+		{Protocol: "tcp", HostIP: "0.0.0.0", HostPort: 9000, ContainerPort: 3000},
+		{Protocol: "tcp", HostIP: "0.0.0.0", HostPort: 9001, ContainerPort: 3001},
+		{Protocol: "udp", HostIP: "127.0.0.1", HostPort: 5353, ContainerPort: 5353},
+	}
+
+	if !reflect.DeepEqual(expected, s.env.Container.Ports) {
+		t.Fatal("saving ports", expected, s.env.Container.Ports)
+	}
+}
+
+func TestParseAllMissingVariables(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	opts := config.Opts{
+		Image: "test",
+		Shell: "/foo/sh",
+		Variables: map[string]string{
+			"EMPTY": "",
+			"FIRST": "${ENVCTL_TESTING_FIRST}",
+			"LAST":  "${ENVCTL_TESTING_LAST:?needed for tests}",
+		},
+	}
+
+	_, _, err := parseVariables(opts)
 
-	tcp, ok := s.env.Container.Ports["tcp"]
-	if !ok {
-		t.Fatal("saving ports", true, ok)
+	expected := "missing variables: ENVCTL_TESTING_FIRST, " +
+		"ENVCTL_TESTING_LAST (needed for tests)"
+	if err == nil || err.Error() != expected {
+		t.Fatal("error parsing variables", expected, err)
 	}
+}
 
-	if tcp[0] != 99999 {
-		t.Fatal("saving ports", 99999, ok)
+func TestParseEnvFiles(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	dir, err := ioutil.TempDir("", "envctl-envfiles")
+	if err != nil {
+		t.Fatal("creating temp dir", nil, err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"base.env":  "A=base\nB=base\nC=base\nexport HOST_ONLY=file\n",
+		"local.env": "B=local\nC='local'\n",
 	}
 
-	udp, ok := s.env.Container.Ports["udp"]
-	if !ok {
-		t.Fatal("saving ports", true, ok)
+	for name, contents := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+		if err != nil {
+			t.Fatal("writing env file", nil, err)
+		}
 	}
 
-	if udp[0] != 88888 {
-		t.Fatal("saving ports", 88888, ok)
+	os.Setenv("ENVCTL_TESTING_HOST_ONLY", "host")
+	defer os.Unsetenv("ENVCTL_TESTING_HOST_ONLY")
+
+	opts := config.Opts{
+		Image: "test",
+		Shell: "/foo/sh",
+		EnvFiles: []string{
+			filepath.Join(dir, "base.env"),
+			filepath.Join(dir, "local.env"),
+		},
+		Variables: map[string]string{
+			"C":     "vars",
+			"FROM":  "${A}-${B}",
+			"MIXED": "${ENVCTL_TESTING_HOST_ONLY}-${HOST_ONLY}",
+		},
+	}
+
+	actual, _, err := parseVariables(opts)
+	if err != nil {
+		t.Fatal("error parsing variables", nil, err)
+	}
+
+	expected := []string{
+		"A=base",
+		"B=local",
+		"C=vars",
+		"FROM=base-local",
+		"HOST_ONLY=file",
+		"MIXED=host-file",
+	}
+
+	if strings.Join(expected, " ") != strings.Join(actual, " ") {
+		t.Fatal("variables", expected, actual)
+	}
+
+	opts.EnvFiles = append(opts.EnvFiles, filepath.Join(dir, "missing.env"))
+	if _, _, err := parseVariables(opts); err == nil {
+		t.Fatal("error for a missing env file", "an error", err)
+	}
+}
+
+func TestCreateWithSecrets(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	s := &memStore{
+		env: db.Environment{
+			Status: db.StatusOff,
+		},
+	}
+
+	cfg := memConfig{
+		opts: config.Opts{
+			Image: "test",
+			Shell: "/foo/sh",
+			Mount: "/foo/mnt",
+			Variables: map[string]string{
+				"PLAIN": "visible",
+				"TOKEN": "cmd://echo hunter2",
+			},
+		},
+	}
+
+	var created container.Metadata
+	ctl := newMockCtl(nil)
+	ctl.createFn = func(m container.Metadata) (container.Metadata, error) {
+		created = m
+		return m, nil
+	}
+
+	cmd := newCreateCmd(ctl, s, cfg)
+
+	outch, errch := test_pkg.HijackStdout(func() {
+		cmd.Run(cmd, []string{})
+	})
+
+	select {
+	case err := <-errch:
+		t.Fatal("hijacking output", nil, err)
+	case <-outch:
+	}
+
+	expected := []string{"PLAIN=visible", "TOKEN=hunter2"}
+	if strings.Join(expected, " ") != strings.Join(created.Envs, " ") {
+		t.Fatal("variables", expected, created.Envs)
+	}
+
+	vars := []container.Variable{
+		{Name: "PLAIN", Source: "variables"},
+		{Name: "TOKEN", Source: "cmd://echo hunter2", Secret: true},
+	}
+	if !reflect.DeepEqual(vars, created.Variables) {
+		t.Fatal("variable sources", vars, created.Variables)
+	}
+}
+
+func TestParseSecretRefs(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	defer os.Unsetenv("ENVCTL_TESTING_REF")
+	os.Setenv("ENVCTL_TESTING_REF", "cmd://echo leaked")
+
+	opts := config.Opts{
+		Image: "test",
+		Shell: "/foo/sh",
+		Variables: map[string]string{
+			"INDIRECT": "$ENVCTL_TESTING_REF",
+			"TOKEN":    "cmd://echo ${ENVCTL_TESTING_UNSET:-hunter2}",
+		},
+	}
+
+	envs, vars, err := parseVariables(opts)
+	if err != nil {
+		t.Fatal("error parsing variables", nil, err)
+	}
+
+	// References come from the config as it's written, and are left to the
+	// shell running them to expand.
+	expected := []string{"INDIRECT=cmd://echo leaked", "TOKEN=hunter2"}
+	if strings.Join(expected, " ") != strings.Join(envs, " ") {
+		t.Fatal("variables", expected, envs)
+	}
+
+	sources := []container.Variable{
+		{Name: "INDIRECT", Source: "variables"},
+		{Name: "TOKEN", Source: "cmd://echo ${ENVCTL_TESTING_UNSET:-hunter2}", Secret: true},
+	}
+	if !reflect.DeepEqual(sources, vars) {
+		t.Fatal("variable sources", sources, vars)
 	}
 }
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/winiceo/genv/internal/archive"
+	"github.com/winiceo/genv/internal/config"
+	"github.com/winiceo/genv/pkg/container"
+)
+
+// loadUserConfig loads the config of the person running envctl.
+var loadUserConfig = config.LoadUserConfig
+
+// dotfilesStaging is where dotfiles are copied to in the container, before
+// they're copied into the home directory of the environment's user. Docker can
+// only copy files in as root, and doesn't know where that home directory is.
+const dotfilesStaging = "/tmp/envctl-dotfiles"
+
+// installDotfiles copies the dotfiles from the user config into the home
+// directory of the environment's user, and runs their install command.
+// Dotfiles are personal, so the environment is fine without them: anything
+// that goes wrong is only a warning.
+func installDotfiles(ctl container.Controller, m container.Metadata) {
+	ucfg, err := loadUserConfig()
+	if err != nil {
+		fmt.Printf("Warning: not installing dotfiles: %v\n", err)
+		return
+	}
+
+	if ucfg.Dotfiles.Path == "" {
+		return
+	}
+
+	fmt.Println("installing dotfiles...")
+
+	if err := copyDotfiles(ctl, m, ucfg.Dotfiles); err != nil {
+		fmt.Printf("Warning: not installing dotfiles: %v\n", err)
+	}
+}
+
+func copyDotfiles(ctl container.Controller, m container.Metadata, d config.Dotfiles) error {
+	dir, err := dotfilesDir(d.Path)
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	if err := archive.Dir(buf, dir, path.Base(dotfilesStaging), ".git"); err != nil {
+		return fmt.Errorf("reading %v: %v", dir, err)
+	}
+
+	if err := ctl.CopyTo(m, path.Dir(dotfilesStaging), buf); err != nil {
+		return fmt.Errorf("copying dotfiles: %v", err)
+	}
+
+	// The files are copied in as root, so they're handed over to the user
+	// first, or they couldn't read the private ones.
+	if m.User != "" && m.User != "root" {
+		owner := m.User
+		if !strings.Contains(owner, ":") {
+			owner = fmt.Sprintf(`"$(id -u %v)":"$(id -g %v)"`, owner, owner)
+		}
+
+		asRoot := m
+		asRoot.User = "root"
+
+		err := runScript(ctl, asRoot, []string{
+			fmt.Sprintf("chown -R %v %v", owner, dotfilesStaging),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cmds := []string{
+		fmt.Sprintf(`cp -Rp %v/. "$HOME"/`, dotfilesStaging),
+		fmt.Sprintf("rm -rf %v", dotfilesStaging),
+	}
+
+	if d.Install != "" {
+		cmds = append(cmds, `cd "$HOME"`, d.Install)
+	}
+
+	return runScript(ctl, m, cmds)
+}
+
+// dotfilesDir returns the directory on the host the dotfiles at `p` are in.
+// Git repos are cloned to the cache directory the first time, and pulled
+// every time after that. Each repo gets a clone of its own, so changing repos
+// never pulls from the wrong one.
+func dotfilesDir(p string) (string, error) {
+	if !isGitURL(p) {
+		if strings.HasPrefix(p, "~/") {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", err
+			}
+
+			p = filepath.Join(home, p[2:])
+		}
+
+		info, err := os.Stat(p)
+		if err != nil {
+			return "", err
+		}
+
+		if !info.IsDir() {
+			return "", fmt.Errorf("%v isn't a directory", p)
+		}
+
+		return p, nil
+	}
+
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(p))
+	dir := filepath.Join(cache, "envctl", "dotfiles", hex.EncodeToString(sum[:8]))
+
+	var cmd *exec.Cmd
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		cmd = exec.Command("git", "-C", dir, "pull", "--ff-only", "--quiet")
+	} else {
+		if err := os.RemoveAll(dir); err != nil {
+			return "", err
+		}
+
+		cmd = exec.Command("git", "clone", "--depth", "1", "--quiet", p, dir)
+	}
+
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("fetching %v: %v", p, strings.TrimSpace(stderr.String()))
+	}
+
+	return dir, nil
+}
+
+// isGitURL returns whether `p` points at a git repo rather than a directory.
+func isGitURL(p string) bool {
+	return strings.Contains(p, "://") || strings.HasPrefix(p, "git@") ||
+		strings.HasSuffix(p, ".git")
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/winiceo/genv/internal/config"
+	"github.com/winiceo/genv/pkg/container"
+	"github.com/winiceo/genv/test_pkg"
+)
+
+func TestInstallDotfiles(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	dir, err := ioutil.TempDir("", "envctl-dotfiles")
+	if err != nil {
+		t.Fatal("creating temp dir", nil, err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, ".bashrc"), []byte("alias ll='ls -l'\n"), 0644); err != nil {
+		t.Fatal("writing dotfile", nil, err)
+	}
+
+	defer func(f func() (config.UserConfig, error)) { loadUserConfig = f }(loadUserConfig)
+	loadUserConfig = func() (config.UserConfig, error) {
+		return config.UserConfig{
+			Dotfiles: config.Dotfiles{Path: dir, Install: "./install.sh"},
+		}, nil
+	}
+
+	ctl := newMockCtl(nil)
+
+	copied := []string{}
+	ctl.copyToFn = func(m container.Metadata, dst string, content io.Reader) error {
+		tr := tar.NewReader(content)
+		for {
+			hdr, err := tr.Next()
+			if err != nil {
+				return nil
+			}
+
+			copied = append(copied, filepath.Join(dst, hdr.Name))
+		}
+	}
+
+	scripts := []string{}
+	ctl.runFn = func(m container.Metadata, cmds []string) error {
+		scripts = append(scripts, m.User+": "+strings.TrimSpace(cmds[2]))
+		return nil
+	}
+
+	m := container.Metadata{User: "alice", Shell: "/bin/sh"}
+
+	outch, errch := test_pkg.HijackStdout(func() {
+		installDotfiles(ctl, m)
+	})
+
+	select {
+	case err := <-errch:
+		t.Fatal("hijacking output", nil, err)
+	case actual := <-outch:
+		if string(actual) != "installing dotfiles...\n" {
+			t.Fatal("output", "installing dotfiles...\n", string(actual))
+		}
+	}
+
+	expectedCopied := "/tmp/envctl-dotfiles\n/tmp/envctl-dotfiles/.bashrc"
+	if expectedCopied != strings.Join(copied, "\n") {
+		t.Fatal("copied files", expectedCopied, strings.Join(copied, "\n"))
+	}
+
+	expectedScripts := strings.Join([]string{
+		`root: chown -R "$(id -u alice)":"$(id -g alice)" /tmp/envctl-dotfiles`,
+		`alice: cp -Rp /tmp/envctl-dotfiles/. "$HOME"/` + "\n" +
+			"rm -rf /tmp/envctl-dotfiles\n" +
+			`cd "$HOME"` + "\n" +
+			"./install.sh",
+	}, "\n")
+
+	if expectedScripts != strings.Join(scripts, "\n") {
+		t.Fatal("scripts", expectedScripts, strings.Join(scripts, "\n"))
+	}
+}
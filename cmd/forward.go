@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/winiceo/genv/internal/config"
+	"github.com/winiceo/genv/internal/db"
+	"github.com/winiceo/genv/pkg/container"
+)
+
+// Where forwarded things end up in the container. The git config is mounted as
+// the system config, which git reads for every user, wherever their home
+// directory is. gpg can't be told where the agent's socket is, only where its
+// home directory is, so the socket goes into a home directory of its own.
+const (
+	sshAgentSocket = "/run/envctl/ssh-agent.sock"
+	gitConfigFile  = "/etc/gitconfig"
+	gpgHome        = "/run/envctl/gnupg"
+)
+
+// dockerDesktopSSHSocket is where Docker Desktop for Mac forwards the SSH agent
+// of the host to. Sockets on the host itself can't be mounted there.
+const dockerDesktopSSHSocket = "/run/host-services/ssh-auth.sock"
+
+// gpgExtraSocket returns the path of the host's gpg-agent socket meant for
+// forwarding, which doesn't give access to everything the agent can do.
+var gpgExtraSocket = func() (string, error) {
+	out, err := exec.Command("gpgconf", "--list-dirs", "agent-extra-socket").Output()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// addForwards adds what's forwarded from the host, as listed in `forward`, to
+// `m`. Anything that isn't there to forward is skipped with a warning, since
+// the environment is still usable without it.
+func addForwards(m container.Metadata, forward []string) container.Metadata {
+	for _, name := range forward {
+		var err error
+
+		switch name {
+		case config.ForwardSSHAgent:
+			m, err = forwardSSHAgent(m)
+		case config.ForwardGitConfig:
+			m, err = forwardGitConfig(m)
+		case config.ForwardGPGAgent:
+			m, err = forwardGPGAgent(m)
+		default:
+			err = fmt.Errorf("unknown forward %q", name)
+		}
+
+		if err != nil {
+			fmt.Printf("Warning: not forwarding %v: %v\n", name, err)
+		}
+	}
+
+	return m
+}
+
+func forwardSSHAgent(m container.Metadata) (container.Metadata, error) {
+	src, err := sshAgentSource()
+	if err != nil {
+		return m, err
+	}
+
+	m.Forwards = append(m.Forwards, container.Mount{
+		Source:      src,
+		Destination: sshAgentSocket,
+	})
+
+	return addForwardedVar(m, "SSH_AUTH_SOCK", sshAgentSocket), nil
+}
+
+// sshAgentSource returns the socket of the host's SSH agent, to be mounted.
+func sshAgentSource() (string, error) {
+	if runtime.GOOS == "darwin" {
+		return dockerDesktopSSHSocket, nil
+	}
+
+	src := os.Getenv("SSH_AUTH_SOCK")
+	if src == "" {
+		return "", fmt.Errorf("SSH_AUTH_SOCK isn't set, is the agent running?")
+	}
+
+	return src, checkSocket(src)
+}
+
+// sshAgentMoved returns whether the SSH agent forwarded to the container `m`
+// has moved since it was created, which it does with every login to the host
+// and every reboot. The socket is only mounted when the container is created,
+// so it has to be recreated to forward the agent again. An agent that isn't
+// running now hasn't moved, since recreating the container wouldn't help.
+func sshAgentMoved(m container.Metadata) bool {
+	for _, f := range m.Forwards {
+		if f.Destination != sshAgentSocket {
+			continue
+		}
+
+		src, err := sshAgentSource()
+		return err == nil && src != f.Source
+	}
+
+	return false
+}
+
+// msgAgentMoved is printed when the SSH agent has moved since the environment
+// was created.
+var msgAgentMoved = `Warning: the SSH agent has moved since the environment was created, so it
+isn't forwarded anymore.
+
+Run "envctl apply" to forward it again.`
+
+// warnAgentMoved prints a warning when the SSH agent forwarded to `env` has
+// moved.
+func warnAgentMoved(env db.Environment) {
+	if env.Initialized() && sshAgentMoved(env.Container) {
+		fmt.Println()
+		fmt.Println(msgAgentMoved)
+	}
+}
+
+func forwardGitConfig(m container.Metadata) (container.Metadata, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return m, err
+	}
+
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	if xdg == "" {
+		xdg = filepath.Join(home, ".config")
+	}
+
+	for _, path := range []string{
+		filepath.Join(home, ".gitconfig"),
+		filepath.Join(xdg, "git", "config"),
+	} {
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			continue
+		}
+
+		m.Forwards = append(m.Forwards, container.Mount{
+			Source:      path,
+			Destination: gitConfigFile,
+			ReadOnly:    true,
+		})
+
+		return m, nil
+	}
+
+	return m, fmt.Errorf("there's no ~/.gitconfig")
+}
+
+func forwardGPGAgent(m container.Metadata) (container.Metadata, error) {
+	src, err := gpgExtraSocket()
+	if err != nil {
+		return m, fmt.Errorf("can't find the gpg-agent socket, is gpg installed?")
+	}
+
+	if err := checkSocket(src); err != nil {
+		return m, err
+	}
+
+	m.Forwards = append(m.Forwards, container.Mount{
+		Source:      src,
+		Destination: gpgHome + "/S.gpg-agent",
+	})
+
+	// The agent has the private keys, but gpg needs the public ones too.
+	home := os.Getenv("GNUPGHOME")
+	if home == "" {
+		userHome, err := os.UserHomeDir()
+		if err != nil {
+			return m, err
+		}
+
+		home = filepath.Join(userHome, ".gnupg")
+	}
+
+	pubring := filepath.Join(home, "pubring.kbx")
+
+	if _, err := os.Stat(pubring); err == nil {
+		m.Forwards = append(m.Forwards, container.Mount{
+			Source:      pubring,
+			Destination: gpgHome + "/pubring.kbx",
+			ReadOnly:    true,
+		})
+	}
+
+	return addForwardedVar(m, "GNUPGHOME", gpgHome), nil
+}
+
+// checkSocket checks that there's a socket at `path`.
+func checkSocket(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("%v doesn't exist, is the agent running?", path)
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%v isn't a socket", path)
+	}
+
+	return nil
+}
+
+// addForwardedVar sets the variable `name` in `m`, unless the config sets it
+// already.
+func addForwardedVar(m container.Metadata, name, value string) container.Metadata {
+	for _, v := range m.Variables {
+		if v.Name == name {
+			return m
+		}
+	}
+
+	m.Envs = append(m.Envs, name+"="+value)
+	m.Variables = append(m.Variables, container.Variable{Name: name, Source: "forward"})
+
+	return m
+}
@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/winiceo/genv/internal/config"
+	"github.com/winiceo/genv/pkg/container"
+	"github.com/winiceo/genv/test_pkg"
+)
+
+func TestAddForwards(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	dir, err := ioutil.TempDir("", "envctl-forward")
+	if err != nil {
+		t.Fatal("creating temp dir", nil, err)
+	}
+	defer os.RemoveAll(dir)
+
+	sock := filepath.Join(dir, "agent.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal("listening", nil, err)
+	}
+	defer l.Close()
+
+	gitconfig := filepath.Join(dir, ".gitconfig")
+	if err := ioutil.WriteFile(gitconfig, []byte("[user]\n"), 0644); err != nil {
+		t.Fatal("writing .gitconfig", nil, err)
+	}
+
+	for k, v := range map[string]string{"SSH_AUTH_SOCK": sock, "HOME": dir} {
+		defer os.Setenv(k, os.Getenv(k))
+		os.Setenv(k, v)
+	}
+
+	defer func(f func() (string, error)) { gpgExtraSocket = f }(gpgExtraSocket)
+	gpgExtraSocket = func() (string, error) {
+		return "", errors.New("gpgconf: not found")
+	}
+
+	var m container.Metadata
+
+	outch, errch := test_pkg.HijackStdout(func() {
+		m = addForwards(container.Metadata{}, []string{
+			config.ForwardSSHAgent,
+			config.ForwardGitConfig,
+			config.ForwardGPGAgent,
+		})
+	})
+
+	expectedOut := "Warning: not forwarding gpg_agent: " +
+		"can't find the gpg-agent socket, is gpg installed?\n"
+
+	select {
+	case err := <-errch:
+		t.Fatal("hijacking output", nil, err)
+	case actual := <-outch:
+		if expectedOut != string(actual) {
+			t.Fatal("output", expectedOut, string(actual))
+		}
+	}
+
+	expected := container.Metadata{
+		Forwards: []container.Mount{
+			{Source: sock, Destination: "/run/envctl/ssh-agent.sock"},
+			{Source: gitconfig, Destination: "/etc/gitconfig", ReadOnly: true},
+		},
+		Envs: []string{"SSH_AUTH_SOCK=/run/envctl/ssh-agent.sock"},
+		Variables: []container.Variable{
+			{Name: "SSH_AUTH_SOCK", Source: "forward"},
+		},
+	}
+
+	if !reflect.DeepEqual(expected, m) {
+		t.Fatal("forwards", expected, m)
+	}
+}
+
+func TestAddForwardsMissing(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	dir, err := ioutil.TempDir("", "envctl-forward")
+	if err != nil {
+		t.Fatal("creating temp dir", nil, err)
+	}
+	defer os.RemoveAll(dir)
+
+	for k, v := range map[string]string{"SSH_AUTH_SOCK": "", "HOME": dir, "XDG_CONFIG_HOME": ""} {
+		defer os.Setenv(k, os.Getenv(k))
+		os.Setenv(k, v)
+	}
+
+	var m container.Metadata
+
+	outch, errch := test_pkg.HijackStdout(func() {
+		m = addForwards(container.Metadata{}, []string{
+			config.ForwardSSHAgent,
+			config.ForwardGitConfig,
+		})
+	})
+
+	expectedOut := `Warning: not forwarding ssh_agent: SSH_AUTH_SOCK isn't set, is the agent running?
+Warning: not forwarding git_config: there's no ~/.gitconfig
+`
+
+	select {
+	case err := <-errch:
+		t.Fatal("hijacking output", nil, err)
+	case actual := <-outch:
+		if expectedOut != string(actual) {
+			t.Fatal("output", expectedOut, string(actual))
+		}
+	}
+
+	if len(m.Forwards) != 0 || len(m.Envs) != 0 {
+		t.Fatal("forwards", container.Metadata{}, m)
+	}
+}
+
+func TestSSHAgentMoved(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	dir, err := ioutil.TempDir("", "envctl-forward")
+	if err != nil {
+		t.Fatal("creating temp dir", nil, err)
+	}
+	defer os.RemoveAll(dir)
+
+	sock := filepath.Join(dir, "agent.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal("listening", nil, err)
+	}
+	defer l.Close()
+
+	defer os.Setenv("SSH_AUTH_SOCK", os.Getenv("SSH_AUTH_SOCK"))
+	os.Setenv("SSH_AUTH_SOCK", sock)
+
+	forwarded := func(src string) container.Metadata {
+		return container.Metadata{
+			Forwards: []container.Mount{{Source: src, Destination: sshAgentSocket}},
+		}
+	}
+
+	if sshAgentMoved(forwarded(sock)) {
+		t.Fatal("agent forwarded from where it is", false, true)
+	}
+
+	if !sshAgentMoved(forwarded("/tmp/ssh-gone/agent.1")) {
+		t.Fatal("agent forwarded from where it was", true, false)
+	}
+
+	if sshAgentMoved(container.Metadata{}) {
+		t.Fatal("agent that isn't forwarded", false, true)
+	}
+
+	// Without an agent now, there's nothing to forward instead.
+	os.Setenv("SSH_AUTH_SOCK", "")
+	if sshAgentMoved(forwarded("/tmp/ssh-gone/agent.1")) {
+		t.Fatal("agent that isn't running", false, true)
+	}
+}
+
+func TestApplyFollowsSSHAgent(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	dir, err := ioutil.TempDir("", "envctl-forward")
+	if err != nil {
+		t.Fatal("creating temp dir", nil, err)
+	}
+	defer os.RemoveAll(dir)
+
+	sock := filepath.Join(dir, "agent.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal("listening", nil, err)
+	}
+	defer l.Close()
+
+	defer os.Setenv("SSH_AUTH_SOCK", os.Getenv("SSH_AUTH_SOCK"))
+	os.Setenv("SSH_AUTH_SOCK", sock)
+
+	opts := config.Opts{
+		Image:   "test",
+		Shell:   "/foo/sh",
+		Mount:   "/foo/mnt",
+		Forward: []string{config.ForwardSSHAgent},
+	}
+
+	s, ctl := newAppliedEnv(t, opts)
+	s.env.Container.Forwards = []container.Mount{
+		{Source: "/tmp/ssh-gone/agent.1", Destination: sshAgentSocket},
+	}
+
+	if err := applyQuietly(t, ctl, s, opts); err != nil {
+		t.Fatal("applying", nil, err)
+	}
+
+	expected := []container.Mount{{Source: sock, Destination: sshAgentSocket}}
+	if !reflect.DeepEqual(expected, s.env.Container.Forwards) {
+		t.Fatal("forwards", expected, s.env.Container.Forwards)
+	}
+}
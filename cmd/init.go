@@ -2,8 +2,12 @@ package cmd
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/winiceo/genv/internal/config"
 	"github.com/spf13/cobra"
 )
 
@@ -15,16 +19,19 @@ func newInitCmd() *cobra.Command {
 "init" will generate a file called "envctl.yaml".
 
 This file has sane defaults, but might need to be edited, and should be checked
-into version control.
+into version control. The state directory and the local config overlay
+shouldn't be, so they're added to ".gitignore".
 `
 
 	tpl := `---
+version: 2
+
 image: ubuntu:latest
 
 shell: /bin/bash
 
 bootstrap:
-- echo 'Environment initialized' > /envctl
+- run: echo 'Environment initialized' > /envctl
 
 variables:
   FOO: bar
@@ -49,6 +56,13 @@ variables:
 			fmt.Printf("error writing %v: %v\n", cfgFile, err)
 			os.Exit(1)
 		}
+
+		dir := filepath.Dir(cfgFile)
+		err = ignorePaths(filepath.Join(dir, ".gitignore"), ignoredPaths(dir))
+		if err != nil {
+			fmt.Printf("error updating .gitignore: %v\n", err)
+			os.Exit(1)
+		}
 	}
 
 	return &cobra.Command{
@@ -58,3 +72,67 @@ variables:
 		Run:   runInit,
 	}
 }
+
+// ignoredPaths returns the paths under `dir` that envctl writes to but that
+// shouldn't be checked into version control, as .gitignore patterns.
+func ignoredPaths(dir string) []string {
+	state := ".envctl"
+	if stateDir != "" {
+		rel, err := filepath.Rel(dir, stateDir)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			// A state directory outside the repo can't be committed anyway.
+			state = ""
+		} else {
+			state = filepath.ToSlash(rel)
+		}
+	}
+
+	paths := []string{filepath.Base(config.LocalPath(cfgFile))}
+	if state != "" {
+		paths = append([]string{"/" + state + "/"}, paths...)
+	}
+
+	return paths
+}
+
+// ignorePaths adds each of `patterns` to the .gitignore file at `path`, unless
+// it's already there.
+func ignorePaths(path string, patterns []string) error {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// "/.envctl/", ".envctl/" and ".envctl" all ignore the state directory,
+	// so they're all treated as the same pattern.
+	existing := map[string]bool{}
+	for _, line := range strings.Split(string(raw), "\n") {
+		existing[strings.Trim(strings.TrimSpace(line), "/")] = true
+	}
+
+	add := &strings.Builder{}
+	for _, pattern := range patterns {
+		if !existing[strings.Trim(pattern, "/")] {
+			add.WriteString(pattern + "\n")
+		}
+	}
+
+	if add.Len() == 0 {
+		return nil
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if len(raw) > 0 && raw[len(raw)-1] != '\n' {
+		if _, err := f.WriteString("\n"); err != nil {
+			return err
+		}
+	}
+
+	_, err = f.WriteString(add.String())
+	return err
+}
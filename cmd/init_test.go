@@ -3,6 +3,7 @@ package cmd
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/winiceo/genv/test_pkg"
@@ -11,17 +12,22 @@ import (
 func TestInit(got *testing.T) {
 	t := test_pkg.NewT(got)
 
+	dir, err := ioutil.TempDir("", "envctl-init")
+	if err != nil {
+		t.Fatal("creating temp dir", nil, err)
+	}
+	defer os.RemoveAll(dir)
+
+	gitignore := filepath.Join(dir, ".gitignore")
+	err = ioutil.WriteFile(gitignore, []byte("/vendor/\n.envctl"), 0644)
+	if err != nil {
+		t.Fatal("writing .gitignore", nil, err)
+	}
+
 	// This needs to be set in order for the init command to work. Normally it's
 	// set by Cobra when the command is initialized.
-	cfgFile = "envctl.yaml.test"
-	defer func() {
-		// This is a failure because the tests need to reset the state of the repo
-		// back to how it was. Other tests rely on the repo being in a clean state.
-		err := os.Remove(cfgFile)
-		if err != nil {
-			t.Fatal("error removing generated file", nil, err)
-		}
-	}()
+	cfgFile = filepath.Join(dir, "envctl.yaml")
+	defer func() { cfgFile = "" }()
 
 	cmd := newInitCmd()
 
@@ -48,12 +54,14 @@ func TestInit(got *testing.T) {
 	}
 
 	expected := `---
+version: 2
+
 image: ubuntu:latest
 
 shell: /bin/bash
 
 bootstrap:
-- echo 'Environment initialized' > /envctl
+- run: echo 'Environment initialized' > /envctl
 
 variables:
   FOO: bar
@@ -64,4 +72,14 @@ variables:
 	if expected != actual {
 		t.Fatal("file contents", expected, actual)
 	}
+
+	raw, err = ioutil.ReadFile(gitignore)
+	if err != nil {
+		t.Fatal("reading .gitignore", nil, err)
+	}
+
+	expected = "/vendor/\n.envctl\nenvctl.local.yaml\n"
+	if expected != string(raw) {
+		t.Fatal(".gitignore contents", expected, string(raw))
+	}
 }
@@ -4,24 +4,53 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/winiceo/genv/internal/asciicast"
+	"github.com/winiceo/genv/internal/config"
 	"github.com/winiceo/genv/internal/db"
 	"github.com/winiceo/genv/pkg/container"
 	"github.com/spf13/cobra"
 )
 
-func newLoginCmd(ctl container.Controller, s db.Store) *cobra.Command {
+func newLoginCmd(
+	ctl container.Controller,
+	s db.Store,
+	l config.Loader,
+) *cobra.Command {
 	loginDesc := "log in to the current environment"
 
 	loginLongDesc := `login - Log in to the current environment
 
 "login" will log in to the current environment using the shell specified in
-the config file.`
+the config file. Every login starts a shell of its own, so you can log in from
+as many terminals as you like, and leaving one doesn't affect the others.
+
+When the environment has tmux, every login is a session that can be detached
+from with the detach keys, ctrl-p followed by ctrl-q unless --detach-keys or
+the user config says otherwise. The session keeps running, and "envctl attach"
+attaches to it again. Without tmux, detaching ends the login.
+
+When envctl doesn't run in a terminal, e.g. in CI, the shell reads commands from
+stdin instead, like in "echo make test | envctl login", and login fails when the
+shell does. Use --tty or --no-tty to decide for yourself.
+
+--record records the session to a file in the asciicast format, which
+"envctl replay" and asciinema can play back.`
 
 	msgEnvOff := `Wait! The environment isn't ready yet!
 
 To get it ready, run "envctl create".
 `
 
+	msgNoContainer := `The environment doesn't have a container, since applying the config failed.
+
+Run "envctl apply" to try again.
+`
+
+	var (
+		keys   string
+		record string
+	)
+
 	runLogin := func(cmd *cobra.Command, args []string) {
 		env, err := s.Read()
 		if err != nil {
@@ -34,16 +63,67 @@ To get it ready, run "envctl create".
 			os.Exit(1)
 		}
 
-		if err := ctl.Attach(env.Container); err != nil {
+		if env.Container.ID == "" {
+			fmt.Print(msgNoContainer)
+			os.Exit(1)
+		}
+
+		warnDrift(env, l)
+		warnAgentMoved(env)
+
+		opts, err := attachOptions("", keys)
+		if err != nil {
+			fmt.Printf("error: %v\n", err)
+			os.Exit(1)
+		}
+
+		var rec *asciicast.Writer
+		if record != "" {
+			f, err := os.Create(record)
+			if err != nil {
+				fmt.Printf("error creating recording: %v\n", err)
+				os.Exit(1)
+			}
+			defer f.Close()
+
+			rec = asciicast.NewWriter(f, asciicast.Header{
+				Env: map[string]string{
+					"SHELL": env.Container.Shell,
+					"TERM":  os.Getenv("TERM"),
+				},
+			})
+			opts.Record = rec
+		}
+
+		err = ctl.Attach(env.Container, opts)
+
+		if rec != nil {
+			if err := rec.Close(); err != nil {
+				fmt.Printf("Warning: the recording in %v is incomplete: %v\n", record, err)
+			}
+		}
+
+		if err != nil && !printDetached(err) {
 			fmt.Printf("error logging in to environment: %v\n", err)
 			os.Exit(1)
 		}
 	}
 
-	return &cobra.Command{
+	loginCmd := &cobra.Command{
 		Use:   "login",
 		Short: loginDesc,
 		Long:  loginLongDesc,
 		Run:   runLogin,
 	}
+
+	addDetachKeysFlag(loginCmd, &keys)
+
+	loginCmd.Flags().StringVar(
+		&record,
+		"record",
+		"",
+		"file to record the session to, in the asciicast format",
+	)
+
+	return loginCmd
 }
@@ -1,6 +1,9 @@
 package cmd
 
 import (
+	"fmt"
+	"io"
+
 	"github.com/winiceo/genv/internal/config"
 	"github.com/winiceo/genv/internal/db"
 	"github.com/winiceo/genv/pkg/container"
@@ -31,10 +34,15 @@ type mockCtl struct {
 
 	// These allow the specific tests to override the underlying behavior if
 	// necessary to test alternative code-paths.
-	createFn func(container.Metadata) (container.Metadata, error)
-	removeFn func(container.Metadata) error
-	attachFn func(container.Metadata) error
-	runFn    func(container.Metadata, []string) error
+	createFn   func(container.Metadata) (container.Metadata, error)
+	recreateFn func(container.Metadata) (container.Metadata, error)
+	removeFn   func(container.Metadata) error
+	attachFn   func(container.Metadata, container.AttachOptions) error
+	sessionsFn func(container.Metadata) ([]container.Session, error)
+	runFn      func(container.Metadata, []string) error
+	copyToFn   func(container.Metadata, string, io.Reader) error
+	copyFromFn func(container.Metadata, string) (io.ReadCloser, error)
+	statFn     func(container.Metadata, string) (container.PathStat, error)
 }
 
 func newMockCtl(init *container.Metadata) *mockCtl {
@@ -56,20 +64,42 @@ func newMockCtl(init *container.Metadata) *mockCtl {
 		return *ctl.current, nil
 	}
 
+	ctl.recreateFn = func(m container.Metadata) (container.Metadata, error) {
+		ctl.current = &m
+
+		return *ctl.current, nil
+	}
+
 	ctl.removeFn = func(m container.Metadata) error {
 		ctl.current = nil
 
 		return nil
 	}
 
-	ctl.attachFn = func(m container.Metadata) error {
+	ctl.attachFn = func(m container.Metadata, opts container.AttachOptions) error {
 		return nil
 	}
 
+	ctl.sessionsFn = func(m container.Metadata) ([]container.Session, error) {
+		return nil, nil
+	}
+
 	ctl.runFn = func(m container.Metadata, cmds []string) error {
 		return nil
 	}
 
+	ctl.copyToFn = func(m container.Metadata, dir string, content io.Reader) error {
+		return nil
+	}
+
+	ctl.copyFromFn = func(m container.Metadata, p string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("%v doesn't exist", p)
+	}
+
+	ctl.statFn = func(m container.Metadata, p string) (container.PathStat, error) {
+		return container.PathStat{}, fmt.Errorf("%v doesn't exist", p)
+	}
+
 	return ctl
 }
 
@@ -77,18 +107,38 @@ func (ctl *mockCtl) Create(m container.Metadata) (container.Metadata, error) {
 	return ctl.createFn(m)
 }
 
+func (ctl *mockCtl) Recreate(m container.Metadata) (container.Metadata, error) {
+	return ctl.recreateFn(m)
+}
+
 func (ctl *mockCtl) Remove(m container.Metadata) error {
 	return ctl.removeFn(m)
 }
 
-func (ctl *mockCtl) Attach(m container.Metadata) error {
-	return ctl.attachFn(m)
+func (ctl *mockCtl) Attach(m container.Metadata, opts container.AttachOptions) error {
+	return ctl.attachFn(m, opts)
+}
+
+func (ctl *mockCtl) Sessions(m container.Metadata) ([]container.Session, error) {
+	return ctl.sessionsFn(m)
 }
 
 func (ctl *mockCtl) Run(m container.Metadata, cmds []string) error {
 	return ctl.runFn(m, cmds)
 }
 
+func (ctl *mockCtl) CopyTo(m container.Metadata, dir string, content io.Reader) error {
+	return ctl.copyToFn(m, dir, content)
+}
+
+func (ctl *mockCtl) CopyFrom(m container.Metadata, p string) (io.ReadCloser, error) {
+	return ctl.copyFromFn(m, p)
+}
+
+func (ctl *mockCtl) Stat(m container.Metadata, p string) (container.PathStat, error) {
+	return ctl.statFn(m, p)
+}
+
 type memConfig struct {
 	opts config.Opts
 }
@@ -100,3 +150,35 @@ func (c memConfig) Load() (config.Opts, error) {
 
 	return c.opts, nil
 }
+
+// memPorts is a hostport.Checker that keeps the tests away from the ports of
+// the machine they run on. Unless it's told otherwise, every port is free, and
+// ports are allocated counting up from 49152.
+type memPorts struct {
+	used map[int]bool
+	next int
+}
+
+func init() {
+	hostPorts = &memPorts{}
+
+	// The tests shouldn't pick up the config of whoever runs them.
+	loadUserConfig = func() (config.UserConfig, error) {
+		return config.UserConfig{}, nil
+	}
+}
+
+func (p *memPorts) Free(proto, ip string, port int) bool {
+	return !p.used[port]
+}
+
+func (p *memPorts) Allocate(proto, ip string) (int, error) {
+	if p.next == 0 {
+		p.next = 49152
+	}
+
+	port := p.next
+	p.next++
+
+	return port, nil
+}
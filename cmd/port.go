@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/winiceo/genv/internal/db"
+	"github.com/winiceo/genv/internal/hostport"
+	"github.com/winiceo/genv/pkg/container"
+	"github.com/spf13/cobra"
+)
+
+// hostPorts checks the host ports environments are created with.
+var hostPorts hostport.Checker = hostport.System{}
+
+func newPortCmd(s db.Store) *cobra.Command {
+	portDesc := "print the host port a container port is mapped to"
+	portLongDesc := `port - Print the host port a container port is mapped to
+
+"port" prints the host port the environment maps the given container port to,
+which is mostly useful for ports that envctl picks itself, like "auto:3000".
+The protocol defaults to TCP, use e.g. "53/udp" for other ones.
+
+When the container port is mapped to more than one host port, each of them is
+printed on a line of its own.`
+
+	msgEnvOff := `The environment is off!
+
+To create it, run "envctl create".`
+
+	runPort := func(cmd *cobra.Command, args []string) {
+		port, proto, err := parseContainerPort(args[0])
+		if err != nil {
+			fmt.Printf("error: %v\n", err)
+			os.Exit(1)
+		}
+
+		env, err := s.Read()
+		if err != nil {
+			fmt.Printf("error reading data store: %v\n", err)
+			os.Exit(1)
+		}
+
+		if !env.Initialized() {
+			fmt.Println(msgEnvOff)
+			os.Exit(1)
+		}
+
+		found := false
+		for _, p := range env.Container.Ports {
+			if p.ContainerPort == port && p.Protocol == proto {
+				fmt.Println(p.HostPort)
+				found = true
+			}
+		}
+
+		if !found {
+			fmt.Printf("error: %v/%v isn't mapped to the host\n", port, proto)
+			os.Exit(1)
+		}
+	}
+
+	return &cobra.Command{
+		Use:   "port <container-port>[/<protocol>]",
+		Short: portDesc,
+		Long:  portLongDesc,
+		Args:  cobra.ExactArgs(1),
+		Run:   runPort,
+	}
+}
+
+// parseContainerPort parses a container port like "3000" or "53/udp".
+func parseContainerPort(s string) (int, string, error) {
+	parts := strings.SplitN(s, "/", 2)
+
+	proto := "tcp"
+	if len(parts) == 2 {
+		proto = strings.ToLower(parts[1])
+	}
+
+	port, err := strconv.Atoi(parts[0])
+	if err != nil || port < 1 || port > 65535 {
+		return 0, "", fmt.Errorf("%q isn't a container port", s)
+	}
+
+	return port, proto, nil
+}
+
+// reservePorts checks that the host ports in `ports` are free, and picks free
+// host ports for the ones that are automatic. The ports in `held` belong to
+// the environment `ports` replaces, so they count as free, and automatic ports
+// keep the host port they had there.
+func reservePorts(ports, held []container.PortMapping) ([]container.PortMapping, error) {
+	type key struct {
+		proto string
+		ip    string
+		port  int
+	}
+
+	owned := map[key]bool{}
+	previous := map[key]int{}
+	for _, p := range held {
+		owned[key{p.Protocol, p.HostIP, p.HostPort}] = true
+		if p.Auto {
+			previous[key{p.Protocol, p.HostIP, p.ContainerPort}] = p.HostPort
+		}
+	}
+
+	out := make([]container.PortMapping, len(ports))
+	copy(out, ports)
+
+	taken := map[key]bool{}
+	for _, p := range out {
+		if p.Auto {
+			continue
+		}
+
+		k := key{p.Protocol, p.HostIP, p.HostPort}
+		if taken[k] {
+			return nil, fmt.Errorf("host port %v (%v on %v) is mapped more than once",
+				p.HostPort, p.Protocol, p.HostIP)
+		}
+
+		if !owned[k] && !hostPorts.Free(p.Protocol, p.HostIP, p.HostPort) {
+			return nil, fmt.Errorf(
+				"host port %v (%v on %v) is already in use, "+
+					"map it to \"auto:%v\" to have a free one picked instead",
+				p.HostPort, p.Protocol, p.HostIP, p.ContainerPort,
+			)
+		}
+
+		taken[k] = true
+	}
+
+	for i := range out {
+		p := &out[i]
+		if !p.Auto {
+			continue
+		}
+
+		if port, ok := previous[key{p.Protocol, p.HostIP, p.ContainerPort}]; ok &&
+			!taken[key{p.Protocol, p.HostIP, port}] {
+			p.HostPort = port
+			taken[key{p.Protocol, p.HostIP, port}] = true
+			continue
+		}
+
+		// A port that was only just allocated is free again, so it can come
+		// up twice.
+		for tries := 0; p.HostPort == 0; tries++ {
+			port, err := hostPorts.Allocate(p.Protocol, p.HostIP)
+			if err != nil {
+				return nil, fmt.Errorf("picking a host port for %v/%v: %v",
+					p.ContainerPort, p.Protocol, err)
+			}
+
+			if !taken[key{p.Protocol, p.HostIP, port}] {
+				p.HostPort = port
+			} else if tries == 10 {
+				return nil, fmt.Errorf("picking a host port for %v/%v: no free ports",
+					p.ContainerPort, p.Protocol)
+			}
+		}
+
+		taken[key{p.Protocol, p.HostIP, p.HostPort}] = true
+	}
+
+	return out, nil
+}
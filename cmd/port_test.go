@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/winiceo/genv/internal/db"
+	"github.com/winiceo/genv/internal/hostport"
+	"github.com/winiceo/genv/pkg/container"
+	"github.com/winiceo/genv/test_pkg"
+)
+
+func TestPort(got *testing.T) {
+	t := test_pkg.NewT(got)
+	s := &memStore{
+		env: db.Environment{
+			Status: db.StatusReady,
+			Container: container.Metadata{
+				ID: "foo",
+				Ports: []container.PortMapping{
+					{Protocol: "tcp", HostIP: "127.0.0.1", HostPort: 49152, ContainerPort: 3000, Auto: true},
+					{Protocol: "udp", HostIP: "127.0.0.1", HostPort: 5353, ContainerPort: 3000},
+				},
+			},
+		},
+	}
+
+	cmd := newPortCmd(s)
+
+	outch, errch := test_pkg.HijackStdout(func() {
+		cmd.Run(cmd, []string{"3000"})
+	})
+
+	select {
+	case err := <-errch:
+		t.Fatal("hijacking output", nil, err)
+	case actual := <-outch:
+		if string(actual) != "49152\n" {
+			t.Fatal("output", "49152\n", string(actual))
+		}
+	}
+
+	outch, errch = test_pkg.HijackStdout(func() {
+		cmd.Run(cmd, []string{"3000/udp"})
+	})
+
+	select {
+	case err := <-errch:
+		t.Fatal("hijacking output", nil, err)
+	case actual := <-outch:
+		if string(actual) != "5353\n" {
+			t.Fatal("output", "5353\n", string(actual))
+		}
+	}
+}
+
+func TestReservePorts(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	defer func(c hostport.Checker) { hostPorts = c }(hostPorts)
+	hostPorts = &memPorts{}
+
+	ports := []container.PortMapping{
+		{Protocol: "tcp", HostIP: "127.0.0.1", HostPort: 8080, ContainerPort: 80},
+		{Protocol: "tcp", HostIP: "127.0.0.1", ContainerPort: 3000, Auto: true},
+		{Protocol: "tcp", HostIP: "127.0.0.1", ContainerPort: 3001, Auto: true},
+	}
+
+	expected := []container.PortMapping{
+		{Protocol: "tcp", HostIP: "127.0.0.1", HostPort: 8080, ContainerPort: 80},
+		{Protocol: "tcp", HostIP: "127.0.0.1", HostPort: 49152, ContainerPort: 3000, Auto: true},
+		{Protocol: "tcp", HostIP: "127.0.0.1", HostPort: 49153, ContainerPort: 3001, Auto: true},
+	}
+
+	actual, err := reservePorts(ports, nil)
+	if err != nil {
+		t.Fatal("reserving ports", nil, err)
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatal("reserving ports", expected, actual)
+	}
+
+	// The environment's own ports are in use by the environment itself, and
+	// the ports it picked are kept.
+	hostPorts = &memPorts{used: map[int]bool{8080: true, 49152: true, 49153: true}, next: 50000}
+
+	actual, err = reservePorts(ports, expected)
+	if err != nil {
+		t.Fatal("reserving held ports", nil, err)
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatal("reserving held ports", expected, actual)
+	}
+
+	_, err = reservePorts(ports, nil)
+
+	msg := `host port 8080 (tcp on 127.0.0.1) is already in use, map it to "auto:80" to have a free one picked instead`
+	if err == nil || err.Error() != msg {
+		t.Fatal("reserving used ports", msg, err)
+	}
+}
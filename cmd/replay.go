@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/winiceo/genv/internal/asciicast"
+	"github.com/spf13/cobra"
+)
+
+func newReplayCmd() *cobra.Command {
+	replayDesc := "play back a recorded session"
+	replayLongDesc := `replay - Play back a recorded session
+
+"replay" plays back a session recorded with "envctl login --record", or any
+other recording in the asciicast v2 format, in the terminal.
+
+Use --speed to play it faster or slower, e.g. 2 for twice as fast, and
+--max-idle to cut long pauses short.`
+
+	var (
+		speed   float64
+		maxIdle time.Duration
+	)
+
+	runReplay := func(cmd *cobra.Command, args []string) {
+		f, err := os.Open(args[0])
+		if err != nil {
+			fmt.Printf("error opening recording: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+
+		if err := asciicast.Play(os.Stdout, f, speed, maxIdle); err != nil {
+			fmt.Printf("error playing back %v: %v\n", args[0], err)
+			os.Exit(1)
+		}
+	}
+
+	replayCmd := &cobra.Command{
+		Use:   "replay <recording>",
+		Short: replayDesc,
+		Long:  replayLongDesc,
+		Args:  cobra.ExactArgs(1),
+		Run:   runReplay,
+	}
+
+	replayCmd.Flags().Float64Var(
+		&speed,
+		"speed",
+		1,
+		"how many times as fast as it was recorded to play the session back",
+	)
+
+	replayCmd.Flags().DurationVar(
+		&maxIdle,
+		"max-idle",
+		0,
+		"longest pause to play back, like 2s (default is to keep every pause as it was)",
+	)
+
+	return replayCmd
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/winiceo/genv/test_pkg"
+)
+
+func TestReplay(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	dir, err := ioutil.TempDir("", "envctl-replay")
+	if err != nil {
+		t.Fatal("creating temp dir", nil, err)
+	}
+	defer os.RemoveAll(dir)
+
+	recording := filepath.Join(dir, "session.cast")
+	err = ioutil.WriteFile(recording, []byte(`{"version": 2, "width": 80, "height": 24}
+[0.01, "o", "$ make\r\n"]
+[0.02, "o", "done\r\n"]
+`), 0644)
+	if err != nil {
+		t.Fatal("writing recording", nil, err)
+	}
+
+	cmd := newReplayCmd()
+	if err := cmd.Flags().Set("speed", "10"); err != nil {
+		t.Fatal("setting speed", nil, err)
+	}
+
+	outch, errch := test_pkg.HijackStdout(func() {
+		cmd.Run(cmd, []string{recording})
+	})
+
+	expected := "$ make\r\ndone\r\n"
+
+	select {
+	case err := <-errch:
+		t.Fatal("hijacking output", nil, err)
+	case actual := <-outch:
+		if expected != string(actual) {
+			t.Fatal("output", expected, string(actual))
+		}
+	}
+}
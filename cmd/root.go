@@ -2,7 +2,9 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 
 	"github.com/winiceo/genv/internal/config"
 	"github.com/winiceo/genv/internal/db"
@@ -11,7 +13,25 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var cfgFile = "envctl.yaml"
+// cfgFile is the project's config file. The directory it's in is the project
+// root, which is what gets mounted into the environment. Unless they're set
+// explicitly, both of these and the state directory are resolved by
+// resolveProject once the command line has been parsed.
+var (
+	cfgFile    string
+	projectDir string
+	stateDir   string
+)
+
+// profile is the profile selected in the config file, if any.
+var profile string
+
+// forceTTY and noTTY override whether commands run in the environment get a
+// TTY, which they otherwise do when envctl runs in a terminal.
+var (
+	forceTTY bool
+	noTTY    bool
+)
 
 var rootDesc = "Control your development environments"
 
@@ -23,6 +43,15 @@ ways to skin this cat.
 
 envctl is a tool for easily controlling these environments. The only thing it
 needs is a configuration file, "envctl.yaml", for it to know what to do.
+
+Like git, envctl can be run from anywhere inside a project. It looks for
+"envctl.yaml" in the current directory and then in each of its parents. The
+config can also be written in TOML, JSON or HCL, as "envctl.toml",
+"envctl.json" or "envctl.hcl". Use --config, or set ENVCTL_CONFIG, to point it
+at a config file directly.
+
+Select one of the profiles in the config file with --profile, or by setting
+ENVCTL_PROFILE.
 `
 
 // rootCmd represents the base command when called without any subcommands
@@ -48,41 +77,317 @@ func Execute() {
 }
 
 func init() {
+	cobra.OnInitialize(resolveProject)
+
+	rootCmd.PersistentFlags().StringVar(
+		&cfgFile,
+		"config",
+		"",
+		"config file to use (default is envctl.yaml in the project, $ENVCTL_CONFIG)",
+	)
+
+	rootCmd.PersistentFlags().StringVar(
+		&stateDir,
+		"state-dir",
+		"",
+		"directory the environment's state is kept in (default is .envctl/ in the project root)",
+	)
+
+	rootCmd.PersistentFlags().StringVar(
+		&profile,
+		"profile",
+		"",
+		"profile to select from the config file ($ENVCTL_PROFILE)",
+	)
+
+	rootCmd.PersistentFlags().BoolVar(
+		&forceTTY,
+		"tty",
+		false,
+		"give commands run in the environment a TTY, even when envctl doesn't run in a terminal",
+	)
+
+	rootCmd.PersistentFlags().BoolVar(
+		&noTTY,
+		"no-tty",
+		false,
+		"don't give commands run in the environment a TTY, even when envctl runs in a terminal",
+	)
+
 	ctl := initCtl()
 	s := initStore()
 	l := initConfig()
 
 	rootCmd.AddCommand(newCreateCmd(ctl, s, l))
 	rootCmd.AddCommand(newDestroyCmd(ctl, s))
-	rootCmd.AddCommand(newStatusCmd(s))
+	rootCmd.AddCommand(newStatusCmd(s, l))
 	rootCmd.AddCommand(newInitCmd())
-	rootCmd.AddCommand(newLoginCmd(ctl, s))
+	rootCmd.AddCommand(newLoginCmd(ctl, s, l))
+	rootCmd.AddCommand(newAttachCmd(ctl, s))
+	rootCmd.AddCommand(newSessionsCmd(ctl, s))
+	rootCmd.AddCommand(newReplayCmd())
+	rootCmd.AddCommand(newApplyCmd(ctl, s, l))
+	rootCmd.AddCommand(newPortCmd(s))
+	rootCmd.AddCommand(newCpCmd(ctl, s))
+	rootCmd.AddCommand(newWatchCmd(ctl, s, l))
+	rootCmd.AddCommand(newConfigCmd())
+	rootCmd.AddCommand(newValidateCmd())
 	rootCmd.AddCommand(newVersionCmd())
 }
 
-// initConfig reads in config file and ENV variables if set.
+// resolveProject finds the config file, and from it the project root and the
+// state directory. It also picks up the profile from the environment. When
+// there's no config file to be found, the current directory is used as the
+// project root, which is where "envctl init" will create it.
+func resolveProject() {
+	if profile == "" {
+		profile = os.Getenv("ENVCTL_PROFILE")
+	}
+
+	if cfgFile == "" {
+		cfgFile = os.Getenv("ENVCTL_CONFIG")
+	}
+
+	if cfgFile == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			fmt.Printf("error getting current working directory: %v\n", err)
+			os.Exit(1)
+		}
+
+		cfgFile, err = config.Discover(wd)
+		if err == config.ErrNotFound {
+			cfgFile = filepath.Join(wd, config.Filename)
+		} else if err != nil {
+			fmt.Printf("error looking for config file: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var err error
+	cfgFile, err = filepath.Abs(cfgFile)
+	if err != nil {
+		fmt.Printf("error resolving config file path: %v\n", err)
+		os.Exit(1)
+	}
+
+	projectDir = filepath.Dir(cfgFile)
+
+	if stateDir == "" {
+		stateDir = filepath.Join(projectDir, ".envctl")
+	}
+
+	stateDir, err = filepath.Abs(stateDir)
+	if err != nil {
+		fmt.Printf("error resolving state directory path: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// initConfig returns a Loader for the project's config file. The commands are
+// set up before the command line is parsed, so the file is only looked up when
+// it's loaded.
 func initConfig() config.Loader {
-	return config.YAML{Path: cfgFile}
+	return projectConfig{}
+}
+
+type projectConfig struct{}
+
+// Load loads the project's config, with the defaults from the user config
+// filled in.
+func (projectConfig) Load() (config.Opts, error) {
+	l, err := config.NewLoader(cfgFile, profile)
+	if err != nil {
+		return config.Opts{}, err
+	}
+
+	cfg, err := l.Load()
+	if err != nil {
+		return config.Opts{}, err
+	}
+
+	ucfg, err := loadUserConfig()
+	if err != nil {
+		return config.Opts{}, err
+	}
+
+	return cfg.WithUserConfig(ucfg), nil
 }
 
+// initStore returns a Store kept in the project's state directory. Like the
+// config file, the directory is only known once a command is running.
 func initStore() db.Store {
+	return &projectStore{}
+}
+
+type projectStore struct {
+	store *db.JSONStore
+}
+
+func (ps *projectStore) open() (*db.JSONStore, error) {
+	if ps.store != nil {
+		return ps.store, nil
+	}
+
 	var err error
-	jsonStore, err := db.NewJSONStore(".envctl/")
+	ps.store, err = db.NewJSONStore(stateDir)
+	return ps.store, err
+}
+
+func (ps *projectStore) Create(e db.Environment) error {
+	js, err := ps.open()
 	if err != nil {
-		fmt.Printf("error creating environment store: %v\n", err)
-		os.Exit(1)
+		return err
 	}
 
-	return jsonStore
+	return js.Create(e)
 }
 
+func (ps *projectStore) Read() (db.Environment, error) {
+	js, err := ps.open()
+	if err != nil {
+		return db.Environment{}, err
+	}
+
+	return js.Read()
+}
+
+func (ps *projectStore) Delete() error {
+	js, err := ps.open()
+	if err != nil {
+		return err
+	}
+
+	return js.Delete()
+}
+
+// initCtl returns a Controller for Docker. The Docker host can come from the
+// user config, which can't be read until a command is running, so the real
+// controller is only created once it's used.
 func initCtl() container.Controller {
-	var err error
+	return &lazyCtl{}
+}
+
+type lazyCtl struct {
+	ctl container.Controller
+	err error
+}
+
+func (lc *lazyCtl) get() (container.Controller, error) {
+	if lc.ctl != nil || lc.err != nil {
+		return lc.ctl, lc.err
+	}
+
+	// DOCKER_HOST takes precedence over the user config, like it does for
+	// the docker CLI.
+	if os.Getenv("DOCKER_HOST") == "" {
+		ucfg, err := loadUserConfig()
+		if err != nil {
+			lc.err = err
+			return nil, err
+		}
+
+		if ucfg.DockerHost != "" {
+			os.Setenv("DOCKER_HOST", ucfg.DockerHost)
+		}
+	}
+
+	if forceTTY && noTTY {
+		lc.err = fmt.Errorf("--tty and --no-tty can't be used together")
+		return nil, lc.err
+	}
+
 	ctl, err := docker.NewController()
 	if err != nil {
-		fmt.Printf("error creating Docker controller: %v\n", err)
-		os.Exit(1)
+		lc.err = fmt.Errorf("creating Docker controller: %v", err)
+		return nil, lc.err
+	}
+
+	if forceTTY || noTTY {
+		ctl.SetTTY(forceTTY)
+	}
+
+	lc.ctl = ctl
+	return ctl, nil
+}
+
+func (lc *lazyCtl) Create(m container.Metadata) (container.Metadata, error) {
+	ctl, err := lc.get()
+	if err != nil {
+		return container.Metadata{}, err
+	}
+
+	return ctl.Create(m)
+}
+
+func (lc *lazyCtl) Recreate(m container.Metadata) (container.Metadata, error) {
+	ctl, err := lc.get()
+	if err != nil {
+		return container.Metadata{}, err
+	}
+
+	return ctl.Recreate(m)
+}
+
+func (lc *lazyCtl) Remove(m container.Metadata) error {
+	ctl, err := lc.get()
+	if err != nil {
+		return err
+	}
+
+	return ctl.Remove(m)
+}
+
+func (lc *lazyCtl) Attach(m container.Metadata, opts container.AttachOptions) error {
+	ctl, err := lc.get()
+	if err != nil {
+		return err
+	}
+
+	return ctl.Attach(m, opts)
+}
+
+func (lc *lazyCtl) Sessions(m container.Metadata) ([]container.Session, error) {
+	ctl, err := lc.get()
+	if err != nil {
+		return nil, err
+	}
+
+	return ctl.Sessions(m)
+}
+
+func (lc *lazyCtl) Run(m container.Metadata, cmd []string) error {
+	ctl, err := lc.get()
+	if err != nil {
+		return err
+	}
+
+	return ctl.Run(m, cmd)
+}
+
+func (lc *lazyCtl) CopyTo(m container.Metadata, dir string, content io.Reader) error {
+	ctl, err := lc.get()
+	if err != nil {
+		return err
+	}
+
+	return ctl.CopyTo(m, dir, content)
+}
+
+func (lc *lazyCtl) CopyFrom(m container.Metadata, p string) (io.ReadCloser, error) {
+	ctl, err := lc.get()
+	if err != nil {
+		return nil, err
+	}
+
+	return ctl.CopyFrom(m, p)
+}
+
+func (lc *lazyCtl) Stat(m container.Metadata, p string) (container.PathStat, error) {
+	ctl, err := lc.get()
+	if err != nil {
+		return container.PathStat{}, err
 	}
 
-	return ctl
+	return ctl.Stat(m, p)
 }
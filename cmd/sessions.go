@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/winiceo/genv/internal/db"
+	"github.com/winiceo/genv/pkg/container"
+	"github.com/spf13/cobra"
+)
+
+func newSessionsCmd(ctl container.Controller, s db.Store) *cobra.Command {
+	sessionsDesc := "list the login sessions in the environment"
+	sessionsLongDesc := `sessions - List the login sessions in the environment
+
+"sessions" lists the login sessions running in the environment, and whether
+they're attached to. Detached ones can be attached to again with
+"envctl attach <session>".
+
+Sessions need tmux in the environment. Without it, logins still work, but
+there's nothing to list.`
+
+	msgEnvOff := `The environment is off!
+
+To create it, run "envctl create".`
+
+	msgNoSessions := `There aren't any sessions.
+
+Run "envctl login" to start one.`
+
+	msgNoTmux := `There aren't any sessions, since the environment doesn't have tmux.
+
+Install it in a bootstrap step to keep logins running when you detach from them.`
+
+	runSessions := func(cmd *cobra.Command, args []string) {
+		env, err := s.Read()
+		if err != nil {
+			fmt.Printf("error reading data store: %v\n", err)
+			os.Exit(1)
+		}
+
+		if !env.Initialized() {
+			fmt.Println(msgEnvOff)
+			os.Exit(1)
+		}
+
+		sessions, err := ctl.Sessions(env.Container)
+		if err == container.ErrNoSessions {
+			fmt.Println(msgNoTmux)
+			return
+		} else if err != nil {
+			fmt.Printf("error listing sessions: %v\n", err)
+			os.Exit(1)
+		}
+
+		if len(sessions) == 0 {
+			fmt.Println(msgNoSessions)
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "SESSION\tSTATUS\tSTARTED")
+
+		for _, s := range sessions {
+			status := "detached"
+			if s.Attached {
+				status = "attached"
+			}
+
+			fmt.Fprintf(w, "%v\t%v\t%v\n", s.Name, status, s.Created.Format("2006-01-02 15:04:05"))
+		}
+
+		w.Flush()
+	}
+
+	return &cobra.Command{
+		Use:   "sessions",
+		Short: sessionsDesc,
+		Long:  sessionsLongDesc,
+		Args:  cobra.NoArgs,
+		Run:   runSessions,
+	}
+}
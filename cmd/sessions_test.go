@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/winiceo/genv/internal/db"
+	"github.com/winiceo/genv/pkg/container"
+	"github.com/winiceo/genv/test_pkg"
+)
+
+func TestSessions(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	started := time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local)
+
+	s := &memStore{
+		env: db.Environment{
+			Status:    db.StatusReady,
+			Container: container.Metadata{ID: "test"},
+		},
+	}
+
+	ctl := newMockCtl(&s.env.Container)
+	ctl.sessionsFn = func(m container.Metadata) ([]container.Session, error) {
+		return []container.Session{
+			{Name: "1", Attached: true, Created: started},
+			{Name: "work", Created: started},
+		}, nil
+	}
+
+	cmd := newSessionsCmd(ctl, s)
+
+	outch, errch := test_pkg.HijackStdout(func() {
+		cmd.Run(cmd, []string{})
+	})
+
+	expected := `SESSION  STATUS    STARTED
+1        attached  2020-01-02 03:04:05
+work     detached  2020-01-02 03:04:05
+`
+
+	select {
+	case err := <-errch:
+		t.Fatal("hijacking output", nil, err)
+	case actual := <-outch:
+		if expected != string(actual) {
+			t.Fatal("output", expected, string(actual))
+		}
+	}
+}
+
+func TestNoSessions(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	s := &memStore{
+		env: db.Environment{
+			Status:    db.StatusReady,
+			Container: container.Metadata{ID: "test"},
+		},
+	}
+
+	cmd := newSessionsCmd(newMockCtl(&s.env.Container), s)
+
+	outch, errch := test_pkg.HijackStdout(func() {
+		cmd.Run(cmd, []string{})
+	})
+
+	expected := `There aren't any sessions.
+
+Run "envctl login" to start one.
+`
+
+	select {
+	case err := <-errch:
+		t.Fatal("hijacking output", nil, err)
+	case actual := <-outch:
+		if expected != string(actual) {
+			t.Fatal("output", expected, string(actual))
+		}
+	}
+}
+
+func TestSessionsWithoutTmux(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	s := &memStore{
+		env: db.Environment{
+			Status:    db.StatusReady,
+			Container: container.Metadata{ID: "test"},
+		},
+	}
+
+	ctl := newMockCtl(&s.env.Container)
+	ctl.sessionsFn = func(m container.Metadata) ([]container.Session, error) {
+		return nil, container.ErrNoSessions
+	}
+
+	cmd := newSessionsCmd(ctl, s)
+
+	outch, errch := test_pkg.HijackStdout(func() {
+		cmd.Run(cmd, []string{})
+	})
+
+	expected := `There aren't any sessions, since the environment doesn't have tmux.
+
+Install it in a bootstrap step to keep logins running when you detach from them.
+`
+
+	select {
+	case err := <-errch:
+		t.Fatal("hijacking output", nil, err)
+	case actual := <-outch:
+		if expected != string(actual) {
+			t.Fatal("output", expected, string(actual))
+		}
+	}
+}
@@ -1,14 +1,21 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"reflect"
+	"strconv"
+	"strings"
 
+	"github.com/winiceo/genv/internal/config"
 	"github.com/winiceo/genv/internal/db"
+	"github.com/winiceo/genv/pkg/container"
+	units "github.com/docker/go-units"
 	"github.com/spf13/cobra"
 )
 
-func newStatusCmd(s db.Store) *cobra.Command {
+func newStatusCmd(s db.Store, l config.Loader) *cobra.Command {
 	statusDesc := "get current environment's status"
 
 	statusLongDesc := `status - Get the current environment's status
@@ -35,6 +42,8 @@ Try recreating it by running "envctl destroy", followed by "envctl create".`
 
 Run "envctl create" to spin it up!`
 
+	var output string
+
 	runStatus := func(cmd *cobra.Command, args []string) {
 		env, err := s.Read()
 		if err != nil {
@@ -42,6 +51,30 @@ Run "envctl create" to spin it up!`
 			os.Exit(1)
 		}
 
+		if output == "" {
+			ucfg, err := loadUserConfig()
+			if err != nil {
+				fmt.Printf("error reading user config: %v\n", err)
+				os.Exit(1)
+			}
+
+			output = ucfg.Output
+		}
+
+		switch output {
+		case "", "text":
+		case "json":
+			if err := printStatusJSON(env, l); err != nil {
+				fmt.Printf("error printing status: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		default:
+			fmt.Printf("error: unknown output %q, should be one of %v\n",
+				output, strings.Join(config.Outputs, ", "))
+			os.Exit(1)
+		}
+
 		switch env.Status {
 		case db.StatusReady:
 			fmt.Println(statusReady)
@@ -50,12 +83,137 @@ Run "envctl create" to spin it up!`
 		case db.StatusOff:
 			fmt.Println(statusOff)
 		}
+
+		if env.Initialized() && env.Profile != "" {
+			fmt.Printf("\nProfile: %v\n", env.Profile)
+		}
+
+		if env.Initialized() && len(env.Container.Ports) > 0 {
+			fmt.Println("\nPorts:")
+
+			for _, p := range env.Container.Ports {
+				fmt.Printf("  %v\n", p)
+			}
+		}
+
+		if env.Initialized() {
+			printResources(env.Container.Resources)
+		}
+
+		// Only where the variables came from is known, since their values
+		// aren't saved.
+		if env.Initialized() && len(env.Container.Variables) > 0 {
+			fmt.Println("\nVariables:")
+
+			for _, v := range env.Container.Variables {
+				if v.Secret {
+					fmt.Printf("  %v (secret from %v)\n", v.Name, v.Source)
+				} else {
+					fmt.Printf("  %v (from %v)\n", v.Name, v.Source)
+				}
+			}
+		}
+
+		warnDrift(env, l)
+		warnAgentMoved(env)
 	}
 
-	return &cobra.Command{
+	statusCmd := &cobra.Command{
 		Use:   "status",
 		Short: statusDesc,
 		Long:  statusLongDesc,
 		Run:   runStatus,
 	}
+
+	statusCmd.Flags().StringVarP(
+		&output,
+		"output",
+		"o",
+		"",
+		"format to print the status in, text or json (default is the user config's output, or text)",
+	)
+
+	return statusCmd
+}
+
+// statusNames are the names of the statuses in JSON output.
+var statusNames = map[int]string{
+	db.StatusOff:   "off",
+	db.StatusReady: "ready",
+	db.StatusError: "error",
+}
+
+// printStatusJSON prints the status of `env` as JSON, for scripts.
+func printStatusJSON(env db.Environment, l config.Loader) error {
+	status := struct {
+		Status        string                  `json:"status"`
+		Profile       string                  `json:"profile,omitempty"`
+		ConfigChanged bool                    `json:"config_changed"`
+		Ports         []container.PortMapping `json:"ports,omitempty"`
+		Resources     *container.Resources    `json:"resources,omitempty"`
+		Variables     []container.Variable    `json:"variables,omitempty"`
+	}{
+		Status:        statusNames[env.Status],
+		ConfigChanged: configDrifted(env, l),
+	}
+
+	if env.Initialized() {
+		status.Profile = env.Profile
+		status.Ports = env.Container.Ports
+		status.Variables = env.Container.Variables
+
+		if !reflect.DeepEqual(env.Container.Resources, container.Resources{}) {
+			status.Resources = &env.Container.Resources
+		}
+	}
+
+	out, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(out))
+	return nil
+}
+
+// printResources prints the resource limits in `r`, if there are any.
+func printResources(r container.Resources) {
+	limits := [][2]string{}
+	limit := func(name string, set bool, value string) {
+		if set {
+			limits = append(limits, [2]string{name, value})
+		}
+	}
+
+	size := func(n int64) string {
+		if n < 0 {
+			return "unlimited"
+		}
+
+		return units.BytesSize(float64(n))
+	}
+
+	limit("cpus", r.NanoCPUs != 0, strconv.FormatFloat(float64(r.NanoCPUs)/1e9, 'f', -1, 64))
+	limit("memory", r.Memory != 0, size(r.Memory))
+	limit("memory_swap", r.MemorySwap != 0, size(r.MemorySwap))
+	pids := strconv.FormatInt(r.PidsLimit, 10)
+	if r.PidsLimit < 0 {
+		pids = "unlimited"
+	}
+
+	limit("pids_limit", r.PidsLimit != 0, pids)
+	limit("shm_size", r.ShmSize != 0, size(r.ShmSize))
+
+	for _, u := range r.Ulimits {
+		limit("ulimit "+u.Name, true, fmt.Sprintf("%v:%v", u.Soft, u.Hard))
+	}
+
+	if len(limits) == 0 {
+		return
+	}
+
+	fmt.Println("\nResources:")
+	for _, l := range limits {
+		fmt.Printf("  %-16v %v\n", l[0]+":", l[1])
+	}
 }
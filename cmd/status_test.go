@@ -3,7 +3,9 @@ package cmd
 import (
 	"testing"
 
+	"github.com/winiceo/genv/internal/config"
 	"github.com/winiceo/genv/internal/db"
+	"github.com/winiceo/genv/pkg/container"
 	"github.com/winiceo/genv/test_pkg"
 )
 
@@ -16,7 +18,7 @@ func TestOffStatus(got *testing.T) {
 		},
 	}
 
-	cmd := newStatusCmd(s)
+	cmd := newStatusCmd(s, memConfig{})
 
 	outch, errch := test_pkg.HijackStdout(func() {
 		cmd.Run(cmd, []string{})
@@ -45,7 +47,7 @@ func TestReadyStatus(got *testing.T) {
 		},
 	}
 
-	cmd := newStatusCmd(s)
+	cmd := newStatusCmd(s, memConfig{})
 
 	outch, errch := test_pkg.HijackStdout(func() {
 		cmd.Run(cmd, []string{})
@@ -74,7 +76,7 @@ func TestErrorStatus(got *testing.T) {
 		},
 	}
 
-	cmd := newStatusCmd(s)
+	cmd := newStatusCmd(s, memConfig{})
 
 	outch, errch := test_pkg.HijackStdout(func() {
 		cmd.Run(cmd, []string{})
@@ -94,3 +96,256 @@ Try recreating it by running "envctl destroy", followed by "envctl create".
 		}
 	}
 }
+
+func TestChangedConfigStatus(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	cfg := memConfig{
+		opts: config.Opts{
+			Image: "test",
+			Shell: "/foo/sh",
+		},
+	}
+
+	s := &memStore{
+		env: db.Environment{
+			Status: db.StatusReady,
+			Config: config.Fingerprint{
+				Hash:  "stale",
+				Image: "stale",
+			},
+		},
+	}
+
+	cmd := newStatusCmd(s, cfg)
+
+	outch, errch := test_pkg.HijackStdout(func() {
+		cmd.Run(cmd, []string{})
+	})
+
+	expected := `The environment is ready!
+
+Run "envctl login" to enter it.
+
+Warning: the config file has changed since the environment was created.
+
+Run "envctl apply" to bring the environment up to date.
+`
+
+	select {
+	case err := <-errch:
+		t.Fatal("hijacking output", nil, err)
+	case actual := <-outch:
+		if expected != string(actual) {
+			t.Fatal("output", expected, string(actual))
+		}
+	}
+}
+
+func TestProfileStatus(got *testing.T) {
+	t := test_pkg.NewT(got)
+	s := &memStore{
+		env: db.Environment{
+			Status:  db.StatusReady,
+			Profile: "ci",
+		},
+	}
+
+	cmd := newStatusCmd(s, memConfig{})
+
+	outch, errch := test_pkg.HijackStdout(func() {
+		cmd.Run(cmd, []string{})
+	})
+
+	expected := `The environment is ready!
+
+Run "envctl login" to enter it.
+
+Profile: ci
+`
+
+	select {
+	case err := <-errch:
+		t.Fatal("hijacking output", nil, err)
+	case actual := <-outch:
+		if expected != string(actual) {
+			t.Fatal("output", expected, string(actual))
+		}
+	}
+}
+
+func TestVariablesStatus(got *testing.T) {
+	t := test_pkg.NewT(got)
+	s := &memStore{
+		env: db.Environment{
+			Status: db.StatusReady,
+			Container: container.Metadata{
+				Envs: []string{"FOO=bar", "TOKEN=hunter2"},
+				Variables: []container.Variable{
+					{Name: "FOO", Source: ".env"},
+					{Name: "TOKEN", Source: "cmd://pass show token", Secret: true},
+				},
+			},
+		},
+	}
+
+	cmd := newStatusCmd(s, memConfig{})
+
+	outch, errch := test_pkg.HijackStdout(func() {
+		cmd.Run(cmd, []string{})
+	})
+
+	expected := `The environment is ready!
+
+Run "envctl login" to enter it.
+
+Variables:
+  FOO (from .env)
+  TOKEN (secret from cmd://pass show token)
+`
+
+	select {
+	case err := <-errch:
+		t.Fatal("hijacking output", nil, err)
+	case actual := <-outch:
+		if expected != string(actual) {
+			t.Fatal("output", expected, string(actual))
+		}
+	}
+}
+
+func TestPortsStatus(got *testing.T) {
+	t := test_pkg.NewT(got)
+	s := &memStore{
+		env: db.Environment{
+			Status: db.StatusReady,
+			Container: container.Metadata{
+				Ports: []container.PortMapping{
+					{Protocol: "tcp", HostIP: "127.0.0.1", HostPort: 8080, ContainerPort: 80},
+					{Protocol: "udp", HostIP: "::1", HostPort: 5353, ContainerPort: 53},
+				},
+			},
+		},
+	}
+
+	cmd := newStatusCmd(s, memConfig{})
+
+	outch, errch := test_pkg.HijackStdout(func() {
+		cmd.Run(cmd, []string{})
+	})
+
+	expected := `The environment is ready!
+
+Run "envctl login" to enter it.
+
+Ports:
+  127.0.0.1:8080 -> 80/tcp
+  [::1]:5353 -> 53/udp
+`
+
+	select {
+	case err := <-errch:
+		t.Fatal("hijacking output", nil, err)
+	case actual := <-outch:
+		if expected != string(actual) {
+			t.Fatal("output", expected, string(actual))
+		}
+	}
+}
+
+func TestResourcesStatus(got *testing.T) {
+	t := test_pkg.NewT(got)
+	s := &memStore{
+		env: db.Environment{
+			Status: db.StatusReady,
+			Container: container.Metadata{
+				Resources: container.Resources{
+					NanoCPUs:   1500000000,
+					Memory:     2 << 30,
+					MemorySwap: -1,
+					Ulimits: []container.Ulimit{
+						{Name: "nofile", Soft: 1024, Hard: 2048},
+					},
+				},
+			},
+		},
+	}
+
+	cmd := newStatusCmd(s, memConfig{})
+
+	outch, errch := test_pkg.HijackStdout(func() {
+		cmd.Run(cmd, []string{})
+	})
+
+	expected := `The environment is ready!
+
+Run "envctl login" to enter it.
+
+Resources:
+  cpus:            1.5
+  memory:          2GiB
+  memory_swap:     unlimited
+  ulimit nofile:   1024:2048
+`
+
+	select {
+	case err := <-errch:
+		t.Fatal("hijacking output", nil, err)
+	case actual := <-outch:
+		if expected != string(actual) {
+			t.Fatal("output", expected, string(actual))
+		}
+	}
+}
+
+func TestJSONStatus(got *testing.T) {
+	t := test_pkg.NewT(got)
+	s := &memStore{
+		env: db.Environment{
+			Status:  db.StatusReady,
+			Profile: "ci",
+			Container: container.Metadata{
+				Ports: []container.PortMapping{
+					{Protocol: "tcp", HostIP: "127.0.0.1", HostPort: 8080, ContainerPort: 80},
+				},
+				Resources: container.Resources{PidsLimit: 512},
+			},
+		},
+	}
+
+	cmd := newStatusCmd(s, memConfig{})
+	if err := cmd.Flags().Set("output", "json"); err != nil {
+		t.Fatal("setting output", nil, err)
+	}
+
+	outch, errch := test_pkg.HijackStdout(func() {
+		cmd.Run(cmd, []string{})
+	})
+
+	expected := `{
+  "status": "ready",
+  "profile": "ci",
+  "config_changed": false,
+  "ports": [
+    {
+      "protocol": "tcp",
+      "host_ip": "127.0.0.1",
+      "host_port": 8080,
+      "container_port": 80
+    }
+  ],
+  "resources": {
+    "pids_limit": 512
+  }
+}
+`
+
+	select {
+	case err := <-errch:
+		t.Fatal("hijacking output", nil, err)
+	case actual := <-outch:
+		if expected != string(actual) {
+			t.Fatal("output", expected, string(actual))
+		}
+	}
+}
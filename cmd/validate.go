@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/winiceo/genv/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func newValidateCmd() *cobra.Command {
+	validateDesc := "check the config file for problems"
+	validateLongDesc := `validate - Check the config file for problems
+
+"validate" checks the config file, along with the files it extends and its
+local overlay, without touching the environment. Every problem it finds is
+printed with the file, line and column it's at, e.g.
+
+    envctl.yaml:12:7: port 70000 is out of range, should be between 1 and 65535
+
+It exits with a non-zero status if there are any.
+
+To have an editor check the config file as it's written, point it at the JSON
+Schema printed by "envctl config schema".`
+
+	runValidate := func(cmd *cobra.Command, args []string) {
+		problems, err := config.Validate(cfgFile, profile)
+		if err != nil {
+			fmt.Printf("error validating config file: %v\n", err)
+			os.Exit(1)
+		}
+
+		if len(problems) == 0 {
+			fmt.Printf("%v is valid\n", displayPath(cfgFile))
+			return
+		}
+
+		for _, p := range problems {
+			p.File = displayPath(p.File)
+			fmt.Println(p)
+		}
+
+		os.Exit(1)
+	}
+
+	return &cobra.Command{
+		Use:   "validate",
+		Short: validateDesc,
+		Long:  validateLongDesc,
+		Run:   runValidate,
+	}
+}
+
+// displayPath returns `path` relative to the working directory, if it's under
+// it, to keep output short.
+func displayPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+
+	rel, err := filepath.Rel(wd, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+
+	return rel
+}
@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/winiceo/genv/internal/config"
+	"github.com/winiceo/genv/internal/db"
+	"github.com/winiceo/genv/internal/watch"
+	"github.com/winiceo/genv/pkg/container"
+	"github.com/spf13/cobra"
+)
+
+func newWatchCmd(
+	ctl container.Controller,
+	s db.Store,
+	l config.Loader,
+) *cobra.Command {
+	watchDesc := "rebuild the environment or rerun tasks when files change"
+	watchLongDesc := `watch - Rebuild the environment or rerun tasks when files change
+
+"watch" keeps an eye on the config, and on the files matched by the patterns in
+the "watch" section of the config or given with --pattern.
+
+- when the config changes, the environment is brought up to date the same way
+  "envctl apply" does it. That's the config file, its local overlay, the files
+  it extends and its env files
+- when any other watched file changes, the commands in "watch.run" are run in
+  the environment
+
+Changes are batched up until nothing has changed for the --debounce period.
+Patterns use shell globs, and "**" matches any number of directories.`
+
+	var patterns []string
+	var debounce time.Duration
+
+	runWatch := func(cmd *cobra.Command, args []string) {
+		cfg, err := l.Load()
+		if err != nil {
+			fmt.Printf("error reading config file: %v\n", err)
+			os.Exit(1)
+		}
+
+		w, err := watch.New(projectDir, debounce, stateDir)
+		if err != nil {
+			fmt.Printf("error watching files: %v\n", err)
+			os.Exit(1)
+		}
+		defer w.Close()
+
+		watchConfigDirs(w, cfg)
+
+		if len(cfg.Watch.Run) == 0 {
+			fmt.Println("no commands in watch.run, only config changes will be applied")
+		}
+
+		fmt.Printf("watching %v for changes...\n", projectDir)
+
+		for {
+			select {
+			case err := <-w.Errors():
+				fmt.Printf("error watching files: %v\n", err)
+			case changed := <-w.Changes():
+				cfg = handleChanges(ctl, s, l, cfg, patterns, changed)
+				watchConfigDirs(w, cfg)
+			}
+		}
+	}
+
+	watchCmd := &cobra.Command{
+		Use:   "watch",
+		Short: watchDesc,
+		Long:  watchLongDesc,
+		Run:   runWatch,
+	}
+
+	watchCmd.Flags().StringSliceVarP(
+		&patterns,
+		"pattern",
+		"p",
+		[]string{},
+		"extra glob of files to watch (can be repeated)",
+	)
+
+	watchCmd.Flags().DurationVar(
+		&debounce,
+		"debounce",
+		500*time.Millisecond,
+		"how long to wait for changes to settle",
+	)
+
+	return watchCmd
+}
+
+// handleChanges reacts to a batch of changed files. It returns the config to
+// use from then on, which is only different from `cfg` when one of the files
+// the config is read from was one of the changed files.
+func handleChanges(
+	ctl container.Controller,
+	s db.Store,
+	l config.Loader,
+	cfg config.Opts,
+	patterns []string,
+	changed []string,
+) config.Opts {
+	inputs := map[string]bool{}
+	for _, path := range configInputs(cfg) {
+		inputs[path] = true
+	}
+
+	patterns = append(append([]string{}, patterns...), cfg.Watch.Patterns...)
+
+	changedInputs := []string{}
+	matched := []string{}
+	for _, path := range changed {
+		if inputs[path] {
+			changedInputs = append(changedInputs, path)
+			continue
+		}
+
+		// Only the config is watched outside of the project.
+		if strings.HasPrefix(path, "../") {
+			continue
+		}
+
+		for _, pattern := range patterns {
+			if watch.Match(pattern, path) {
+				matched = append(matched, path)
+				break
+			}
+		}
+	}
+
+	if len(changedInputs) > 0 {
+		printRunStart(fmt.Sprintf("%v changed, applying config", strings.Join(changedInputs, ", ")))
+
+		err := applyConfig(ctl, s, l, false)
+		printRunEnd(err)
+
+		// A broken config is reported by applyConfig, so the old one is
+		// kept around until the file is fixed.
+		if newCfg, err := l.Load(); err == nil {
+			cfg = newCfg
+		}
+	}
+
+	if len(matched) == 0 || len(cfg.Watch.Run) == 0 {
+		return cfg
+	}
+
+	printRunStart(fmt.Sprintf("%v changed, running task", strings.Join(matched, ", ")))
+
+	env, err := s.Read()
+	if err == nil && !env.Initialized() {
+		err = errEnvOff
+	}
+
+	if err == nil {
+		err = runScript(ctl, env.Container, cfg.Watch.Run)
+	}
+
+	printRunEnd(err)
+
+	return cfg
+}
+
+// configInputs returns the files `cfg` is read from, relative to the project
+// root the way changes are: the config file, its local overlay, whether or not
+// there is one yet, the files it extends and its env files.
+func configInputs(cfg config.Opts) []string {
+	files := append([]string{cfgFile, config.LocalPath(cfgFile)}, cfg.Sources...)
+	files = append(files, cfg.EnvFiles...)
+
+	inputs := []string{}
+	for _, file := range files {
+		rel, err := filepath.Rel(projectDir, file)
+		if err != nil {
+			continue
+		}
+
+		inputs = append(inputs, filepath.ToSlash(rel))
+	}
+
+	return inputs
+}
+
+// watchConfigDirs watches the directories of the files `cfg` is read from
+// that are outside of the project, which `w` doesn't watch otherwise.
+func watchConfigDirs(w *watch.Watcher, cfg config.Opts) {
+	for _, input := range configInputs(cfg) {
+		if !strings.HasPrefix(input, "../") {
+			continue
+		}
+
+		// Env files can be in directories that don't exist, which only
+		// fails the apply.
+		dir := filepath.Dir(filepath.Join(projectDir, filepath.FromSlash(input)))
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+
+		if err := w.AddDir(dir); err != nil {
+			fmt.Printf("Warning: not watching %v: %v\n", dir, err)
+		}
+	}
+}
+
+// printRunStart and printRunEnd frame the output of each run so that runs are
+// easy to tell apart when scrolling back.
+func printRunStart(reason string) {
+	fmt.Printf("\n==> %v %v\n", time.Now().Format("15:04:05"), reason)
+}
+
+func printRunEnd(err error) {
+	if err != nil {
+		fmt.Printf("==> failed: %v\n", err)
+		return
+	}
+
+	fmt.Println("==> done")
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/winiceo/genv/internal/config"
+	"github.com/winiceo/genv/pkg/container"
+	"github.com/winiceo/genv/test_pkg"
+)
+
+func TestWatchRunsTask(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	opts := config.Opts{
+		Image: "test",
+		Shell: "/foo/sh",
+		Mount: "/foo/mnt",
+		Watch: config.Watch{
+			Patterns: []string{"*.go"},
+			Run:      []string{"go test ./..."},
+		},
+	}
+
+	s, ctl := newAppliedEnv(t, opts)
+
+	ran := 0
+	ctl.runFn = func(m container.Metadata, cmds []string) error {
+		ran++
+		return nil
+	}
+
+	outch, errch := test_pkg.HijackStdout(func() {
+		handleChanges(ctl, s, memConfig{opts: opts}, opts, nil, []string{"README.md"})
+		handleChanges(ctl, s, memConfig{opts: opts}, opts, nil, []string{"cmd/root.go"})
+	})
+
+	select {
+	case err := <-errch:
+		t.Fatal("hijacking output", nil, err)
+	case <-outch:
+	}
+
+	if ran != 1 {
+		t.Fatal("task runs", 1, ran)
+	}
+}
+
+func TestWatchAppliesConfigInputs(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	dir, err := ioutil.TempDir("", "envctl-watch")
+	if err != nil {
+		t.Fatal("creating temp dir", nil, err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(cfg, dir string) { cfgFile, projectDir = cfg, dir }(cfgFile, projectDir)
+	projectDir = filepath.Join(dir, "repo")
+	cfgFile = filepath.Join(projectDir, "envctl.yaml")
+
+	// The env file is read to fingerprint the config.
+	envFile := filepath.Join(projectDir, ".env")
+	if err := os.MkdirAll(projectDir, 0755); err != nil {
+		t.Fatal("creating project dir", nil, err)
+	}
+
+	if err := ioutil.WriteFile(envFile, []byte("FOO=bar\n"), 0644); err != nil {
+		t.Fatal("writing env file", nil, err)
+	}
+
+	opts := config.Opts{
+		Image: "test",
+		Shell: "/foo/sh",
+		Mount: "/foo/mnt",
+		Watch: config.Watch{
+			Patterns: []string{"**/*"},
+			Run:      []string{"go test ./..."},
+		},
+		Sources:  []string{cfgFile, filepath.Join(dir, "shared", "envctl.yaml")},
+		EnvFiles: []string{envFile},
+	}
+
+	cases := []struct {
+		changed  []string
+		expected string
+	}{
+		{[]string{"README.md"}, "README.md changed, running task"},
+		{[]string{"../shared/README.md"}, ""},
+		{[]string{"envctl.yaml"}, "envctl.yaml changed, applying config"},
+		{[]string{"envctl.local.yaml"}, "envctl.local.yaml changed, applying config"},
+		{[]string{"../shared/envctl.yaml"}, "../shared/envctl.yaml changed, applying config"},
+		{[]string{".env"}, ".env changed, applying config"},
+	}
+
+	for _, c := range cases {
+		s, ctl := newAppliedEnv(t, opts)
+
+		outch, errch := test_pkg.HijackStdout(func() {
+			handleChanges(ctl, s, memConfig{opts: opts}, opts, nil, c.changed)
+		})
+
+		select {
+		case err := <-errch:
+			t.Fatal("hijacking output", nil, err)
+		case out := <-outch:
+			if c.expected == "" && len(out) > 0 {
+				t.Fatal("output after "+c.changed[0]+" changed", "", string(out))
+			}
+
+			if !strings.Contains(string(out), c.expected) {
+				t.Fatal("output after "+c.changed[0]+" changed", c.expected, string(out))
+			}
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package archive
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Owner is who the files in an archive belong to, by their IDs.
+type Owner struct {
+	UID int
+	GID int
+}
+
+// Dir writes the contents of the directory `root` to `w` as a tar archive,
+// under the directory `prefix` in the archive. Modes are kept, but the files
+// belong to root in the archive, since the users of the host mean nothing
+// where it's extracted. Directories named in `skip` are left out, wherever
+// they are in the tree.
+func Dir(w io.Writer, root, prefix string, skip ...string) error {
+	return DirAs(w, root, prefix, Owner{}, skip...)
+}
+
+// DirAs writes an archive the same way Dir does, with the files belonging to
+// `owner` instead of root.
+func DirAs(w io.Writer, root, prefix string, owner Owner, skip ...string) error {
+	tw := tar.NewWriter(w)
+
+	err := filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() && file != root {
+			for _, s := range skip {
+				if info.Name() == s {
+					return filepath.SkipDir
+				}
+			}
+		}
+
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+
+		return addFile(tw, file, path.Join(prefix, filepath.ToSlash(rel)), info, owner)
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// addFile writes the file at `file` to `tw` as `name`, belonging to `owner`.
+func addFile(tw *tar.Writer, file, name string, info os.FileInfo, owner Owner) error {
+	link := ""
+	if info.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if link, err = os.Readlink(file); err != nil {
+			return err
+		}
+	}
+
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+
+	hdr.Uid, hdr.Gid = owner.UID, owner.GID
+	hdr.Uname, hdr.Gname = "", ""
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// Extract extracts the tar archive in `r` into the directory `dir`, keeping
+// modes and modification times. When `root` is set, it replaces the first
+// element of every path in the archive, which renames what the archive is of.
+// Nothing can be extracted outside of `dir`.
+func Extract(r io.Reader, dir, root string) error {
+	tr := tar.NewReader(r)
+
+	// Directories get their modes once everything's extracted, since they
+	// could be read-only.
+	dirModes := map[string]os.FileMode{}
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		name := renameRoot(path.Clean(hdr.Name), root)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("%v is outside of the directory it's extracted to", hdr.Name)
+		}
+
+		// A symlink earlier in the archive could point anywhere.
+		if err := checkParents(dir, name); err != nil {
+			return err
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		mode := hdr.FileInfo().Mode()
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			// A symlink with the same name would have the directory's mode
+			// set on wherever it points.
+			if info, err := os.Lstat(target); err == nil && !info.IsDir() {
+				if err := os.Remove(target); err != nil {
+					return err
+				}
+			}
+
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+
+			dirModes[target] = mode.Perm()
+			continue
+		case tar.TypeReg, tar.TypeRegA:
+			if err := extractFile(tr, target, mode.Perm()); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			os.Remove(target)
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+
+			continue
+		case tar.TypeLink:
+			link := renameRoot(path.Clean(hdr.Linkname), root)
+			if path.IsAbs(link) || link == ".." || strings.HasPrefix(link, "../") {
+				return fmt.Errorf("%v links outside of the directory it's extracted to", hdr.Name)
+			}
+
+			if err := checkParents(dir, link); err != nil {
+				return err
+			}
+
+			os.Remove(target)
+			if err := os.Link(filepath.Join(dir, filepath.FromSlash(link)), target); err != nil {
+				return err
+			}
+
+			continue
+		default:
+			// Devices and the like can't be made without root, and have
+			// no business being copied anyway.
+			continue
+		}
+
+		if err := os.Chtimes(target, hdr.ModTime, hdr.ModTime); err != nil {
+			return err
+		}
+	}
+
+	for d, mode := range dirModes {
+		if err := os.Chmod(d, mode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func extractFile(r io.Reader, target string, mode os.FileMode) error {
+	// Whatever was there is replaced rather than written to, since it could
+	// be a symlink from earlier in the archive pointing anywhere.
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	// The mode it was created with went through the umask.
+	return os.Chmod(target, mode)
+}
+
+// renameRoot replaces the first element of `name` with `root`, if it's set.
+func renameRoot(name, root string) string {
+	if root == "" {
+		return name
+	}
+
+	parts := strings.SplitN(name, "/", 2)
+	parts[0] = root
+
+	return path.Join(parts...)
+}
+
+// checkParents checks that none of the directories `name` is in, under `dir`,
+// is a symlink.
+func checkParents(dir, name string) error {
+	parent := dir
+	parts := strings.Split(name, "/")
+
+	for _, part := range parts[:len(parts)-1] {
+		parent = filepath.Join(parent, part)
+
+		info, err := os.Lstat(parent)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%v is in a symlink", name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,278 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/winiceo/genv/test_pkg"
+)
+
+func TestDir(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	root, err := ioutil.TempDir("", "envctl-archive")
+	if err != nil {
+		t.Fatal("creating temp dir", nil, err)
+	}
+	defer os.RemoveAll(root)
+
+	files := map[string]string{
+		".bashrc":          "alias ll='ls -l'\n",
+		"bin/hello":        "#!/bin/sh\necho hello\n",
+		".git/HEAD":        "ref: refs/heads/master\n",
+		"vim/.git/ignored": "",
+	}
+
+	for name, contents := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal("creating dir", nil, err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal("writing file", nil, err)
+		}
+	}
+
+	if err := os.Chmod(filepath.Join(root, "bin/hello"), 0755); err != nil {
+		t.Fatal("making file executable", nil, err)
+	}
+
+	if err := os.Symlink(".bashrc", filepath.Join(root, ".profile")); err != nil {
+		t.Fatal("creating symlink", nil, err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := Dir(buf, root, "dotfiles", ".git"); err != nil {
+		t.Fatal("archiving", nil, err)
+	}
+
+	entries := []string{}
+	tr := tar.NewReader(buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatal("reading archive", nil, err)
+		}
+
+		entry := hdr.Name
+		switch {
+		case hdr.Typeflag == tar.TypeSymlink:
+			entry += " -> " + hdr.Linkname
+		case hdr.Name == "dotfiles/bin/hello" && hdr.Mode&0111 == 0:
+			t.Fatal("mode of "+hdr.Name, "executable", os.FileMode(hdr.Mode))
+		}
+
+		if hdr.Uid != 0 || hdr.Gid != 0 {
+			t.Fatal("owner of "+hdr.Name, "0:0", []int{hdr.Uid, hdr.Gid})
+		}
+
+		entries = append(entries, entry)
+	}
+
+	expected := strings.Join([]string{
+		"dotfiles/",
+		"dotfiles/.bashrc",
+		"dotfiles/.profile -> .bashrc",
+		"dotfiles/bin/",
+		"dotfiles/bin/hello",
+		"dotfiles/vim/",
+	}, "\n")
+
+	if expected != strings.Join(entries, "\n") {
+		t.Fatal("entries", expected, strings.Join(entries, "\n"))
+	}
+}
+
+func TestExtract(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	src, err := ioutil.TempDir("", "envctl-archive")
+	if err != nil {
+		t.Fatal("creating temp dir", nil, err)
+	}
+	defer os.RemoveAll(src)
+
+	dst, err := ioutil.TempDir("", "envctl-extract")
+	if err != nil {
+		t.Fatal("creating temp dir", nil, err)
+	}
+	defer os.RemoveAll(dst)
+
+	if err := os.MkdirAll(filepath.Join(src, "bin"), 0755); err != nil {
+		t.Fatal("creating dir", nil, err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(src, "bin/tool"), []byte("#!/bin/sh\n"), 0750); err != nil {
+		t.Fatal("writing file", nil, err)
+	}
+
+	if err := os.Symlink("bin/tool", filepath.Join(src, "tool")); err != nil {
+		t.Fatal("creating symlink", nil, err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := Dir(buf, src, "app"); err != nil {
+		t.Fatal("archiving", nil, err)
+	}
+
+	if err := Extract(buf, dst, "renamed"); err != nil {
+		t.Fatal("extracting", nil, err)
+	}
+
+	info, err := os.Stat(filepath.Join(dst, "renamed/bin/tool"))
+	if err != nil {
+		t.Fatal("extracted file", nil, err)
+	}
+
+	if info.Mode().Perm() != 0750 {
+		t.Fatal("mode of extracted file", os.FileMode(0750), info.Mode().Perm())
+	}
+
+	link, err := os.Readlink(filepath.Join(dst, "renamed/tool"))
+	if err != nil || link != "bin/tool" {
+		t.Fatal("extracted symlink", "bin/tool", link)
+	}
+
+	if _, err := os.Stat(filepath.Join(dst, "app")); !os.IsNotExist(err) {
+		t.Fatal("original root", "renamed", err)
+	}
+}
+
+func TestExtractOutside(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	dst, err := ioutil.TempDir("", "envctl-extract")
+	if err != nil {
+		t.Fatal("creating temp dir", nil, err)
+	}
+	defer os.RemoveAll(dst)
+
+	cases := []struct {
+		hdrs     []*tar.Header
+		expected string
+	}{
+		{
+			[]*tar.Header{
+				{Name: "../escape", Typeflag: tar.TypeReg, Mode: 0644},
+			},
+			"../escape is outside of the directory it's extracted to",
+		},
+		{
+			[]*tar.Header{
+				{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc"},
+				{Name: "link/passwd", Typeflag: tar.TypeReg, Mode: 0644},
+			},
+			"link/passwd is in a symlink",
+		},
+		{
+			[]*tar.Header{
+				{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc"},
+				{Name: "passwd", Typeflag: tar.TypeLink, Linkname: "link/passwd"},
+			},
+			"link/passwd is in a symlink",
+		},
+	}
+
+	for _, c := range cases {
+		buf := &bytes.Buffer{}
+		tw := tar.NewWriter(buf)
+		for _, hdr := range c.hdrs {
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal("writing archive", nil, err)
+			}
+		}
+		tw.Close()
+
+		err := Extract(buf, dst, "")
+		if err == nil || err.Error() != c.expected {
+			t.Fatal("extracting", c.expected, err)
+		}
+	}
+}
+
+func TestExtractOverSymlink(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	dir, err := ioutil.TempDir("", "envctl-extract")
+	if err != nil {
+		t.Fatal("creating temp dir", nil, err)
+	}
+	defer os.RemoveAll(dir)
+
+	dst := filepath.Join(dir, "dst")
+	if err := os.Mkdir(dst, 0755); err != nil {
+		t.Fatal("creating destination", nil, err)
+	}
+
+	outside := filepath.Join(dir, "outside")
+	if err := ioutil.WriteFile(outside, []byte("outside"), 0600); err != nil {
+		t.Fatal("writing outside file", nil, err)
+	}
+
+	outsideDir := filepath.Join(dir, "outside-dir")
+	if err := os.Mkdir(outsideDir, 0700); err != nil {
+		t.Fatal("creating outside dir", nil, err)
+	}
+
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	files := []struct {
+		hdr     *tar.Header
+		content string
+	}{
+		{&tar.Header{Name: "x", Typeflag: tar.TypeSymlink, Linkname: outside}, ""},
+		{&tar.Header{Name: "x", Typeflag: tar.TypeReg, Mode: 0644, Size: 6}, "inside"},
+		{&tar.Header{Name: "d", Typeflag: tar.TypeSymlink, Linkname: outsideDir}, ""},
+		{&tar.Header{Name: "d", Typeflag: tar.TypeDir, Mode: 0777}, ""},
+	}
+	for _, f := range files {
+		if err := tw.WriteHeader(f.hdr); err != nil {
+			t.Fatal("writing archive", nil, err)
+		}
+
+		if _, err := tw.Write([]byte(f.content)); err != nil {
+			t.Fatal("writing archive", nil, err)
+		}
+	}
+	tw.Close()
+
+	if err := Extract(buf, dst, ""); err != nil {
+		t.Fatal("extracting", nil, err)
+	}
+
+	content, err := ioutil.ReadFile(outside)
+	if err != nil || string(content) != "outside" {
+		t.Fatal("outside file", "outside", string(content))
+	}
+
+	info, err := os.Stat(outside)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatal("outside file mode", os.FileMode(0600), info.Mode().Perm())
+	}
+
+	info, err = os.Stat(outsideDir)
+	if err != nil || info.Mode().Perm() != 0700 {
+		t.Fatal("outside dir mode", os.FileMode(0700), info.Mode().Perm())
+	}
+
+	content, err = ioutil.ReadFile(filepath.Join(dst, "x"))
+	if err != nil || string(content) != "inside" {
+		t.Fatal("extracted file", "inside", string(content))
+	}
+
+	info, err = os.Lstat(filepath.Join(dst, "d"))
+	if err != nil || !info.IsDir() {
+		t.Fatal("extracted dir", true, info)
+	}
+}
@@ -0,0 +1,290 @@
+package asciicast
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Version is the version of the asciicast format that's written and read.
+const Version = 2
+
+// Event codes.
+const (
+	Output = "o"
+	Resize = "r"
+)
+
+// The size a recording has when the terminal's size is never recorded.
+const (
+	DefaultWidth  = 80
+	DefaultHeight = 24
+)
+
+// Header is the first line of a recording.
+type Header struct {
+	Version   int               `json:"version"`
+	Width     uint              `json:"width"`
+	Height    uint              `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Event is something that happened in a recording, `Time` seconds in.
+type Event struct {
+	Time float64
+	Code string
+	Data string
+}
+
+// Writer records a terminal session in the asciicast format. Output is
+// recorded by writing it to the Writer, and resizes with Resize.
+//
+// The header is only written with the first event, so that the first resize
+// can set the size in it. Recording is never what stops a session, so Write
+// and Resize don't fail: Close returns the first error there was instead.
+type Writer struct {
+	w      io.Writer
+	header Header
+	start  time.Time
+
+	mu      sync.Mutex
+	started bool
+	pending []byte
+	err     error
+}
+
+// NewWriter returns a Writer that records to `w`, starting now. The version,
+// timestamp and size in `header` are filled in.
+func NewWriter(w io.Writer, header Header) *Writer {
+	header.Version = Version
+	header.Width, header.Height = DefaultWidth, DefaultHeight
+
+	start := time.Now()
+	header.Timestamp = start.Unix()
+
+	return &Writer{w: w, header: header, start: start}
+}
+
+// Write records `p` as output.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Runes can be split between writes, but events have to be valid UTF-8,
+	// so whatever is left of one is kept for the next write.
+	data := append(w.pending, p...)
+	end := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				end = i
+			}
+			break
+		}
+	}
+
+	w.pending = append([]byte{}, data[end:]...)
+
+	if end > 0 {
+		w.event(Output, string(data[:end]))
+	}
+
+	return len(p), nil
+}
+
+// Resize records the terminal being resized to `width` by `height`.
+func (w *Writer) Resize(width, height uint) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if width == w.header.Width && height == w.header.Height {
+		return nil
+	}
+
+	// The header has the size the terminal is until the first event, and
+	// keeps track of it after that.
+	if w.started {
+		w.event(Resize, fmt.Sprintf("%vx%v", width, height))
+	}
+
+	w.header.Width, w.header.Height = width, height
+	return nil
+}
+
+// Close records what's left of the output, and returns the first error there
+// was recording. It doesn't close the underlying writer.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.pending) > 0 {
+		w.event(Output, string(w.pending))
+		w.pending = nil
+	}
+
+	// A recording of nothing still has its header.
+	if !w.started {
+		w.writeLine(w.header)
+		w.started = true
+	}
+
+	return w.err
+}
+
+// event writes an event, and the header first if it hasn't been written yet.
+func (w *Writer) event(code, data string) {
+	if !w.started {
+		w.writeLine(w.header)
+		w.started = true
+	}
+
+	elapsed := time.Since(w.start).Seconds()
+	w.writeLine([]interface{}{roundTime(elapsed), code, data})
+}
+
+func (w *Writer) writeLine(v interface{}) {
+	if w.err != nil {
+		return
+	}
+
+	line, err := json.Marshal(v)
+	if err != nil {
+		w.err = err
+		return
+	}
+
+	_, w.err = w.w.Write(append(line, '\n'))
+}
+
+// roundTime rounds `t` to microseconds, which is as precise as asciinema is.
+func roundTime(t float64) json.Number {
+	return json.Number(strconv.FormatFloat(t, 'f', 6, 64))
+}
+
+// Reader reads a recording in the asciicast format.
+type Reader struct {
+	Header Header
+
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewReader returns a Reader for the recording in `r`, with its header read.
+func NewReader(r io.Reader) (*Reader, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	rd := &Reader{scanner: scanner}
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("the recording is empty")
+	}
+
+	rd.line++
+
+	if err := json.Unmarshal(scanner.Bytes(), &rd.Header); err != nil {
+		return nil, fmt.Errorf("line 1: the header isn't valid: %v", err)
+	}
+
+	if rd.Header.Version != Version {
+		return nil, fmt.Errorf("line 1: version %v recordings aren't supported, only version %v",
+			rd.Header.Version, Version)
+	}
+
+	return rd, nil
+}
+
+// Next returns the next event in the recording, or io.EOF at the end of it.
+func (r *Reader) Next() (Event, error) {
+	for r.scanner.Scan() {
+		r.line++
+
+		raw := strings.TrimSpace(r.scanner.Text())
+		if raw == "" {
+			continue
+		}
+
+		var fields []interface{}
+		if err := json.Unmarshal([]byte(raw), &fields); err != nil {
+			return Event{}, fmt.Errorf("line %v: %v", r.line, err)
+		}
+
+		if len(fields) != 3 {
+			return Event{}, fmt.Errorf("line %v: an event should have 3 fields, not %v",
+				r.line, len(fields))
+		}
+
+		t, ok := fields[0].(float64)
+		code, ok2 := fields[1].(string)
+		data, ok3 := fields[2].(string)
+		if !ok || !ok2 || !ok3 {
+			return Event{}, fmt.Errorf("line %v: an event should be [time, code, data]", r.line)
+		}
+
+		return Event{Time: t, Code: code, Data: data}, nil
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return Event{}, err
+	}
+
+	return Event{}, io.EOF
+}
+
+// sleep waits between events when playing recordings back.
+var sleep = time.Sleep
+
+// Play plays the recording in `r` back to `w`, `speed` times as fast as it was
+// recorded. Pauses are cut short to `maxIdle`, unless it's 0. Only output is
+// played back: the terminal it's played in keeps its size.
+func Play(w io.Writer, r io.Reader, speed float64, maxIdle time.Duration) error {
+	if speed <= 0 {
+		return fmt.Errorf("speed should be more than 0, not %v", speed)
+	}
+
+	rd, err := NewReader(r)
+	if err != nil {
+		return err
+	}
+
+	last := 0.0
+	for {
+		e, err := rd.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		wait := time.Duration((e.Time - last) * float64(time.Second))
+		if maxIdle > 0 && wait > maxIdle {
+			wait = maxIdle
+		}
+
+		if wait > 0 {
+			sleep(time.Duration(float64(wait) / speed))
+		}
+
+		last = e.Time
+
+		if e.Code != Output {
+			continue
+		}
+
+		if _, err := io.WriteString(w, e.Data); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package asciicast
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/winiceo/genv/test_pkg"
+)
+
+func TestWriter(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf, Header{Env: map[string]string{"SHELL": "/bin/bash"}})
+
+	w.Resize(120, 40)
+	w.Write([]byte("$ echo h"))
+	// "é" split between two writes.
+	w.Write([]byte("\xc3"))
+	w.Write([]byte("\xa9\r\n"))
+	w.Resize(120, 40)
+	w.Resize(100, 30)
+	w.Write([]byte("\xe2\x82"))
+
+	if err := w.Close(); err != nil {
+		t.Fatal("closing", nil, err)
+	}
+
+	r, err := NewReader(buf)
+	if err != nil {
+		t.Fatal("reading header", nil, err)
+	}
+
+	if r.Header.Version != 2 || r.Header.Width != 120 || r.Header.Height != 40 ||
+		r.Header.Env["SHELL"] != "/bin/bash" || r.Header.Timestamp == 0 {
+		t.Fatal("header", "version 2, 120x40, SHELL and a timestamp", r.Header)
+	}
+
+	expected := []Event{
+		{Code: Output, Data: "$ echo h"},
+		{Code: Output, Data: "é\r\n"},
+		{Code: Resize, Data: "100x30"},
+		// What's left of a rune at the end isn't valid UTF-8.
+		{Code: Output, Data: "\ufffd\ufffd"},
+	}
+
+	actual := []Event{}
+	last := 0.0
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal("reading events", nil, err)
+		}
+
+		if e.Time < last {
+			t.Fatal("time of event", "increasing", e.Time)
+		}
+		last = e.Time
+
+		e.Time = 0
+		actual = append(actual, e)
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatal("events", expected, actual)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestWriterError(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	w := NewWriter(failingWriter{}, Header{})
+
+	if n, err := w.Write([]byte("hello")); n != 5 || err != nil {
+		t.Fatal("writing", 5, n)
+	}
+
+	if err := w.Close(); err == nil || err.Error() != "disk full" {
+		t.Fatal("closing", "disk full", err)
+	}
+}
+
+func TestEmptyRecording(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	buf := &bytes.Buffer{}
+	if err := NewWriter(buf, Header{}).Close(); err != nil {
+		t.Fatal("closing", nil, err)
+	}
+
+	r, err := NewReader(buf)
+	if err != nil {
+		t.Fatal("reading header", nil, err)
+	}
+
+	if r.Header.Width != DefaultWidth || r.Header.Height != DefaultHeight {
+		t.Fatal("size", "80x24", r.Header)
+	}
+
+	if _, err := r.Next(); err != io.EOF {
+		t.Fatal("reading events", io.EOF, err)
+	}
+}
+
+func TestPlay(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	defer func(f func(time.Duration)) { sleep = f }(sleep)
+
+	waits := []time.Duration{}
+	sleep = func(d time.Duration) {
+		waits = append(waits, d)
+	}
+
+	recording := `{"version": 2, "width": 80, "height": 24}
+[0.5, "o", "hello "]
+[1.5, "r", "100x30"]
+
+[4.5, "o", "world\r\n"]
+`
+
+	out := &bytes.Buffer{}
+	if err := Play(out, strings.NewReader(recording), 2, 2*time.Second); err != nil {
+		t.Fatal("playing", nil, err)
+	}
+
+	if out.String() != "hello world\r\n" {
+		t.Fatal("output", "hello world\r\n", out.String())
+	}
+
+	expected := []time.Duration{
+		250 * time.Millisecond,
+		500 * time.Millisecond,
+		time.Second,
+	}
+
+	if !reflect.DeepEqual(expected, waits) {
+		t.Fatal("waits", expected, waits)
+	}
+}
+
+func TestPlayErrors(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	defer func(f func(time.Duration)) { sleep = f }(sleep)
+	sleep = func(time.Duration) {}
+
+	cases := []struct {
+		recording string
+		speed     float64
+		expected  string
+	}{
+		{`{"version": 2}`, 0, "speed should be more than 0, not 0"},
+		{``, 1, "the recording is empty"},
+		{`{"version": 1}`, 1, "line 1: version 1 recordings aren't supported, only version 2"},
+		{"{\"version\": 2}\n[1, \"o\"]", 1, "line 2: an event should have 3 fields, not 2"},
+		{"{\"version\": 2}\n[\"1\", \"o\", \"x\"]", 1, "line 2: an event should be [time, code, data]"},
+	}
+
+	for _, c := range cases {
+		err := Play(&bytes.Buffer{}, strings.NewReader(c.recording), c.speed, 0)
+		if err == nil || err.Error() != c.expected {
+			t.Fatal("playing "+c.recording, c.expected, err)
+		}
+	}
+}
@@ -2,22 +2,94 @@ package config
 
 // Opts is what tells envctl what the environment looks like.
 type Opts struct {
+	// Version is the version of the config format the file is written in.
+	// Older files are upgraded while they're loaded, so a loaded `Opts` is
+	// always the current Version.
+	Version int `yaml:"version,omitempty"`
+
+	// Extends is the path of another config file this one is merged onto,
+	// relative to this one. It's resolved while loading, so a loaded `Opts`
+	// never has it set.
+	Extends string `yaml:"extends,omitempty"`
+
 	Image string `yaml:"image"`
 	// The default for this field is true, so `nil`` needs to be discernable
 	// from the default `false` value.
 	CacheImage *bool `yaml:"cache_image,omitempty"`
 
+	// User is who the environment runs as, root unless it's set. HostUser
+	// runs it as a copy of the user running envctl instead.
 	User      string            `yaml:"user"`
 	Shell     string            `yaml:"shell"`
 	Mount     string            `yaml:"mount,omitempty"`
 	Variables map[string]string `yaml:"variables,omitempty"`
-	Bootstrap []string          `yaml:"bootstrap,omitempty"`
+	Bootstrap []Step            `yaml:"bootstrap,omitempty"`
+
+	// EnvFiles are dotenv files the environment's variables are read from.
+	// Relative paths are relative to the config file they're in, and are made
+	// absolute while loading. Anything in Variables overrides them.
+	EnvFiles []string `yaml:"env_files,omitempty"`
 
 	// Exposing the host network isn't a cross-platform solution, so the
-	// upfront requirement is to expose any ports that the user needs. The ports
-	// are to be mapped directly from container to host so that whatever is
-	// exposed in the container is the port that's accessed on the host.
+	// upfront requirement is to expose any ports that the user needs. Unless
+	// a port spec says otherwise, ports are mapped directly from container to
+	// host so that whatever is exposed in the container is the port that's
+	// accessed on the host.
 	Ports L3Ports `yaml:"ports,omitempty"`
+
+	Resources Resources `yaml:"resources,omitempty"`
+
+	// Forward lists what's forwarded from the host into the environment, out
+	// of Forwards.
+	Forward []string `yaml:"forward,omitempty"`
+
+	// Watch only affects "envctl watch", so it's left out of the config's
+	// fingerprint.
+	Watch Watch `yaml:"watch,omitempty"`
+
+	// Profiles are named variants of the config. Each one holds part of an
+	// `Opts`, which is merged onto the rest of the config when the profile is
+	// selected. They're resolved while loading, so a loaded `Opts` never has
+	// them set. Profile is the name of the profile that was selected, if any.
+	Profiles map[string]Opts `yaml:"profiles,omitempty"`
+	Profile  string          `yaml:"-"`
+
+	// Sources are the config files that were read to load the config: the
+	// config file, the files it extends and its local overlay, if it has one.
+	Sources []string `yaml:"-"`
+}
+
+// HostUser is the User that runs the environment as a user with the same name,
+// IDs and home directory as the user running envctl, so that the files they
+// write to the mount belong to them on the host as well.
+const HostUser = "host"
+
+// What can be forwarded from the host into the environment.
+const (
+	ForwardSSHAgent  = "ssh_agent"
+	ForwardGitConfig = "git_config"
+	ForwardGPGAgent  = "gpg_agent"
+)
+
+// Forwards are the names of everything that can be forwarded.
+var Forwards = []string{ForwardSSHAgent, ForwardGitConfig, ForwardGPGAgent}
+
+// Step is a single bootstrap step.
+type Step struct {
+	// Run is the command to run, in the environment's shell.
+	Run string `yaml:"run"`
+	// User is who the command runs as. It's the environment's user unless
+	// it's set.
+	User string `yaml:"user,omitempty"`
+}
+
+// Watch tells "envctl watch" what to do when files in the repo change.
+type Watch struct {
+	// Patterns are globs, relative to the repo, of the files to watch.
+	Patterns []string `yaml:"patterns,omitempty"`
+	// Run is a list of commands run in the environment, the same way
+	// bootstrap steps are, whenever a watched file changes.
+	Run []string `yaml:"run,omitempty"`
 }
 
 // Loader is anything that can load a configuration file.
@@ -25,5 +97,6 @@ type Loader interface {
 	Load() (Opts, error)
 }
 
-// L3Ports are mappings between a layer 3 protocol like TCP and a port number.
-type L3Ports map[string][]int
+// L3Ports are mappings between a layer 3 protocol like TCP and the ports
+// exposed over it.
+type L3Ports map[string][]PortSpec
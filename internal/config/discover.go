@@ -0,0 +1,40 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// Filename is the name of the config file "envctl init" creates.
+const Filename = "envctl.yaml"
+
+// ErrNotFound is returned by Discover when there's no config file to be found.
+var ErrNotFound = errors.New("no config file found in this directory or any parent")
+
+// Discover looks for a config file in `dir`, and then in each of its parents
+// in turn, the same way git looks for the root of a repository. It returns the
+// absolute path of the first one it finds. Any of the Filenames will do, so
+// the format of the file it returns depends on its extension.
+func Discover(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		for _, name := range Filenames {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path, nil
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ErrNotFound
+		}
+
+		dir = parent
+	}
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/winiceo/genv/test_pkg"
+)
+
+func TestDiscover(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	root, err := ioutil.TempDir("", "envctl-discover")
+	if err != nil {
+		t.Fatal("creating temp dir", nil, err)
+	}
+	defer os.RemoveAll(root)
+
+	// Symlinked temp dirs (macOS) would make the paths below differ.
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		t.Fatal("resolving temp dir", nil, err)
+	}
+
+	sub := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal("creating sub dirs", nil, err)
+	}
+
+	if _, err := Discover(sub); err != ErrNotFound {
+		t.Fatal("discovering missing config", ErrNotFound, err)
+	}
+
+	expected := filepath.Join(root, Filename)
+	if err := ioutil.WriteFile(expected, []byte{}, 0644); err != nil {
+		t.Fatal("writing config", nil, err)
+	}
+
+	actual, err := Discover(sub)
+	if err != nil {
+		t.Fatal("discovering config", nil, err)
+	}
+
+	if expected != actual {
+		t.Fatal("discovered config", expected, actual)
+	}
+}
@@ -0,0 +1,536 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ReplaceMarker, as the first item of a list, makes the list replace the one
+// it's merged onto instead of being appended to it.
+const ReplaceMarker = "(replace)"
+
+// Document is a config file merged with every file it extends and with its
+// local overlay. Every value in it remembers the file it came from.
+//
+// Files are merged onto the file they extend, and the local overlay is merged
+// onto the result:
+//
+// - maps are merged key by key
+// - lists are appended to, unless they start with ReplaceMarker
+// - anything else is overridden
+type Document struct {
+	root map[string]interface{}
+	dir  string
+}
+
+// sourced is a single value in a Document along with the file it came from.
+type sourced struct {
+	value  interface{}
+	origin string
+}
+
+// LocalPath returns the path of the local overlay for the config file at
+// `path`, e.g. "envctl.local.yaml" for "envctl.yaml". The overlay is meant for
+// per-developer tweaks, so it shouldn't be checked into version control.
+func LocalPath(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".local" + ext
+}
+
+// Resolve reads the config file at `path` into a Document. The format of each
+// file that's read is picked by its extension.
+func Resolve(path string) (Document, error) {
+	decode, err := decoderFor(path)
+	if err != nil {
+		return Document{}, err
+	}
+
+	return resolve(path, decode)
+}
+
+func resolve(path string, decode decoder) (Document, error) {
+	return resolveWith(path, decode, readFile)
+}
+
+// reader reads a single config file into an annotated document.
+type reader func(path string, decode decoder) (map[string]interface{}, error)
+
+// resolveWith resolves the config file at `path` like resolve does, reading
+// each file with `read`.
+func resolveWith(path string, decode decoder, read reader) (Document, error) {
+	root, err := resolveFile(path, decode, read, map[string]bool{})
+	if err != nil {
+		return Document{}, err
+	}
+
+	local := LocalPath(path)
+	if _, err := os.Stat(local); err == nil {
+		overlay, err := resolveFile(local, decode, read, map[string]bool{})
+		if err != nil {
+			return Document{}, err
+		}
+
+		root = merge(root, overlay).(map[string]interface{})
+	}
+
+	return Document{root: root, dir: filepath.Dir(path)}, nil
+}
+
+// resolveFile reads the file at `path` and merges it onto the chain of files
+// it extends. `seen` holds the files already read along the chain, to stop
+// files from extending each other forever.
+func resolveFile(
+	path string,
+	decode decoder,
+	read reader,
+	seen map[string]bool,
+) (map[string]interface{}, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if seen[abs] {
+		return nil, fmt.Errorf("%v: extends itself", path)
+	}
+	seen[abs] = true
+
+	doc, err := read(path, decode)
+	if err != nil {
+		return nil, err
+	}
+
+	extends, ok := doc["extends"]
+	if !ok {
+		return doc, nil
+	}
+	delete(doc, "extends")
+
+	parent, ok := extends.(sourced).value.(string)
+	if !ok || parent == "" {
+		return nil, fmt.Errorf("%v: extends must be a path", path)
+	}
+
+	if !filepath.IsAbs(parent) {
+		parent = filepath.Join(filepath.Dir(path), parent)
+	}
+
+	// Extending a directory means extending the config file in it.
+	if info, err := os.Stat(parent); err == nil && info.IsDir() {
+		parent = filepath.Join(parent, Filename)
+	}
+
+	parentDecode, err := decoderFor(parent)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+
+	base, err := resolveFile(parent, parentDecode, read, seen)
+	if err != nil {
+		return nil, err
+	}
+
+	return merge(base, doc).(map[string]interface{}), nil
+}
+
+// readFile decodes a single config file and checks it against Opts, so that
+// unknown keys are reported with the file they're in, even when the file only
+// holds part of the config.
+func readFile(path string, decode decoder) (map[string]interface{}, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, err := decode(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+
+	doc := stringKeys(decoded).(map[string]interface{})
+
+	migrated, err := migrate(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+
+	annotated := annotate(doc, path).(map[string]interface{})
+
+	// YAML files can be checked as they are, which keeps the line numbers in
+	// the errors meaningful. Replace markers would trip up the check though,
+	// and so would anything that had to be upgraded.
+	ext := strings.ToLower(filepath.Ext(path))
+	if (ext == ".yaml" || ext == ".yml") && !hasMarker(annotated) && !migrated {
+		if err := yaml.UnmarshalStrict(raw, &Opts{}); err != nil {
+			return nil, fmt.Errorf("%v: %v", path, err)
+		}
+
+		return annotated, nil
+	}
+
+	if _, err := decodeOpts(annotated); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+
+	return annotated, nil
+}
+
+// absPaths makes the relative paths in the list under `key` absolute. Each one
+// is relative to the file it came from, which isn't necessarily the file that
+// ended up extending it.
+func (d Document) absPaths(key string) Document {
+	list, ok := d.root[key].([]interface{})
+	if !ok {
+		return d
+	}
+
+	out := make([]interface{}, len(list))
+	for i, item := range list {
+		out[i] = item
+
+		s, ok := item.(sourced)
+		if !ok {
+			continue
+		}
+
+		if path, ok := s.value.(string); ok && path != "" && !filepath.IsAbs(path) {
+			s.value = filepath.Join(filepath.Dir(s.origin), path)
+			out[i] = s
+		}
+	}
+
+	root := map[string]interface{}{}
+	for k, v := range d.root {
+		root[k] = v
+	}
+	root[key] = out
+
+	return Document{root: root, dir: d.dir}
+}
+
+// Opts decodes the Document into an `Opts`, checking that everything that
+// should be there is there, and filling in defaults for the rest.
+func (d Document) Opts() (Opts, error) {
+	cfg, err := decodeOpts(d.root)
+	if err != nil {
+		return Opts{}, err
+	}
+
+	return finalize(cfg)
+}
+
+// decodeOpts runs an annotated document through yaml.UnmarshalStrict, so every
+// format gets the same treatment of unknown keys and mismatched types that
+// YAML files get. The line numbers in those errors point into an intermediate
+// YAML document though, not the original file, so they're left out.
+func decodeOpts(doc map[string]interface{}) (Opts, error) {
+	buf, err := yaml.Marshal(plain(doc))
+	if err != nil {
+		return Opts{}, err
+	}
+
+	var cfg Opts
+	err = yaml.UnmarshalStrict(buf, &cfg)
+	if err != nil {
+		return Opts{}, errors.New(lineRef.ReplaceAllString(err.Error(), ""))
+	}
+
+	return cfg, nil
+}
+
+// annotate wraps every scalar in `v` with the file it came from. It also turns
+// the maps yaml.v2 decodes into, which can have any type of key, into maps
+// with string keys like the ones the other formats decode into.
+func annotate(v interface{}, origin string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := map[string]interface{}{}
+		for k, item := range v {
+			out[k] = annotate(item, origin)
+		}
+
+		return out
+	case map[interface{}]interface{}:
+		out := map[string]interface{}{}
+		for k, item := range v {
+			out[fmt.Sprintf("%v", k)] = annotate(item, origin)
+		}
+
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = annotate(item, origin)
+		}
+
+		return out
+	case []map[string]interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = annotate(item, origin)
+		}
+
+		return out
+	default:
+		return sourced{value: v, origin: origin}
+	}
+}
+
+// stringKeys turns the maps in a decoded document into maps with string keys,
+// the same way annotate does, but leaves everything else as it is. Unlike
+// plain, it keeps replace markers, so list items keep their place.
+func stringKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := map[string]interface{}{}
+		for k, item := range v {
+			out[k] = stringKeys(item)
+		}
+
+		return out
+	case map[interface{}]interface{}:
+		out := map[string]interface{}{}
+		for k, item := range v {
+			out[fmt.Sprintf("%v", k)] = stringKeys(item)
+		}
+
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = stringKeys(item)
+		}
+
+		return out
+	case []map[string]interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = stringKeys(item)
+		}
+
+		return out
+	}
+
+	return v
+}
+
+// plain strips the origins from an annotated value, along with any replace
+// markers left in it.
+func plain(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := map[string]interface{}{}
+		for k, item := range v {
+			out[k] = plain(item)
+		}
+
+		return out
+	case []interface{}:
+		out := []interface{}{}
+		for i, item := range v {
+			if i == 0 && isMarker(item) {
+				continue
+			}
+
+			out = append(out, plain(item))
+		}
+
+		return out
+	case sourced:
+		return v.value
+	default:
+		return v
+	}
+}
+
+func isMarker(v interface{}) bool {
+	s, ok := v.(sourced)
+	return ok && s.value == ReplaceMarker
+}
+
+func hasMarker(v interface{}) bool {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, item := range v {
+			if hasMarker(item) {
+				return true
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			if (i == 0 && isMarker(item)) || hasMarker(item) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// merge merges the annotated value `over` onto `base`.
+func merge(base, over interface{}) interface{} {
+	switch over := over.(type) {
+	case map[string]interface{}:
+		baseMap, ok := base.(map[string]interface{})
+		if !ok {
+			return over
+		}
+
+		out := map[string]interface{}{}
+		for k, item := range baseMap {
+			out[k] = item
+		}
+
+		for k, item := range over {
+			if baseItem, ok := out[k]; ok {
+				out[k] = merge(baseItem, item)
+			} else {
+				out[k] = item
+			}
+		}
+
+		return out
+	case []interface{}:
+		baseList, ok := base.([]interface{})
+		if !ok || (len(over) > 0 && isMarker(over[0])) {
+			return over
+		}
+
+		out := []interface{}{}
+		for i, item := range baseList {
+			if i == 0 && isMarker(item) {
+				continue
+			}
+
+			out = append(out, item)
+		}
+
+		return append(out, over...)
+	default:
+		return over
+	}
+}
+
+// Write writes the Document out as YAML, with a comment after every value
+// saying which file it came from.
+func (d Document) Write(w io.Writer) error {
+	return d.write(w, d.root, "", false)
+}
+
+func (d Document) write(w io.Writer, v interface{}, indent string, inList bool) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for i, k := range keys {
+			prefix := indent
+			if inList && i == 0 {
+				// The first key of a map in a list goes on the same line as
+				// the dash.
+				prefix = ""
+			}
+
+			if err := d.writeEntry(w, prefix, k+":", v[k], indent); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range plainItems(v) {
+			if err := d.writeEntry(w, indent, "-", item, indent+"  "); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (d Document) writeEntry(
+	w io.Writer,
+	prefix, label string,
+	v interface{},
+	indent string,
+) error {
+	switch item := v.(type) {
+	case sourced:
+		_, err := fmt.Fprintf(w, "%v%v %v  # %v\n",
+			prefix, label, scalar(item.value), d.relative(item.origin))
+		return err
+	case map[string]interface{}:
+		if len(item) == 0 {
+			_, err := fmt.Fprintf(w, "%v%v {}\n", prefix, label)
+			return err
+		}
+
+		if label == "-" {
+			if _, err := fmt.Fprintf(w, "%v- ", prefix); err != nil {
+				return err
+			}
+
+			return d.write(w, item, indent, true)
+		}
+
+		if _, err := fmt.Fprintf(w, "%v%v\n", prefix, label); err != nil {
+			return err
+		}
+
+		return d.write(w, item, indent+"  ", false)
+	case []interface{}:
+		if len(plainItems(item)) == 0 {
+			_, err := fmt.Fprintf(w, "%v%v []\n", prefix, label)
+			return err
+		}
+
+		if _, err := fmt.Fprintf(w, "%v%v\n", prefix, label); err != nil {
+			return err
+		}
+
+		return d.write(w, item, indent, false)
+	}
+
+	return nil
+}
+
+// plainItems drops the replace marker from the front of a list, if it's there.
+func plainItems(list []interface{}) []interface{} {
+	if len(list) > 0 && isMarker(list[0]) {
+		return list[1:]
+	}
+
+	return list
+}
+
+func (d Document) relative(path string) string {
+	if rel, err := filepath.Rel(d.dir, path); err == nil {
+		return rel
+	}
+
+	return path
+}
+
+// scalar formats a single value as YAML.
+func scalar(v interface{}) string {
+	if s, ok := v.(string); ok && strings.Contains(s, "\n") {
+		return strconv.Quote(s)
+	}
+
+	buf, err := yaml.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+
+	return strings.TrimSuffix(string(buf), "\n")
+}
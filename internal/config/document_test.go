@@ -0,0 +1,160 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/winiceo/genv/test_pkg"
+)
+
+// writeFiles writes each of `files` into a new temp dir and returns the dir.
+// The caller is responsible for removing it.
+func writeFiles(t test_pkg.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "envctl-config")
+	if err != nil {
+		t.Fatal("creating temp dir", nil, err)
+	}
+
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal("creating config dir", nil, err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal("writing config", nil, err)
+		}
+	}
+
+	return dir
+}
+
+func TestExtends(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	dir := writeFiles(t, map[string]string{
+		"shared/envctl.toml": `
+image = "ubuntu:latest"
+shell = "/bin/bash"
+bootstrap = ["make deps"]
+env_files = ["shared.env"]
+
+[variables]
+FOO = "bar"
+BAZ = "qux"
+
+[ports]
+tcp = [4567]
+`,
+		"repo/envctl.yaml": `---
+extends: ../shared/envctl.toml
+image: ruby:2.5
+bootstrap:
+- make more
+env_files:
+- .env
+variables:
+  FOO: foo
+ports:
+  tcp:
+  - (replace)
+  - 80
+`,
+		"repo/envctl.local.yaml": `---
+variables:
+  FOO: mine
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	actual, err := YAML{Path: filepath.Join(dir, "repo", "envctl.yaml")}.Load()
+	if err != nil {
+		t.Fatal("loading config", nil, err)
+	}
+
+	expected := Opts{
+		Version:    Version,
+		Image:      "ruby:2.5",
+		Shell:      "/bin/bash",
+		User:       "root",
+		CacheImage: CacheImage,
+		Bootstrap:  []Step{{Run: "make deps"}, {Run: "make more"}},
+		Variables:  map[string]string{"FOO": "mine", "BAZ": "qux"},
+		Ports:      L3Ports{"tcp": []PortSpec{"80"}},
+		EnvFiles: []string{
+			filepath.Join(dir, "shared", "shared.env"),
+			filepath.Join(dir, "repo", ".env"),
+		},
+		Sources: []string{
+			filepath.Join(dir, "repo", "envctl.yaml"),
+			filepath.Join(dir, "shared", "envctl.toml"),
+			filepath.Join(dir, "repo", "envctl.local.yaml"),
+		},
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatal("merged config", expected, actual)
+	}
+}
+
+func TestExtendsCycle(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	dir := writeFiles(t, map[string]string{
+		"a/envctl.yaml": "extends: ../b\n",
+		"b/envctl.yaml": "extends: ../a\n",
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := YAML{Path: filepath.Join(dir, "a", "envctl.yaml")}.Load()
+	if err == nil || !strings.Contains(err.Error(), "extends itself") {
+		t.Fatal("loading cyclic config", "extends itself", err)
+	}
+}
+
+func TestResolvedOrigins(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	dir := writeFiles(t, map[string]string{
+		"base.yaml": `---
+image: ubuntu:latest
+shell: /bin/bash
+bootstrap:
+- make deps
+`,
+		"envctl.yaml": `---
+version: 2
+extends: base.yaml
+bootstrap:
+- run: make more
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	doc, err := Resolve(filepath.Join(dir, "envctl.yaml"))
+	if err != nil {
+		t.Fatal("resolving config", nil, err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := doc.Write(buf); err != nil {
+		t.Fatal("writing config", nil, err)
+	}
+
+	expected := `bootstrap:
+- run: make deps  # base.yaml
+- run: make more  # envctl.yaml
+image: ubuntu:latest  # base.yaml
+shell: /bin/bash  # base.yaml
+version: 2  # envctl.yaml
+`
+
+	if expected != buf.String() {
+		t.Fatal("resolved config", expected, buf.String())
+	}
+}
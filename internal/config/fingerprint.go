@@ -0,0 +1,183 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+)
+
+// Fingerprint identifies a resolved `Opts`. Besides the hash of the whole
+// config, it keeps a hash for each part of the config that's applied at a
+// different stage of creating an environment. That way a change can be traced
+// back to the least amount of work needed to apply it.
+type Fingerprint struct {
+	Hash      string `json:"hash"`
+	Image     string `json:"image"`
+	Container string `json:"container"`
+	Bootstrap string `json:"bootstrap"`
+	// Variables is the hash of what the variables resolve to, which the
+	// container is created with too. It's kept apart from the rest, since
+	// fingerprints saved before it existed don't have it.
+	Variables string `json:"variables,omitempty"`
+}
+
+// Change is how much of an environment has to be redone for it to match a
+// config. Every change implies the ones below it, e.g. a rebuilt image needs a
+// new container, and a new container needs to be bootstrapped again.
+type Change int
+
+const (
+	// ChangeNone means the environment is up to date.
+	ChangeNone Change = iota
+	// ChangeBootstrap means only the bootstrap steps need to run again.
+	ChangeBootstrap
+	// ChangeContainer means the container needs to be recreated from the
+	// existing image.
+	ChangeContainer
+	// ChangeImage means the image needs to be rebuilt.
+	ChangeImage
+)
+
+// Fingerprint hashes the parts of `o` that end up in the environment. Anything
+// that only affects envctl itself is left out, so changing it doesn't make the
+// environment stale.
+//
+// Variables are hashed as they're written, and env files by their paths. What
+// they resolve to is added with WithVariables.
+func (o Opts) Fingerprint() (Fingerprint, error) {
+	// The host user is created in the image, so running as them means
+	// rebuilding it. It's left out otherwise, so the images of environments
+	// created before it existed don't look stale.
+	image, err := hash(struct {
+		Image      string
+		CacheImage *bool
+		Shell      string
+		Mount      string
+		HostUser   bool `json:",omitempty"`
+	}{o.Image, o.CacheImage, o.Shell, o.Mount, o.User == HostUser})
+	if err != nil {
+		return Fingerprint{}, err
+	}
+
+	// Resources are left out when nothing is limited, and so is Forward when
+	// nothing is forwarded, so environments created before they existed don't
+	// look stale.
+	var resources *Resources
+	if !o.Resources.IsZero() {
+		resources = &o.Resources
+	}
+
+	cnt, err := hash(struct {
+		User      string
+		Variables map[string]string
+		EnvFiles  []string
+		Ports     L3Ports
+		Resources *Resources `json:",omitempty"`
+		Forward   []string   `json:",omitempty"`
+	}{o.User, o.Variables, o.EnvFiles, o.Ports, resources, o.Forward})
+	if err != nil {
+		return Fingerprint{}, err
+	}
+
+	bootstrap, err := hash(stepsKey(o.Bootstrap))
+	if err != nil {
+		return Fingerprint{}, err
+	}
+
+	// The selected profile is part of the config too, even when selecting it
+	// doesn't change anything else.
+	parts := []string{image, cnt, bootstrap}
+	if o.Profile != "" {
+		parts = append(parts, o.Profile)
+	}
+
+	all, err := hash(parts)
+	if err != nil {
+		return Fingerprint{}, err
+	}
+
+	return Fingerprint{
+		Hash:      all,
+		Image:     image,
+		Container: cnt,
+		Bootstrap: bootstrap,
+	}, nil
+}
+
+// WithVariables returns `f` along with the hash of `envs`, what the variables
+// resolve to as NAME=value pairs, so that changes to only what they're read
+// from, like env files or the host's variables, are noticed too. Secrets should
+// be in `envs` by their references, since what they resolve to shouldn't end
+// up in the state, even hashed.
+func (f Fingerprint) WithVariables(envs []string) (Fingerprint, error) {
+	sorted := append([]string{}, envs...)
+	sort.Strings(sorted)
+
+	vars, err := hash(sorted)
+	if err != nil {
+		return Fingerprint{}, err
+	}
+
+	f.Variables = vars
+	return f, nil
+}
+
+// Diff returns the Change needed to go from `f` to `to`. An empty `f` can't be
+// traced back to anything, so everything is considered changed. Fingerprints
+// can differ without any work being needed, e.g. when switching to a profile
+// that doesn't change anything, so use Same to tell whether the configs are
+// the same. Variables are only compared when `f` has them, so environments
+// created before they were fingerprinted don't look stale.
+func (f Fingerprint) Diff(to Fingerprint) Change {
+	switch {
+	case f.Image != to.Image:
+		return ChangeImage
+	case f.Container != to.Container:
+		return ChangeContainer
+	case f.Variables != "" && f.Variables != to.Variables:
+		return ChangeContainer
+	case f.Bootstrap != to.Bootstrap:
+		return ChangeBootstrap
+	}
+
+	return ChangeNone
+}
+
+// Same returns whether `f` and `to` fingerprint the same config, as far as
+// Diff can tell.
+func (f Fingerprint) Same(to Fingerprint) bool {
+	return f.Hash == to.Hash && f.Diff(to) == ChangeNone
+}
+
+// stepsKey returns what's hashed for the bootstrap `steps`. Steps that only
+// have a command are hashed the way plain commands were before steps could
+// have settings of their own, so upgrading a config file doesn't make every
+// environment created from it look stale.
+func stepsKey(steps []Step) interface{} {
+	runs := []string{}
+	for _, step := range steps {
+		if step.User != "" {
+			return steps
+		}
+
+		runs = append(runs, step.Run)
+	}
+
+	if len(steps) == 0 {
+		return []string(nil)
+	}
+
+	return runs
+}
+
+func hash(v interface{}) (string, error) {
+	// encoding/json sorts map keys, which keeps the output stable between runs.
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+)
+
+// HCL is a Loader for an HCL configuration file.
+type HCL struct {
+	Path    string
+	Profile string
+}
+
+// Load returns a new `Opts` by reading the HCL file. It follows the same
+// rules as YAML.Load.
+func (c HCL) Load() (Opts, error) {
+	return load(c.Path, decodeHCL, c.Profile)
+}
+
+func decodeHCL(raw []byte) (map[string]interface{}, error) {
+	var doc map[string]interface{}
+	if err := hcl.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+
+	return conform(doc, reflect.TypeOf(Opts{})).(map[string]interface{}), nil
+}
+
+// conform reshapes a decoded HCL document to fit `t`. HCL decodes blocks such
+// as `variables { FOO = "bar" }` into a list of objects, since a block can be
+// repeated, which can't tell an object apart from a list of objects. The Go
+// type the value is going into can.
+func conform(v interface{}, t reflect.Type) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Map, reflect.Struct:
+		obj, ok := v.(map[string]interface{})
+		if blocks, isList := v.([]map[string]interface{}); isList {
+			obj, ok = map[string]interface{}{}, true
+			for _, block := range blocks {
+				for k, item := range block {
+					obj[k] = item
+				}
+			}
+		}
+
+		if !ok {
+			return v
+		}
+
+		for k, item := range obj {
+			if t.Kind() == reflect.Map {
+				obj[k] = conform(item, t.Elem())
+			} else if field, ok := fieldByTag(t, k); ok {
+				obj[k] = conform(item, field.Type)
+			}
+		}
+
+		return obj
+	case reflect.Slice:
+		switch list := v.(type) {
+		case []interface{}:
+			for i, item := range list {
+				list[i] = conform(item, t.Elem())
+			}
+		case []map[string]interface{}:
+			items := make([]interface{}, len(list))
+			for i, item := range list {
+				items[i] = conform(item, t.Elem())
+			}
+
+			return items
+		}
+	}
+
+	return v
+}
+
+// fieldByTag returns the field of struct type `t` with the yaml name `name`.
+func fieldByTag(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if tag == name {
+			return field, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
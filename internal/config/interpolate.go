@@ -0,0 +1,268 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Lookup returns the value of the variable called `name`, and whether it's set
+// at all. os.LookupEnv is a Lookup.
+type Lookup func(name string) (string, bool)
+
+// MissingError is returned when interpolating needs variables that aren't
+// there. It holds every one of them, so they can all be fixed in one go.
+type MissingError struct {
+	Problems []string
+}
+
+func (e *MissingError) Error() string {
+	return "missing variables: " + strings.Join(e.Problems, ", ")
+}
+
+// Interpolate expands the variables in `s` the way a shell would:
+//
+// - $VAR and ${VAR} expand to the value of VAR
+// - ${VAR:-default} expands to default when VAR is unset or empty
+// - ${VAR:?message} expands to the value of VAR, and fails with message when
+//   VAR is unset or empty
+// - $$ is a literal $
+//
+// A variable that's unset or empty, without a default, is missing. If any are
+// missing, it returns a *MissingError listing all of them.
+func Interpolate(s string, lookup Lookup) (string, error) {
+	ip := &interpolator{lookup: lookup}
+
+	out := ip.expand(s)
+	if err := ip.err(); err != nil {
+		return "", err
+	}
+
+	return out, nil
+}
+
+// interpolator expands any number of strings, keeping track of everything that
+// went wrong along the way.
+type interpolator struct {
+	lookup   Lookup
+	problems []string
+}
+
+func (ip *interpolator) err() error {
+	if len(ip.problems) == 0 {
+		return nil
+	}
+
+	return &MissingError{Problems: ip.problems}
+}
+
+func (ip *interpolator) expand(s string) string {
+	out := &strings.Builder{}
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i == len(s)-1 {
+			out.WriteByte(s[i])
+			continue
+		}
+
+		next := s[i+1]
+		switch {
+		case next == '$':
+			out.WriteByte('$')
+			i++
+		case next == '{':
+			end := closingBrace(s[i:])
+			if end < 0 {
+				ip.problems = append(ip.problems,
+					fmt.Sprintf("unterminated ${ in %q", s))
+				return out.String()
+			}
+
+			out.WriteString(ip.braced(s[i+2 : i+end]))
+			i += end
+		case isNameStart(next):
+			end := i + 1
+			for end < len(s) && isNameChar(s[end]) {
+				end++
+			}
+
+			out.WriteString(ip.value(s[i+1:end], "", false))
+			i = end - 1
+		default:
+			// Anything else, like "$1" or a "$" on its own, isn't a variable.
+			out.WriteByte('$')
+		}
+	}
+
+	return out.String()
+}
+
+// braced expands what's between the braces in "${...}".
+func (ip *interpolator) braced(expr string) string {
+	name := expr
+	if i := strings.Index(expr, ":"); i >= 0 {
+		name = expr[:i]
+	}
+
+	if !isName(name) {
+		ip.problems = append(ip.problems, fmt.Sprintf("bad substitution ${%v}", expr))
+		return ""
+	}
+
+	rest := expr[len(name):]
+	switch {
+	case rest == "":
+		return ip.value(name, "", false)
+	case strings.HasPrefix(rest, ":-"):
+		if v, ok := ip.lookup(name); ok && v != "" {
+			return v
+		}
+
+		// Defaults can have variables in them too.
+		return ip.expand(rest[2:])
+	case strings.HasPrefix(rest, ":?"):
+		return ip.value(name, rest[2:], true)
+	}
+
+	ip.problems = append(ip.problems, fmt.Sprintf("bad substitution ${%v}", expr))
+	return ""
+}
+
+// value returns the value of the variable called `name`, noting it as missing
+// if it's unset or empty.
+func (ip *interpolator) value(name, message string, required bool) string {
+	if v, ok := ip.lookup(name); ok && v != "" {
+		return v
+	}
+
+	if required && message != "" {
+		ip.problems = append(ip.problems, fmt.Sprintf("%v (%v)", name, message))
+	} else {
+		ip.problems = append(ip.problems, name)
+	}
+
+	return ""
+}
+
+// interpolate expands the variables in every string in the annotated value
+// `v`.
+func (ip *interpolator) interpolate(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := map[string]interface{}{}
+		for k, item := range v {
+			out[k] = ip.interpolate(item)
+		}
+
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = ip.interpolate(item)
+		}
+
+		return out
+	case sourced:
+		if s, ok := v.value.(string); ok {
+			v.value = ip.expand(s)
+		}
+
+		return v
+	default:
+		return v
+	}
+}
+
+// Interpolate returns the Document with the variables in all of its strings
+// expanded, the same way the package level Interpolate does it. The values of
+// "variables" are left alone, since they're only resolved when an environment
+// is created. So are the commands in "bootstrap" and "watch", which run in the
+// environment's shell, where variables like $HOME are the environment's own.
+func (d Document) Interpolate(lookup Lookup) (Document, error) {
+	ip := &interpolator{lookup: lookup}
+
+	root := map[string]interface{}{}
+	for k, v := range d.root {
+		switch k {
+		case "variables", "bootstrap":
+			root[k] = v
+		case "watch":
+			root[k] = ip.interpolateExcept(v, "run")
+		default:
+			root[k] = ip.interpolate(v)
+		}
+	}
+
+	if err := ip.err(); err != nil {
+		return Document{}, err
+	}
+
+	return Document{root: root, dir: d.dir}, nil
+}
+
+// interpolateExcept interpolates the map `v`, leaving the values of `keys` as
+// they are.
+func (ip *interpolator) interpolateExcept(v interface{}, keys ...string) interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return ip.interpolate(v)
+	}
+
+	skip := map[string]bool{}
+	for _, k := range keys {
+		skip[k] = true
+	}
+
+	out := map[string]interface{}{}
+	for k, item := range m {
+		if skip[k] {
+			out[k] = item
+			continue
+		}
+
+		out[k] = ip.interpolate(item)
+	}
+
+	return out
+}
+
+// closingBrace returns the index of the brace that closes the "${" at the start
+// of `s`, or -1 if there isn't one. Braces can nest, as in "${A:-${B}}".
+func closingBrace(s string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '{':
+			depth++
+			i++
+		case s[i] == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+func isName(s string) bool {
+	if s == "" || !isNameStart(s[0]) {
+		return false
+	}
+
+	for i := 1; i < len(s); i++ {
+		if !isNameChar(s[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
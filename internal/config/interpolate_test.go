@@ -0,0 +1,149 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/winiceo/genv/test_pkg"
+)
+
+func TestInterpolate(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	env := map[string]string{
+		"FOO":   "foo",
+		"EMPTY": "",
+	}
+
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	cases := map[string]string{
+		"":                         "",
+		"plain":                    "plain",
+		"$FOO":                     "foo",
+		"${FOO}":                   "foo",
+		"a-$FOO-b":                 "a-foo-b",
+		"a${FOO}b":                 "afoob",
+		"${NOPE:-default}":         "default",
+		"${EMPTY:-default}":        "default",
+		"${FOO:-default}":          "foo",
+		"${NOPE:-${FOO}}":          "foo",
+		"${FOO:?must be set}":      "foo",
+		"$$FOO":                    "$FOO",
+		"cost: $$5":                "cost: $5",
+		"$1 and $":                 "$1 and $",
+		"echo $${HOME} is ${FOO}":  "echo ${HOME} is foo",
+		"${FOO}${FOO:-x}$FOO$$FOO": "foofoofoo$FOO",
+	}
+
+	for in, expected := range cases {
+		actual, err := Interpolate(in, lookup)
+		if err != nil {
+			t.Fatal("interpolating "+in, nil, err)
+		}
+
+		if expected != actual {
+			t.Fatal("interpolating "+in, expected, actual)
+		}
+	}
+}
+
+func TestInterpolateMissing(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	lookup := func(name string) (string, bool) {
+		return "", name == "EMPTY"
+	}
+
+	_, err := Interpolate("$NOPE ${EMPTY} ${TOKEN:?get one from the admin}", lookup)
+
+	merr, ok := err.(*MissingError)
+	if !ok {
+		t.Fatal("interpolation error", "*MissingError", err)
+	}
+
+	expected := "missing variables: NOPE, EMPTY, TOKEN (get one from the admin)"
+	if expected != merr.Error() {
+		t.Fatal("interpolation error", expected, merr.Error())
+	}
+}
+
+func TestInterpolateBadSyntax(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	lookup := func(name string) (string, bool) {
+		return "", false
+	}
+
+	for _, in := range []string{"${FOO", "${}", "${FOO:x}", "${1FOO}"} {
+		if _, err := Interpolate(in, lookup); err == nil {
+			t.Fatal("interpolating "+in, "an error", err)
+		}
+	}
+}
+
+func TestDocumentInterpolate(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	dir := writeFiles(t, map[string]string{
+		"envctl.yaml": `---
+image: ruby:${RUBY_VERSION}
+shell: /bin/sh
+variables:
+  GEM_HOME: $HOME/gems
+bootstrap:
+- echo $HOME
+watch:
+  patterns:
+  - ${SRC}/**/*.rb
+  run:
+  - $HOME/bin/test
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	doc, err := resolve(filepath.Join(dir, "envctl.yaml"), decodeYAML)
+	if err != nil {
+		t.Fatal("resolving config", nil, err)
+	}
+
+	lookup := func(name string) (string, bool) {
+		v, ok := map[string]string{"RUBY_VERSION": "2.5", "SRC": "lib"}[name]
+		return v, ok
+	}
+
+	doc, err = doc.Interpolate(lookup)
+	if err != nil {
+		t.Fatal("interpolating config", nil, err)
+	}
+
+	cfg, err := doc.Opts()
+	if err != nil {
+		t.Fatal("decoding config", nil, err)
+	}
+
+	// Only what's read on the host is interpolated, and commands are left to
+	// the environment's shell.
+	expected := Opts{
+		Version:    Version,
+		Image:      "ruby:2.5",
+		Shell:      "/bin/sh",
+		User:       "root",
+		CacheImage: CacheImage,
+		Variables:  map[string]string{"GEM_HOME": "$HOME/gems"},
+		Bootstrap:  []Step{{Run: "echo $HOME"}},
+		Watch: Watch{
+			Patterns: []string{"lib/**/*.rb"},
+			Run:      []string{"$HOME/bin/test"},
+		},
+	}
+
+	if !reflect.DeepEqual(expected, cfg) {
+		t.Fatal("interpolated config", expected, cfg)
+	}
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"encoding/json"
+	"math"
+)
+
+// JSON is a Loader for a JSON configuration file.
+type JSON struct {
+	Path    string
+	Profile string
+}
+
+// Load returns a new `Opts` by reading the JSON file. It follows the same
+// rules as YAML.Load.
+func (c JSON) Load() (Opts, error) {
+	return load(c.Path, decodeJSON, c.Profile)
+}
+
+func decodeJSON(raw []byte) (map[string]interface{}, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+
+	return integers(doc).(map[string]interface{}), nil
+}
+
+// integers turns the whole numbers in a decoded JSON document back into ints.
+// encoding/json decodes every number as a float64, and big ones would end up
+// in exponent form otherwise, which doesn't fit in an int field.
+func integers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = integers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = integers(item)
+		}
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < math.MaxInt64 {
+			return int64(v)
+		}
+	}
+
+	return v
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// decoder turns the contents of a config file into a generic document.
+type decoder func([]byte) (map[string]interface{}, error)
+
+// Filenames are the names of the config files envctl looks for, in order of
+// preference, when more than one of them is in the same directory.
+var Filenames = []string{
+	Filename,
+	"envctl.yml",
+	"envctl.toml",
+	"envctl.json",
+	"envctl.hcl",
+}
+
+// NewLoader returns the Loader for the config file at `path`, picked by the
+// file's extension. The loader selects `profile`, unless it's empty.
+func NewLoader(path, profile string) (Loader, error) {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		return YAML{Path: path, Profile: profile}, nil
+	case ".toml":
+		return TOML{Path: path, Profile: profile}, nil
+	case ".json":
+		return JSON{Path: path, Profile: profile}, nil
+	case ".hcl":
+		return HCL{Path: path, Profile: profile}, nil
+	default:
+		return nil, fmt.Errorf("unsupported config file format %q", ext)
+	}
+}
+
+// lineRef matches the line numbers in yaml errors.
+var lineRef = regexp.MustCompile(`line \d+: `)
+
+// decoderFor returns the decoder for the config file at `path`, picked by the
+// file's extension.
+func decoderFor(path string) (decoder, error) {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		return decodeYAML, nil
+	case ".toml":
+		return decodeTOML, nil
+	case ".json":
+		return decodeJSON, nil
+	case ".hcl":
+		return decodeHCL, nil
+	default:
+		return nil, fmt.Errorf("unsupported config file format %q", ext)
+	}
+}
+
+// load reads the config file at `path` with `decode`, along with the files it
+// extends and its local overlay, selects `profile`, expands the variables in it
+// from the environment, and turns the result into an `Opts`, which lists the
+// files that were read in its Sources.
+func load(path string, decode decoder, profile string) (Opts, error) {
+	sources := []string{}
+	read := func(path string, decode decoder) (map[string]interface{}, error) {
+		sources = append(sources, path)
+		return readFile(path, decode)
+	}
+
+	doc, err := resolveWith(path, decode, read)
+	if err != nil {
+		return Opts{}, err
+	}
+
+	doc, err = doc.WithProfile(profile)
+	if err != nil {
+		return Opts{}, err
+	}
+
+	doc, err = doc.Interpolate(os.LookupEnv)
+	if err != nil {
+		return Opts{}, err
+	}
+
+	cfg, err := doc.absPaths("env_files").Opts()
+	if err != nil {
+		return Opts{}, fmt.Errorf("%v: %v", path, err)
+	}
+
+	cfg.Profile = profile
+	cfg.Sources = sources
+	return cfg, nil
+}
+
+// finalize checks that everything that should be in `cfg` is there, and fills
+// in the defaults for whatever was left out. It's the same for every format.
+func finalize(cfg Opts) (Opts, error) {
+	if cfg.Image == "" {
+		return Opts{}, errors.New("missing image")
+	}
+
+	if cfg.Shell == "" {
+		return Opts{}, errors.New("missing shell")
+	}
+
+	if _, err := cfg.Resources.Parse(); err != nil {
+		return Opts{}, fmt.Errorf("resources: %v", err)
+	}
+
+	if cfg.CacheImage == nil {
+		cfg.CacheImage = CacheImage
+	}
+
+	if cfg.User == "" {
+		cfg.User = "root"
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/winiceo/genv/test_pkg"
+)
+
+// writeConfig writes `contents` to a file called `name` in a new temp dir and
+// returns its path. The caller is responsible for removing the dir.
+func writeConfig(t test_pkg.T, name, contents string) string {
+	dir, err := ioutil.TempDir("", "envctl-config")
+	if err != nil {
+		t.Fatal("creating temp dir", nil, err)
+	}
+
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal("writing config", nil, err)
+	}
+
+	return path
+}
+
+func TestLoadFormats(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	files := map[string]string{
+		"envctl.yaml": `---
+image: ubuntu:latest
+shell: /bin/bash
+bootstrap:
+- make deps
+variables:
+  FOO: bar
+ports:
+  tcp:
+  - 4567
+`,
+		"envctl.toml": `
+image = "ubuntu:latest"
+shell = "/bin/bash"
+bootstrap = ["make deps"]
+
+[variables]
+FOO = "bar"
+
+[ports]
+tcp = [4567]
+`,
+		"envctl.json": `{
+  "image": "ubuntu:latest",
+  "shell": "/bin/bash",
+  "bootstrap": ["make deps"],
+  "variables": {"FOO": "bar"},
+  "ports": {"tcp": [4567]}
+}`,
+		"envctl.hcl": `
+image = "ubuntu:latest"
+shell = "/bin/bash"
+bootstrap = ["make deps"]
+
+variables {
+  FOO = "bar"
+}
+
+ports {
+  tcp = [4567]
+}
+`,
+	}
+
+	expected := Opts{
+		Version:    Version,
+		Image:      "ubuntu:latest",
+		Shell:      "/bin/bash",
+		User:       "root",
+		CacheImage: CacheImage,
+		Bootstrap:  []Step{{Run: "make deps"}},
+		Variables:  map[string]string{"FOO": "bar"},
+		Ports:      L3Ports{"tcp": []PortSpec{"4567"}},
+	}
+
+	for name, contents := range files {
+		path := writeConfig(t, name, contents)
+		defer os.RemoveAll(filepath.Dir(path))
+
+		l, err := NewLoader(path, "")
+		if err != nil {
+			t.Fatal("picking loader for "+name, nil, err)
+		}
+
+		actual, err := l.Load()
+		if err != nil {
+			t.Fatal("loading "+name, nil, err)
+		}
+
+		expected.Sources = []string{path}
+		if !reflect.DeepEqual(expected, actual) {
+			t.Fatal("loaded "+name, expected, actual)
+		}
+	}
+}
+
+func TestLoadUnknownKey(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	path := writeConfig(t, "envctl.json", `{
+  "image": "ubuntu:latest",
+  "shell": "/bin/bash",
+  "imagee": "typo"
+}`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	_, err := JSON{Path: path}.Load()
+	if err == nil || !strings.Contains(err.Error(), "field imagee not found") {
+		t.Fatal("unknown key error", "field imagee not found", err)
+	}
+
+	if strings.Contains(err.Error(), "line") {
+		t.Fatal("unknown key error", "no line numbers", err)
+	}
+}
+
+func TestLoadUnsupportedFormat(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	if _, err := NewLoader("envctl.ini", ""); err == nil {
+		t.Fatal("loader for envctl.ini", "an error", err)
+	}
+}
@@ -0,0 +1,343 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+)
+
+// location is where a key or a list item is in a config file. Lines and columns
+// start at 1. ValueColumn is 0 when the value isn't on the same line, e.g. for
+// maps and lists.
+type location struct {
+	Line        int
+	Column      int
+	ValueColumn int
+}
+
+// locations maps the paths of the values in a config file, like "ports.tcp.0",
+// to where they are in the file.
+type locations map[string]location
+
+// find returns the location of `path`, or of its closest parent that has one
+// if it can't be found, e.g. for a list item written on the same line as its
+// key. It returns false if nothing along the way can be found.
+func (l locations) find(path string) (location, bool) {
+	for {
+		if loc, ok := l[path]; ok {
+			return loc, true
+		}
+
+		i := strings.LastIndex(path, ".")
+		if i < 0 {
+			return location{}, false
+		}
+
+		path = path[:i]
+	}
+}
+
+// joinPath adds `key` to the end of `path`.
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+// yamlFrame is a map or a list the YAML locator is in the middle of.
+type yamlFrame struct {
+	indent int
+	path   string
+	list   bool
+	index  int
+}
+
+// locateYAML finds where everything in a YAML file is. It isn't a YAML parser,
+// and doesn't need to be: the file has already been decoded by the time it's
+// located, so it only has to follow the indentation of block style maps and
+// lists. Flow style lists on a single line are located item by item, anything
+// else in flow style is located as a whole.
+func locateYAML(raw []byte) locations {
+	locs := locations{}
+
+	var stack []yamlFrame
+	var pending *yamlFrame
+	blockIndent := -1
+
+	for n, line := range strings.Split(string(raw), "\n") {
+		lineno := n + 1
+		line = strings.TrimRight(line, " \t\r")
+
+		trimmed := strings.TrimLeft(line, " ")
+		indent := len(line) - len(trimmed)
+
+		// The lines of block scalars are more indented than their key.
+		if blockIndent >= 0 {
+			if trimmed == "" || indent > blockIndent {
+				continue
+			}
+
+			blockIndent = -1
+		}
+
+		if trimmed == "" || trimmed[0] == '#' || trimmed == "---" || trimmed == "..." {
+			continue
+		}
+
+		dash := trimmed == "-" || strings.HasPrefix(trimmed, "- ")
+
+		// A key with nothing after it is followed by its value on the lines
+		// after it, as long as they're indented more. Lists are the exception,
+		// since their dashes can line up with the key.
+		if pending != nil {
+			if indent > pending.indent || (dash && indent == pending.indent) {
+				stack = append(stack, yamlFrame{
+					indent: indent,
+					path:   pending.path,
+					list:   dash,
+					index:  -1,
+				})
+			}
+
+			pending = nil
+		}
+
+		for len(stack) > 0 {
+			top := stack[len(stack)-1]
+			if top.indent < indent || (top.indent == indent && top.list == dash) {
+				break
+			}
+
+			stack = stack[:len(stack)-1]
+		}
+
+		if len(stack) == 0 {
+			stack = append(stack, yamlFrame{indent: indent, list: dash, index: -1})
+		}
+
+		col := indent
+		for {
+			top := &stack[len(stack)-1]
+
+			if top.list {
+				if !dash {
+					break
+				}
+
+				top.index++
+				path := joinPath(top.path, strconv.Itoa(top.index))
+
+				rest := strings.TrimLeft(strings.TrimPrefix(trimmed, "-"), " ")
+				restCol := col + (len(trimmed) - len(rest))
+				locs[path] = location{Line: lineno, Column: col + 1}
+
+				if rest == "" || rest[0] == '#' {
+					pending = &yamlFrame{indent: col, path: path}
+					break
+				}
+
+				if _, _, ok := splitKey(rest); ok {
+					// A map in a list starts on the same line as the dash.
+					stack = append(stack, yamlFrame{indent: restCol, path: path, index: -1})
+					trimmed = rest
+					col = restCol
+					dash = false
+					continue
+				}
+
+				if strings.HasPrefix(rest, "- ") || rest == "-" {
+					stack = append(stack, yamlFrame{indent: restCol, path: path, list: true, index: -1})
+					trimmed = rest
+					col = restCol
+					continue
+				}
+
+				locs[path] = location{Line: lineno, Column: col + 1, ValueColumn: restCol + 1}
+				locateFlow(locs, path, rest, lineno, restCol)
+				break
+			}
+
+			if dash {
+				break
+			}
+
+			key, value, ok := splitKey(trimmed)
+			if !ok {
+				break
+			}
+
+			path := joinPath(top.path, key)
+			valueCol := col + len(trimmed) - len(value)
+
+			switch {
+			case value == "" || value[0] == '#':
+				locs[path] = location{Line: lineno, Column: col + 1}
+				pending = &yamlFrame{indent: col, path: path}
+			case value[0] == '|' || value[0] == '>':
+				locs[path] = location{Line: lineno, Column: col + 1, ValueColumn: valueCol + 1}
+				blockIndent = col
+			default:
+				locs[path] = location{Line: lineno, Column: col + 1, ValueColumn: valueCol + 1}
+				locateFlow(locs, path, value, lineno, valueCol)
+			}
+
+			break
+		}
+	}
+
+	return locs
+}
+
+// splitKey splits a "key: value" line into its key and value. The value is
+// empty when there's nothing after the colon.
+func splitKey(s string) (string, string, bool) {
+	if s == "" {
+		return "", "", false
+	}
+
+	// Quoted keys can have anything in them, including colons.
+	if s[0] == '"' || s[0] == '\'' {
+		end := strings.IndexByte(s[1:], s[0])
+		if end < 0 {
+			return "", "", false
+		}
+
+		key := s[1 : end+1]
+		rest := strings.TrimLeft(s[end+2:], " ")
+		if !strings.HasPrefix(rest, ":") {
+			return "", "", false
+		}
+
+		return key, strings.TrimLeft(rest[1:], " "), true
+	}
+
+	if s[0] == '[' || s[0] == '{' {
+		return "", "", false
+	}
+
+	for i := 0; i < len(s); i++ {
+		if s[i] == ':' && (i == len(s)-1 || s[i+1] == ' ') {
+			return strings.TrimSpace(s[:i]), strings.TrimLeft(s[i+1:], " "), true
+		}
+
+		if s[i] == ' ' && i+1 < len(s) && s[i+1] == '#' {
+			break
+		}
+	}
+
+	return "", "", false
+}
+
+// locateFlow locates the items of a flow style list that starts and ends on
+// a single line, like "[80, 443]".
+func locateFlow(locs locations, path, value string, lineno, col int) {
+	if !strings.HasPrefix(value, "[") {
+		return
+	}
+
+	end := strings.LastIndex(value, "]")
+	if end < 0 {
+		return
+	}
+
+	index := 0
+	start := 1
+	depth := 0
+	for i := 1; i <= end; i++ {
+		switch value[i] {
+		case '[', '{':
+			depth++
+			continue
+		case ']', '}':
+			if depth > 0 {
+				depth--
+				continue
+			}
+		case ',':
+			if depth > 0 {
+				continue
+			}
+		default:
+			continue
+		}
+
+		item := value[start:i]
+		if trimmed := strings.TrimLeft(item, " "); trimmed != "" {
+			itemCol := col + start + len(item) - len(trimmed)
+			locs[joinPath(path, strconv.Itoa(index))] = location{
+				Line:        lineno,
+				Column:      itemCol + 1,
+				ValueColumn: itemCol + 1,
+			}
+			index++
+		}
+
+		start = i + 1
+	}
+}
+
+// locateKeys finds where the keys in a config file are, for the formats that
+// aren't YAML. It's a lot less thorough than locateYAML: it looks for each key
+// along a path after the line its parent key is on, and doesn't try to locate
+// list items at all.
+func locateKeys(raw []byte, paths []string) locations {
+	lines := strings.Split(string(raw), "\n")
+	locs := locations{}
+
+	for _, path := range paths {
+		from := 0
+		parent := ""
+		for _, key := range strings.Split(path, ".") {
+			if _, err := strconv.Atoi(key); err == nil {
+				break
+			}
+
+			parent = joinPath(parent, key)
+			if loc, ok := locs[parent]; ok {
+				from = loc.Line
+				continue
+			}
+
+			loc, ok := findKey(lines, key, from)
+			if !ok {
+				break
+			}
+
+			locs[parent] = loc
+			from = loc.Line
+		}
+	}
+
+	return locs
+}
+
+// findKey finds the first line from line `from` on where `key` is used as a
+// key, quoted or not, followed by the usual separators of the config formats.
+func findKey(lines []string, key string, from int) (location, bool) {
+	candidates := []string{`"` + key + `"`, key}
+
+	for i := from; i < len(lines); i++ {
+		line := lines[i]
+		for _, candidate := range candidates {
+			col := strings.Index(line, candidate)
+			if col < 0 {
+				continue
+			}
+
+			// The key has to be a whole word, e.g. "image" in "cache_image"
+			// isn't a match.
+			if col > 0 && isNameChar(line[col-1]) {
+				continue
+			}
+
+			rest := strings.TrimLeft(line[col+len(candidate):], " \t")
+			if rest == "" || strings.ContainsAny(rest[:1], ":={]") ||
+				(strings.HasPrefix(strings.TrimSpace(line[:col]), "[") && !isNameChar(rest[0])) {
+				return location{Line: i + 1, Column: col + 1}, true
+			}
+		}
+	}
+
+	return location{}, false
+}
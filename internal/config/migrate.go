@@ -0,0 +1,334 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	toml "github.com/pelletier/go-toml"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Version is the version of the config format this envctl understands. Files
+// without a version are version 1, the format from before versions existed.
+const Version = 2
+
+// migration upgrades a config file from one version of the format to the
+// next.
+type migration struct {
+	// upgrade upgrades a decoded config, or one of its profiles, in place.
+	upgrade func(opts map[string]interface{})
+	// rewrite upgrades the YAML text of a config file at the paths `locs`
+	// points into, so that comments and formatting can be kept. `doc` is the
+	// file as it was decoded, before it's upgraded.
+	rewrite func(lines []string, doc map[string]interface{}, locs locations) ([]string, error)
+}
+
+// migrations holds the migration from each version to the next, starting with
+// the one from version 1 to version 2.
+var migrations = []migration{
+	// Version 2 turns bootstrap steps from plain commands into steps with
+	// settings of their own, like the user they run as.
+	{upgrade: upgradeSteps, rewrite: rewriteSteps},
+}
+
+// fileVersion returns the version of the decoded config file `doc`.
+func fileVersion(doc map[string]interface{}) (int, error) {
+	v, ok := doc["version"]
+	if !ok {
+		return 1, nil
+	}
+
+	version, ok := toInt(v)
+	if !ok || version < 1 {
+		return 0, fmt.Errorf("version should be a whole number, not %v", v)
+	}
+
+	if version > Version {
+		return 0, fmt.Errorf(
+			"version %v is newer than this envctl supports (%v), try upgrading envctl",
+			version, Version,
+		)
+	}
+
+	return version, nil
+}
+
+// migrate upgrades the decoded config file `doc` to the current version, along
+// with its profiles. It returns whether anything had to be upgraded.
+func migrate(doc map[string]interface{}) (bool, error) {
+	version, err := fileVersion(doc)
+	if err != nil {
+		return false, err
+	}
+
+	if version == Version {
+		return false, nil
+	}
+
+	for _, m := range migrations[version-1:] {
+		m.upgrade(doc)
+
+		profiles, _ := doc["profiles"].(map[string]interface{})
+		for _, profile := range profiles {
+			if opts, ok := profile.(map[string]interface{}); ok {
+				m.upgrade(opts)
+			}
+		}
+	}
+
+	doc["version"] = Version
+	return true, nil
+}
+
+func upgradeSteps(opts map[string]interface{}) {
+	steps, ok := opts["bootstrap"].([]interface{})
+	if !ok {
+		return
+	}
+
+	for i, step := range steps {
+		if i == 0 && step == ReplaceMarker {
+			continue
+		}
+
+		if run, ok := step.(string); ok {
+			steps[i] = map[string]interface{}{"run": run}
+		}
+	}
+}
+
+// rewriteSteps turns each plain bootstrap step into a step with "run: ".
+func rewriteSteps(
+	lines []string,
+	doc map[string]interface{},
+	locs locations,
+) ([]string, error) {
+	lists := map[string]interface{}{"bootstrap": doc["bootstrap"]}
+
+	profiles, _ := doc["profiles"].(map[string]interface{})
+	for name, profile := range profiles {
+		if opts, ok := profile.(map[string]interface{}); ok {
+			lists["profiles."+name+".bootstrap"] = opts["bootstrap"]
+		}
+	}
+
+	edits := []location{}
+	for path, list := range lists {
+		steps, ok := list.([]interface{})
+		if !ok {
+			continue
+		}
+
+		loc, ok := locs[path]
+		if !ok {
+			return nil, fmt.Errorf("can't find %v", path)
+		}
+
+		// Lists written on a single line are rewritten as a whole.
+		if loc.ValueColumn > 0 {
+			items := []string{}
+			for i, step := range steps {
+				if i == 0 && step == ReplaceMarker {
+					items = append(items, scalar(step))
+				} else {
+					items = append(items, fmt.Sprintf("{run: %v}", scalar(step)))
+				}
+			}
+
+			line := lines[loc.Line-1]
+			lines[loc.Line-1] = line[:loc.ValueColumn-1] + "[" + strings.Join(items, ", ") + "]"
+			continue
+		}
+
+		for i, step := range steps {
+			if s, ok := step.(string); !ok || (i == 0 && s == ReplaceMarker) {
+				continue
+			}
+
+			itemPath := joinPath(path, strconv.Itoa(i))
+			itemLoc, ok := locs[itemPath]
+			if !ok || itemLoc.ValueColumn == 0 {
+				return nil, fmt.Errorf("can't find %v", itemPath)
+			}
+
+			edits = append(edits, itemLoc)
+		}
+	}
+
+	// Later lines are rewritten first, so the lines of the block scalars
+	// that are reindented have all been rewritten already.
+	sort.Slice(edits, func(i, j int) bool { return edits[i].Line > edits[j].Line })
+
+	for _, loc := range edits {
+		n := loc.Line - 1
+		line := lines[n]
+		value := line[loc.ValueColumn-1:]
+		lines[n] = line[:loc.ValueColumn-1] + "run: " + value
+
+		// The lines of a block scalar have to be indented past the new key.
+		if strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">") {
+			for j := n + 1; j < len(lines); j++ {
+				trimmed := strings.TrimLeft(lines[j], " ")
+				indent := len(lines[j]) - len(trimmed)
+				if trimmed != "" && indent < loc.Column {
+					break
+				}
+
+				if trimmed != "" {
+					lines[j] = "  " + lines[j]
+				}
+			}
+		}
+	}
+
+	return lines, nil
+}
+
+// Migrate upgrades the config file `raw`, which is at `path`, to the current
+// version of the format, and returns the upgraded file. It returns the file as
+// it is when it's already up to date.
+//
+// YAML files keep their comments and formatting. JSON and TOML files are
+// written out again from scratch, and HCL files can't be written at all, but
+// they're still upgraded whenever they're loaded.
+func Migrate(path string, raw []byte) ([]byte, error) {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		return migrateYAML(raw)
+	case ".json":
+		return migrateWith(raw, decodeJSON, func(doc map[string]interface{}) ([]byte, error) {
+			out, err := json.MarshalIndent(doc, "", "  ")
+			return append(out, '\n'), err
+		})
+	case ".toml":
+		return migrateWith(raw, decodeTOML, func(doc map[string]interface{}) ([]byte, error) {
+			tree, err := toml.TreeFromMap(doc)
+			if err != nil {
+				return nil, err
+			}
+
+			out, err := tree.ToTomlString()
+			return []byte(out), err
+		})
+	default:
+		return nil, fmt.Errorf("can't rewrite %v config files", ext)
+	}
+}
+
+// migrateWith upgrades the config file `raw` by decoding it with `decode` and
+// encoding the upgraded document with `encode`.
+func migrateWith(
+	raw []byte,
+	decode decoder,
+	encode func(map[string]interface{}) ([]byte, error),
+) ([]byte, error) {
+	decoded, err := decode(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := stringKeys(decoded).(map[string]interface{})
+
+	migrated, err := migrate(doc)
+	if err != nil || !migrated {
+		return raw, err
+	}
+
+	return encode(doc)
+}
+
+// migrateYAML upgrades a YAML config file by rewriting its text, so that
+// comments and formatting are kept.
+func migrateYAML(raw []byte) ([]byte, error) {
+	decoded, err := decodeYAML(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := stringKeys(decoded).(map[string]interface{})
+
+	version, err := fileVersion(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if version == Version {
+		return raw, nil
+	}
+
+	lines := strings.Split(string(raw), "\n")
+	for _, m := range migrations[version-1:] {
+		lines, err = m.rewrite(lines, doc, locateYAML([]byte(strings.Join(lines, "\n"))))
+		if err != nil {
+			return nil, err
+		}
+
+		next, err := decodeYAML([]byte(strings.Join(lines, "\n")))
+		if err != nil {
+			return nil, fmt.Errorf("migrating: %v", err)
+		}
+		doc = stringKeys(next).(map[string]interface{})
+	}
+
+	lines = setVersion(lines, locateYAML([]byte(strings.Join(lines, "\n"))))
+	out := []byte(strings.Join(lines, "\n"))
+
+	// Make sure the text that was rewritten means the same as upgrading the
+	// file in memory does, so a file is never left broken.
+	expected := stringKeys(decoded).(map[string]interface{})
+	if _, err := migrate(expected); err != nil {
+		return nil, err
+	}
+
+	actual, err := decodeYAML(out)
+	if err != nil {
+		return nil, fmt.Errorf("migrating: %v", err)
+	}
+
+	if !reflect.DeepEqual(normalize(expected), normalize(stringKeys(actual))) {
+		return nil, fmt.Errorf("migrating: the file is too unusual to rewrite, " +
+			"please upgrade it by hand")
+	}
+
+	return out, nil
+}
+
+// setVersion sets the version at the top of a YAML config file.
+func setVersion(lines []string, locs locations) []string {
+	line := fmt.Sprintf("version: %v", Version)
+
+	if loc, ok := locs["version"]; ok {
+		lines[loc.Line-1] = line
+		return lines
+	}
+
+	at := 0
+	if len(lines) > 0 && strings.TrimSpace(lines[0]) == "---" {
+		at = 1
+	}
+
+	out := append([]string{}, lines[:at]...)
+	out = append(out, line, "")
+	return append(out, lines[at:]...)
+}
+
+// normalize makes two decoded documents comparable, by turning every number
+// into an int.
+func normalize(v interface{}) interface{} {
+	buf, err := yaml.Marshal(v)
+	if err != nil {
+		return v
+	}
+
+	var out interface{}
+	if err := yaml.Unmarshal(buf, &out); err != nil {
+		return v
+	}
+
+	return out
+}
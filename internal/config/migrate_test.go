@@ -0,0 +1,104 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/winiceo/genv/test_pkg"
+)
+
+func TestMigrateYAML(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	in := `---
+# The environment for the app.
+image: ubuntu:latest
+shell: /bin/bash
+
+bootstrap:
+# Dependencies first.
+- make deps  # this takes a while
+- "echo 'quoted: step'"
+- |
+  echo multi
+  echo line
+
+profiles:
+  ci:
+    bootstrap: [(replace), make ci]
+`
+
+	expected := `---
+version: 2
+
+# The environment for the app.
+image: ubuntu:latest
+shell: /bin/bash
+
+bootstrap:
+# Dependencies first.
+- run: make deps  # this takes a while
+- run: "echo 'quoted: step'"
+- run: |
+    echo multi
+    echo line
+
+profiles:
+  ci:
+    bootstrap: [(replace), {run: make ci}]
+`
+
+	actual, err := Migrate("envctl.yaml", []byte(in))
+	if err != nil {
+		t.Fatal("migrating", nil, err)
+	}
+
+	if expected != string(actual) {
+		t.Fatal("migrated config", expected, string(actual))
+	}
+
+	again, err := Migrate("envctl.yaml", actual)
+	if err != nil {
+		t.Fatal("migrating again", nil, err)
+	}
+
+	if string(again) != string(actual) {
+		t.Fatal("migrating an up to date config", string(actual), string(again))
+	}
+}
+
+func TestMigrateJSON(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	in := `{"image": "ubuntu", "shell": "/bin/sh", "bootstrap": ["make deps"]}`
+
+	expected := `{
+  "bootstrap": [
+    {
+      "run": "make deps"
+    }
+  ],
+  "image": "ubuntu",
+  "shell": "/bin/sh",
+  "version": 2
+}
+`
+
+	actual, err := Migrate("envctl.json", []byte(in))
+	if err != nil {
+		t.Fatal("migrating", nil, err)
+	}
+
+	if expected != string(actual) {
+		t.Fatal("migrated config", expected, string(actual))
+	}
+}
+
+func TestMigrateNewerVersion(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	_, err := Migrate("envctl.yaml", []byte("version: 99\nimage: ubuntu\n"))
+	if err == nil || !strings.Contains(err.Error(), "newer than this envctl supports") {
+		t.Fatal("migrating a newer config", "newer than this envctl supports", err)
+	}
+}
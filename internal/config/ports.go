@@ -0,0 +1,152 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// DefaultHostIP is the host address ports are bound to unless a port spec
+// says otherwise. Binding to every interface would expose the environment to
+// the whole network.
+const DefaultHostIP = "127.0.0.1"
+
+// PortSpec maps container ports to host ports, written the way docker writes
+// them:
+//
+// - "80" or 80 maps port 80 in the container to port 80 on the host
+// - "8080:80" maps port 80 in the container to port 8080 on the host
+// - "0.0.0.0:8080:80" does the same, but on every interface of the host
+// - "9000-9010" maps a range of ports, and "8000-8010:9000-9010" maps a range
+//   onto a different one of the same size
+// - "auto:3000" maps port 3000 in the container to whatever port on the host
+//   is free when the environment is created
+//
+// Ports are bound to DefaultHostIP unless a host address is given.
+type PortSpec string
+
+// AutoPort is the host port of a PortSpec that lets envctl pick a free port.
+const AutoPort = "auto"
+
+// PortRange is a parsed PortSpec. The host ports are 0 when Auto is set.
+type PortRange struct {
+	HostIP    string
+	HostStart int
+	HostEnd   int
+	Start     int
+	End       int
+	Auto      bool
+}
+
+// UnmarshalYAML accepts port specs as both numbers and strings, and checks
+// them as they're decoded.
+func (p *PortSpec) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v interface{}
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+
+	switch v.(type) {
+	case map[interface{}]interface{}, []interface{}, nil:
+		return fmt.Errorf("port %v should be a number or a string", v)
+	}
+
+	spec := PortSpec(fmt.Sprintf("%v", v))
+	if _, err := spec.Parse(); err != nil {
+		return err
+	}
+
+	*p = spec
+	return nil
+}
+
+// Parse parses the PortSpec.
+func (p PortSpec) Parse() (PortRange, error) {
+	s := strings.TrimSpace(string(p))
+
+	r := PortRange{HostIP: DefaultHostIP}
+	host, container := "", s
+
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		host, container = s[:i], s[i+1:]
+
+		// What's before the host port is the address, which can be an IPv6
+		// address in brackets.
+		if j := strings.LastIndex(host, ":"); j >= 0 {
+			ip := strings.TrimSuffix(strings.TrimPrefix(host[:j], "["), "]")
+			if net.ParseIP(ip) == nil {
+				return PortRange{}, fmt.Errorf("port %q has an invalid host address %q", s, ip)
+			}
+
+			r.HostIP, host = ip, host[j+1:]
+		}
+
+		if host == "" {
+			return PortRange{}, fmt.Errorf("port %q is missing its host port", s)
+		}
+	}
+
+	var err error
+	r.Start, r.End, err = parseRange(container)
+	if err != nil {
+		return PortRange{}, fmt.Errorf("port %q: %v", s, err)
+	}
+
+	r.HostStart, r.HostEnd = r.Start, r.End
+	if host == AutoPort {
+		r.HostStart, r.HostEnd, r.Auto = 0, 0, true
+	} else if host != "" {
+		r.HostStart, r.HostEnd, err = parseRange(host)
+		if err != nil {
+			return PortRange{}, fmt.Errorf("port %q: %v", s, err)
+		}
+
+		if r.HostEnd-r.HostStart != r.End-r.Start {
+			return PortRange{}, fmt.Errorf(
+				"port %q maps %v host ports onto %v container ports",
+				s, r.HostEnd-r.HostStart+1, r.End-r.Start+1,
+			)
+		}
+	}
+
+	return r, nil
+}
+
+// parseRange parses a port, or a range of ports like "9000-9010".
+func parseRange(s string) (int, int, error) {
+	parts := strings.SplitN(s, "-", 2)
+
+	start, err := parsePort(parts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if len(parts) == 1 {
+		return start, start, nil
+	}
+
+	end, err := parsePort(parts[1])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if end < start {
+		return 0, 0, fmt.Errorf("range %v ends before it starts", s)
+	}
+
+	return start, end, nil
+}
+
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%q isn't a port number", s)
+	}
+
+	if port < 1 || port > 65535 {
+		return 0, fmt.Errorf("%v is out of range, should be between 1 and 65535", port)
+	}
+
+	return port, nil
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/winiceo/genv/test_pkg"
+)
+
+func TestParsePortSpec(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	cases := map[PortSpec]PortRange{
+		"80":                  {HostIP: "127.0.0.1", HostStart: 80, HostEnd: 80, Start: 80, End: 80},
+		"8080:80":             {HostIP: "127.0.0.1", HostStart: 8080, HostEnd: 8080, Start: 80, End: 80},
+		"0.0.0.0:5432:5432":   {HostIP: "0.0.0.0", HostStart: 5432, HostEnd: 5432, Start: 5432, End: 5432},
+		"[::1]:8080:80":       {HostIP: "::1", HostStart: 8080, HostEnd: 8080, Start: 80, End: 80},
+		"9000-9010":           {HostIP: "127.0.0.1", HostStart: 9000, HostEnd: 9010, Start: 9000, End: 9010},
+		"8000-8002:9000-9002": {HostIP: "127.0.0.1", HostStart: 8000, HostEnd: 8002, Start: 9000, End: 9002},
+		"auto:3000":           {HostIP: "127.0.0.1", Start: 3000, End: 3000, Auto: true},
+		"0.0.0.0:auto:3000":   {HostIP: "0.0.0.0", Start: 3000, End: 3000, Auto: true},
+	}
+
+	for spec, expected := range cases {
+		actual, err := spec.Parse()
+		if err != nil {
+			t.Fatal(string(spec), nil, err)
+		}
+
+		if expected != actual {
+			t.Fatal(string(spec), expected, actual)
+		}
+	}
+}
+
+func TestParsePortSpecErrors(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	cases := map[PortSpec]string{
+		"70000":           `port "70000": 70000 is out of range, should be between 1 and 65535`,
+		"http":            `port "http": "http" isn't a port number`,
+		":80":             `port ":80" is missing its host port`,
+		"localhost:80:80": `port "localhost:80:80" has an invalid host address "localhost"`,
+		"9010-9000":       `port "9010-9000": range 9010-9000 ends before it starts`,
+		"8000-8001:80":    `port "8000-8001:80" maps 2 host ports onto 1 container ports`,
+	}
+
+	for spec, expected := range cases {
+		_, err := spec.Parse()
+		if err == nil || err.Error() != expected {
+			t.Fatal(string(spec), expected, err)
+		}
+	}
+}
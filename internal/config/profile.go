@@ -0,0 +1,41 @@
+package config
+
+import "fmt"
+
+// WithProfile returns the Document with the profile called `name` merged onto
+// it, following the same rules as extending a file. An empty name selects no
+// profile. Either way, the profiles themselves are left out of the result.
+func (d Document) WithProfile(name string) (Document, error) {
+	root := map[string]interface{}{}
+	for k, v := range d.root {
+		if k != "profiles" {
+			root[k] = v
+		}
+	}
+
+	if name == "" {
+		return Document{root: root, dir: d.dir}, nil
+	}
+
+	profiles, _ := d.root["profiles"].(map[string]interface{})
+	profile, ok := profiles[name]
+	if !ok {
+		return Document{}, fmt.Errorf("unknown profile %q", name)
+	}
+
+	// A profile that's there but empty doesn't change anything.
+	overlay, ok := profile.(map[string]interface{})
+	if !ok {
+		return Document{root: root, dir: d.dir}, nil
+	}
+
+	for _, key := range []string{"profiles", "extends"} {
+		if _, ok := overlay[key]; ok {
+			return Document{}, fmt.Errorf("profile %q can't set %v", name, key)
+		}
+	}
+
+	root = merge(root, overlay).(map[string]interface{})
+
+	return Document{root: root, dir: d.dir}, nil
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/winiceo/genv/test_pkg"
+)
+
+func TestProfiles(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	dir := writeFiles(t, map[string]string{
+		"envctl.yaml": `---
+image: ruby:2.5
+shell: /bin/bash
+bootstrap:
+- bundle install
+ports:
+  tcp:
+  - 3000
+
+profiles:
+  ci:
+    image: ruby:2.5-slim
+    bootstrap:
+    - (replace)
+    - bundle install --deployment
+  debug:
+    ports:
+      tcp:
+      - 1234
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "envctl.yaml")
+
+	cases := map[string]Opts{
+		"": {
+			Image:     "ruby:2.5",
+			Bootstrap: []Step{{Run: "bundle install"}},
+			Ports:     L3Ports{"tcp": []PortSpec{"3000"}},
+		},
+		"ci": {
+			Image:     "ruby:2.5-slim",
+			Bootstrap: []Step{{Run: "bundle install --deployment"}},
+			Ports:     L3Ports{"tcp": []PortSpec{"3000"}},
+			Profile:   "ci",
+		},
+		"debug": {
+			Image:     "ruby:2.5",
+			Bootstrap: []Step{{Run: "bundle install"}},
+			Ports:     L3Ports{"tcp": []PortSpec{"3000", "1234"}},
+			Profile:   "debug",
+		},
+	}
+
+	for profile, expected := range cases {
+		expected.Version = Version
+		expected.Shell = "/bin/bash"
+		expected.User = "root"
+		expected.CacheImage = CacheImage
+		expected.Sources = []string{path}
+
+		actual, err := YAML{Path: path, Profile: profile}.Load()
+		if err != nil {
+			t.Fatal("loading profile "+profile, nil, err)
+		}
+
+		if !reflect.DeepEqual(expected, actual) {
+			t.Fatal("config with profile "+profile, expected, actual)
+		}
+	}
+
+	if _, err := (YAML{Path: path, Profile: "nope"}).Load(); err == nil {
+		t.Fatal("loading unknown profile", "an error", err)
+	}
+}
@@ -0,0 +1,181 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	units "github.com/docker/go-units"
+)
+
+// Resources limit what the environment can use of the host, so that e.g. a
+// runaway test suite can't take the whole machine with it. Nothing is limited
+// unless it's set. Sizes are written the way docker writes them, like "4g".
+type Resources struct {
+	// CPUs is how many CPUs the environment can use, like 1.5.
+	CPUs string `yaml:"cpus,omitempty"`
+	// Memory is how much memory the environment can use.
+	Memory string `yaml:"memory,omitempty"`
+	// MemorySwap is how much memory and swap the environment can use
+	// together, or -1 to use as much swap as it wants. It needs Memory.
+	MemorySwap string `yaml:"memory_swap,omitempty"`
+	// PidsLimit is how many processes the environment can run, or -1 for as
+	// many as it wants.
+	PidsLimit int `yaml:"pids_limit,omitempty"`
+	// ShmSize is the size of /dev/shm.
+	ShmSize string `yaml:"shm_size,omitempty"`
+	// Ulimits are the ulimits processes start with, by name, either as a
+	// single limit like "1024" or as a soft and a hard one like "1024:2048".
+	Ulimits map[string]string `yaml:"ulimits,omitempty"`
+}
+
+// ResourceLimits are parsed Resources, in the units docker takes them in. Zero
+// values aren't limited.
+type ResourceLimits struct {
+	NanoCPUs   int64
+	Memory     int64
+	MemorySwap int64
+	PidsLimit  int64
+	ShmSize    int64
+	Ulimits    []Ulimit
+}
+
+// Ulimit is a parsed ulimit.
+type Ulimit struct {
+	Name string
+	Soft int64
+	Hard int64
+}
+
+// IsZero returns whether nothing is limited.
+func (r Resources) IsZero() bool {
+	return r.CPUs == "" && r.Memory == "" && r.MemorySwap == "" &&
+		r.PidsLimit == 0 && r.ShmSize == "" && len(r.Ulimits) == 0
+}
+
+// Parse parses the Resources.
+func (r Resources) Parse() (ResourceLimits, error) {
+	l := ResourceLimits{}
+
+	settings := [][2]string{
+		{"cpus", r.CPUs},
+		{"memory", r.Memory},
+		{"memory_swap", r.MemorySwap},
+		{"shm_size", r.ShmSize},
+	}
+
+	if r.PidsLimit != 0 {
+		settings = append(settings, [2]string{"pids_limit", strconv.Itoa(r.PidsLimit)})
+	}
+
+	names := make([]string, 0, len(r.Ulimits))
+	for name := range r.Ulimits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		settings = append(settings, [2]string{"ulimits." + name, r.Ulimits[name]})
+	}
+
+	for _, s := range settings {
+		if s[1] == "" {
+			continue
+		}
+
+		if err := parseResource(&l, s[0], s[1]); err != nil {
+			return ResourceLimits{}, err
+		}
+	}
+
+	if err := checkLimits(l); err != nil {
+		return ResourceLimits{}, err
+	}
+
+	return l, nil
+}
+
+// parseResource parses the resource `key`, which is either one of the
+// settings in Resources or "ulimits.<name>", into `l`.
+func parseResource(l *ResourceLimits, key, value string) error {
+	value = strings.TrimSpace(value)
+
+	if strings.HasPrefix(key, "ulimits.") {
+		name := strings.TrimPrefix(key, "ulimits.")
+
+		u, err := units.ParseUlimit(name + "=" + value)
+		switch {
+		case err == nil:
+		case strings.HasPrefix(err.Error(), "invalid ulimit type"):
+			return fmt.Errorf("unknown ulimit %q", name)
+		case strings.Contains(err.Error(), "soft limit"):
+			return fmt.Errorf("ulimit %v: the soft limit can't be more than the hard limit", name)
+		default:
+			return fmt.Errorf("ulimit %v should be a limit like \"1024\", or a soft and a hard "+
+				"one like \"1024:2048\", not %q", name, value)
+		}
+
+		l.Ulimits = append(l.Ulimits, Ulimit{Name: u.Name, Soft: u.Soft, Hard: u.Hard})
+		return nil
+	}
+
+	switch key {
+	case "cpus":
+		cpus, err := strconv.ParseFloat(value, 64)
+		if err != nil || cpus <= 0 {
+			return fmt.Errorf("cpus should be a number of CPUs like 1.5, not %q", value)
+		}
+
+		l.NanoCPUs = int64(cpus * 1e9)
+	case "memory":
+		return parseSize(&l.Memory, key, value)
+	case "memory_swap":
+		if value == "-1" {
+			l.MemorySwap = -1
+			return nil
+		}
+
+		return parseSize(&l.MemorySwap, key, value)
+	case "shm_size":
+		return parseSize(&l.ShmSize, key, value)
+	case "pids_limit":
+		pids, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || (pids < 1 && pids != -1) {
+			return fmt.Errorf("pids_limit should be a number of processes, or -1, not %q", value)
+		}
+
+		l.PidsLimit = pids
+	default:
+		return fmt.Errorf("unknown resource %v", key)
+	}
+
+	return nil
+}
+
+func parseSize(out *int64, key, value string) error {
+	size, err := units.RAMInBytes(value)
+	if err != nil || size <= 0 {
+		return fmt.Errorf("%v should be a size like \"512m\" or \"4g\", not %q", key, value)
+	}
+
+	*out = size
+	return nil
+}
+
+// checkLimits checks the limits that only make sense together.
+func checkLimits(l ResourceLimits) error {
+	if l.MemorySwap == 0 {
+		return nil
+	}
+
+	if l.Memory == 0 {
+		return fmt.Errorf("memory_swap needs memory to be set too")
+	}
+
+	if l.MemorySwap > 0 && l.MemorySwap < l.Memory {
+		return fmt.Errorf("memory_swap includes memory, so it can't be less than memory")
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/winiceo/genv/test_pkg"
+)
+
+func TestParseResources(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	r := Resources{
+		CPUs:       "1.5",
+		Memory:     "2g",
+		MemorySwap: "-1",
+		PidsLimit:  512,
+		ShmSize:    "256m",
+		Ulimits:    map[string]string{"nofile": "1024:2048", "core": "0"},
+	}
+
+	expected := ResourceLimits{
+		NanoCPUs:   1500000000,
+		Memory:     2 << 30,
+		MemorySwap: -1,
+		PidsLimit:  512,
+		ShmSize:    256 << 20,
+		Ulimits: []Ulimit{
+			{Name: "core", Soft: 0, Hard: 0},
+			{Name: "nofile", Soft: 1024, Hard: 2048},
+		},
+	}
+
+	actual, err := r.Parse()
+	if err != nil {
+		t.Fatal("parsing", nil, err)
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatal("parsing", expected, actual)
+	}
+}
+
+func TestParseResourcesErrors(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	cases := []struct {
+		r   Resources
+		msg string
+	}{
+		{Resources{CPUs: "lots"}, `cpus should be a number of CPUs like 1.5, not "lots"`},
+		{Resources{Memory: "2 gallons"}, `memory should be a size like "512m" or "4g", not "2 gallons"`},
+		{Resources{MemorySwap: "4g"}, "memory_swap needs memory to be set too"},
+		{Resources{Memory: "4g", MemorySwap: "2g"}, "memory_swap includes memory, so it can't be less than memory"},
+		{Resources{PidsLimit: -2}, `pids_limit should be a number of processes, or -1, not "-2"`},
+		{Resources{Ulimits: map[string]string{"files": "10"}}, `unknown ulimit "files"`},
+		{Resources{Ulimits: map[string]string{"nofile": "20:10"}}, "ulimit nofile: the soft limit can't be more than the hard limit"},
+	}
+
+	for _, c := range cases {
+		_, err := c.r.Parse()
+		if err == nil || err.Error() != c.msg {
+			t.Fatal("parsing", c.msg, err)
+		}
+	}
+}
+
+func TestValidateResources(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	dir := writeFiles(t, map[string]string{
+		"envctl.yaml": `---
+image: ubuntu
+shell: /bin/bash
+resources:
+  cpus: 2
+  memory: 2x
+  ulimits:
+    nofile: many
+profiles:
+  ci:
+    resources:
+      memory: 1g
+      memory_swap: 512m
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	problems, err := Validate(filepath.Join(dir, "envctl.yaml"), "")
+	if err != nil {
+		t.Fatal("validating", nil, err)
+	}
+
+	expected := []string{
+		`envctl.yaml:6:11: memory should be a size like "512m" or "4g", not "2x"`,
+		`envctl.yaml:8:13: ulimit nofile should be a limit like "1024", or a soft and a hard one like "1024:2048", not "many"`,
+		"envctl.yaml:13:20: memory_swap includes memory, so it can't be less than memory",
+	}
+
+	actual := problemStrings(problems, dir)
+	if strings.Join(expected, "\n") != strings.Join(actual, "\n") {
+		t.Fatal("problems", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+}
+
+func TestLoadResources(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	path := writeConfig(t, "envctl.yaml", `---
+version: 2
+image: ubuntu
+shell: /bin/bash
+resources:
+  cpus: 2
+  memory: 4g
+  ulimits:
+    nofile: 1024
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	l, err := NewLoader(path, "")
+	if err != nil {
+		t.Fatal("creating loader", nil, err)
+	}
+
+	cfg, err := l.Load()
+	if err != nil {
+		t.Fatal("loading", nil, err)
+	}
+
+	expected := Resources{
+		CPUs:    "2",
+		Memory:  "4g",
+		Ulimits: map[string]string{"nofile": "1024"},
+	}
+
+	if !reflect.DeepEqual(expected, cfg.Resources) {
+		t.Fatal("resources", expected, cfg.Resources)
+	}
+}
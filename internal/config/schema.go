@@ -0,0 +1,157 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// Schema returns a JSON Schema describing config files, for editors to check
+// and complete them with. It's generated from `Opts`, so it can't go stale.
+func Schema() ([]byte, error) {
+	root := schemaFor(reflect.TypeOf(Opts{}))
+	root["$schema"] = "http://json-schema.org/draft-07/schema#"
+	root["title"] = "envctl config"
+
+	// A file that extends another one can leave anything out, but the image
+	// and shell have to come from somewhere.
+	root["anyOf"] = []interface{}{
+		map[string]interface{}{"required": []string{"extends"}},
+		map[string]interface{}{"required": []string{"image", "shell"}},
+	}
+
+	return json.MarshalIndent(root, "", "  ")
+}
+
+// schemaFor returns the schema for values decoded into `t`.
+func schemaFor(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case reflect.TypeOf(L3Ports{}):
+		return portsSchema()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return structSchema(t)
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": schemaFor(t.Elem()),
+		}
+	case reflect.Slice:
+		return listSchema(schemaFor(t.Elem()))
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	}
+
+	return map[string]interface{}{"type": "string"}
+}
+
+// structSchema returns the schema for values decoded into the struct type `t`,
+// leaving out the settings in `skip`.
+func structSchema(t reflect.Type, skip ...string) map[string]interface{} {
+	props := map[string]interface{}{}
+
+fields:
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		for _, s := range skip {
+			if name == s {
+				continue fields
+			}
+		}
+
+		props[name] = fieldSchema(name, field.Type)
+	}
+
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+}
+
+// fieldSchema returns the schema for the setting `name`, with the rules
+// Validate checks that the types alone can't express.
+func fieldSchema(name string, t reflect.Type) map[string]interface{} {
+	if name == "profiles" {
+		// Profiles are configs of their own, minus a few settings.
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": structSchema(t.Elem(), "profiles", "extends"),
+		}
+	}
+
+	s := schemaFor(t)
+
+	switch name {
+	case "image", "shell":
+		s["minLength"] = 1
+	case "mount":
+		s["pattern"] = "^/"
+	case "cpus", "memory", "memory_swap", "shm_size":
+		// These are strings that are usually written as numbers.
+		s["type"] = []string{"string", "number"}
+	case "forward":
+		s = listSchema(map[string]interface{}{"enum": Forwards})
+	case "ulimits":
+		s["additionalProperties"] = map[string]interface{}{
+			"type": []string{"string", "integer"},
+		}
+	}
+
+	return s
+}
+
+// listSchema returns the schema for a list of `item`, which can start with a
+// replace marker.
+func listSchema(item map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "array",
+		"items": map[string]interface{}{
+			"anyOf": []interface{}{
+				item,
+				map[string]interface{}{"const": ReplaceMarker},
+			},
+		},
+	}
+}
+
+func portsSchema() map[string]interface{} {
+	port := map[string]interface{}{
+		"anyOf": []interface{}{
+			map[string]interface{}{
+				"type":    "integer",
+				"minimum": 1,
+				"maximum": 65535,
+			},
+			map[string]interface{}{
+				"type":    "string",
+				"pattern": `^(((\[[0-9a-fA-F:.]+\]|[0-9a-fA-F:.]+):)?(auto|[0-9]+(-[0-9]+)?):)?[0-9]+(-[0-9]+)?$`,
+			},
+		},
+	}
+
+	props := map[string]interface{}{}
+	for _, proto := range Protocols {
+		props[proto] = listSchema(port)
+	}
+
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+}
@@ -0,0 +1,24 @@
+package config
+
+import toml "github.com/pelletier/go-toml"
+
+// TOML is a Loader for a TOML configuration file.
+type TOML struct {
+	Path    string
+	Profile string
+}
+
+// Load returns a new `Opts` by reading the TOML file. It follows the same
+// rules as YAML.Load.
+func (c TOML) Load() (Opts, error) {
+	return load(c.Path, decodeTOML, c.Profile)
+}
+
+func decodeTOML(raw []byte) (map[string]interface{}, error) {
+	tree, err := toml.LoadBytes(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return tree.ToMap(), nil
+}
@@ -0,0 +1,419 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/pkg/term"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// UserConfig is the config of the person using envctl, rather than of a
+// project. It's for personal settings, which don't belong in a project's
+// config file.
+//
+// Resources and Forward are defaults for every project. The project's config
+// takes precedence: each resource limit it sets replaces the default one, and
+// what it forwards is forwarded along with the defaults.
+type UserConfig struct {
+	// DockerHost is the Docker daemon to use, unless DOCKER_HOST is set.
+	DockerHost string    `yaml:"docker_host,omitempty"`
+	Resources  Resources `yaml:"resources,omitempty"`
+	Forward    []string  `yaml:"forward,omitempty"`
+	Dotfiles   Dotfiles  `yaml:"dotfiles,omitempty"`
+	// Output is the format commands like "envctl status" print in, out of
+	// Outputs.
+	Output string `yaml:"output,omitempty"`
+	// RegistryMirror is a registry that mirrors Docker Hub, to pull the base
+	// images on Docker Hub from instead, like "mirror.example.com".
+	RegistryMirror string `yaml:"registry_mirror,omitempty"`
+	// DetachKeys is the key sequence that detaches from a login session,
+	// instead of DefaultDetachKeys.
+	DetachKeys string `yaml:"detach_keys,omitempty"`
+}
+
+// DefaultDetachKeys is the key sequence that detaches from a login session,
+// unless another one is set. It's the same as Docker's.
+const DefaultDetachKeys = "ctrl-p,ctrl-q"
+
+// CheckDetachKeys checks that `keys` is a key sequence Docker can detach on,
+// written like DefaultDetachKeys.
+func CheckDetachKeys(keys string) error {
+	if _, err := term.ToBytes(keys); err != nil || keys == "" {
+		return fmt.Errorf("detach keys %q aren't valid, should be like %q",
+			keys, DefaultDetachKeys)
+	}
+
+	return nil
+}
+
+// Outputs are the formats commands can print in.
+var Outputs = []string{"text", "json"}
+
+// Dotfiles are personal files copied into the home directory of every
+// environment once it's bootstrapped.
+type Dotfiles struct {
+	// Path is a directory on the host, or the URL of a git repo that's cloned
+	// to the host first.
+	Path string `yaml:"path,omitempty"`
+	// Install is a command run in the home directory once the files have been
+	// copied, e.g. to link them into place.
+	Install string `yaml:"install,omitempty"`
+}
+
+// UserConfigPath returns where the user config is, in $XDG_CONFIG_HOME/envctl.
+func UserConfigPath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+
+		dir = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(dir, "envctl", "config.yaml"), nil
+}
+
+// LoadUserConfig loads the user config. Not having one is the same as having an
+// empty one.
+func LoadUserConfig() (UserConfig, error) {
+	path, err := UserConfigPath()
+	if err != nil {
+		return UserConfig{}, err
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return UserConfig{}, nil
+	} else if err != nil {
+		return UserConfig{}, err
+	}
+
+	cfg, err := parseUserConfig(raw)
+	if err != nil {
+		return UserConfig{}, fmt.Errorf("%v: %v", path, err)
+	}
+
+	return cfg, nil
+}
+
+func parseUserConfig(raw []byte) (UserConfig, error) {
+	var cfg UserConfig
+	if err := yaml.UnmarshalStrict(raw, &cfg); err != nil {
+		return UserConfig{}, err
+	}
+
+	return cfg, cfg.check()
+}
+
+// check checks the settings that are the right type but can still be wrong.
+func (u UserConfig) check() error {
+	if u.Output != "" && !contains(Outputs, u.Output) {
+		return fmt.Errorf("unknown output %q, should be one of %v",
+			u.Output, strings.Join(Outputs, ", "))
+	}
+
+	for _, name := range u.Forward {
+		if !contains(Forwards, name) {
+			return fmt.Errorf("can't forward %q, should be one of %v",
+				name, strings.Join(Forwards, ", "))
+		}
+	}
+
+	if strings.Contains(u.RegistryMirror, "://") {
+		return fmt.Errorf("registry_mirror should be a registry like %q, not a URL",
+			"mirror.example.com")
+	}
+
+	if u.DetachKeys != "" {
+		if err := CheckDetachKeys(u.DetachKeys); err != nil {
+			return err
+		}
+	}
+
+	if _, err := u.Resources.Parse(); err != nil {
+		return fmt.Errorf("resources: %v", err)
+	}
+
+	return nil
+}
+
+// WithUserConfig returns `o` with the defaults in `u` filled in.
+func (o Opts) WithUserConfig(u UserConfig) Opts {
+	r := &o.Resources
+	for _, s := range []struct {
+		value *string
+		def   string
+	}{
+		{&r.CPUs, u.Resources.CPUs},
+		{&r.Memory, u.Resources.Memory},
+		{&r.MemorySwap, u.Resources.MemorySwap},
+		{&r.ShmSize, u.Resources.ShmSize},
+	} {
+		if *s.value == "" {
+			*s.value = s.def
+		}
+	}
+
+	if r.PidsLimit == 0 {
+		r.PidsLimit = u.Resources.PidsLimit
+	}
+
+	if len(u.Resources.Ulimits) > 0 {
+		ulimits := map[string]string{}
+		for name, limit := range u.Resources.Ulimits {
+			ulimits[name] = limit
+		}
+
+		for name, limit := range r.Ulimits {
+			ulimits[name] = limit
+		}
+
+		r.Ulimits = ulimits
+	}
+
+	forward := []string{}
+	for _, name := range append(append([]string{}, u.Forward...), o.Forward...) {
+		if !contains(forward, name) {
+			forward = append(forward, name)
+		}
+	}
+
+	if len(forward) > 0 {
+		o.Forward = forward
+	}
+
+	return o
+}
+
+// MirrorImage returns the reference of `image` on `mirror`, if it's an image on
+// Docker Hub. Other images, and every image when there's no mirror, are left
+// as they are.
+func MirrorImage(image, mirror string) string {
+	if mirror == "" {
+		return image
+	}
+
+	// Images on other registries start with the registry's host, which is
+	// the only part of a reference that can have a dot or a port in it.
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 &&
+		(strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return image
+	}
+
+	// Official images are in the "library" namespace.
+	if len(parts) == 1 {
+		image = "library/" + image
+	}
+
+	return strings.TrimSuffix(mirror, "/") + "/" + image
+}
+
+// GetUserSetting returns the value of the setting `key` in the user config,
+// like "resources.memory". Lists are joined with commas, and maps are written
+// out as YAML. It returns false when the setting isn't set.
+func GetUserSetting(key string) (string, bool, error) {
+	if _, err := userSettingType(key); err != nil {
+		return "", false, err
+	}
+
+	doc, _, err := readUserDoc()
+	if err != nil {
+		return "", false, err
+	}
+
+	var v interface{} = doc
+	for _, part := range strings.Split(key, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return "", false, nil
+		}
+
+		if v, ok = m[part]; !ok {
+			return "", false, nil
+		}
+	}
+
+	switch v := v.(type) {
+	case []interface{}:
+		items := []string{}
+		for _, item := range v {
+			items = append(items, fmt.Sprintf("%v", item))
+		}
+
+		return strings.Join(items, ","), true, nil
+	case map[string]interface{}:
+		out, err := yaml.Marshal(v)
+		return strings.TrimSuffix(string(out), "\n"), true, err
+	}
+
+	return fmt.Sprintf("%v", v), true, nil
+}
+
+// SetUserSetting sets the setting `key` in the user config to `value`, creating
+// the file if it has to. Lists are given as comma separated values, and an
+// empty value removes the setting. The file is only written when the config
+// is still valid with the setting changed.
+func SetUserSetting(key, value string) error {
+	t, err := userSettingType(key)
+	if err != nil {
+		return err
+	}
+
+	doc, path, err := readUserDoc()
+	if err != nil {
+		return err
+	}
+
+	var v interface{} = value
+	switch t.Kind() {
+	case reflect.Slice:
+		items := []interface{}{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v = items
+	case reflect.Int:
+		if value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%v should be a whole number, not %q", key, value)
+			}
+			v = n
+		}
+	case reflect.Struct, reflect.Map:
+		return fmt.Errorf("%v is a group of settings, set them one by one", key)
+	}
+
+	parts := strings.Split(key, ".")
+	m := doc
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := m[part].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			m[part] = next
+		}
+		m = next
+	}
+
+	last := parts[len(parts)-1]
+	if value == "" {
+		delete(m, last)
+	} else {
+		m[last] = v
+	}
+
+	pruneEmpty(doc)
+
+	out, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	if _, err := parseUserConfig(out); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, out, 0644)
+}
+
+// userSettingType returns the type of the setting `key` in the user config,
+// or an error if there's no such setting.
+func userSettingType(key string) (reflect.Type, error) {
+	t := reflect.TypeOf(UserConfig{})
+
+	for _, part := range strings.Split(key, ".") {
+		switch t.Kind() {
+		case reflect.Struct:
+			field, ok := fieldByTag(t, part)
+			if !ok || part == "" {
+				return nil, fmt.Errorf("unknown setting %v, should be one of %v",
+					key, strings.Join(UserSettings(), ", "))
+			}
+			t = field.Type
+		case reflect.Map:
+			t = t.Elem()
+		default:
+			return nil, fmt.Errorf("unknown setting %v", key)
+		}
+	}
+
+	return t, nil
+}
+
+// UserSettings returns the keys of every setting in the user config. Settings
+// in maps, like the ulimits, are named by the map, as "resources.ulimits.*".
+func UserSettings() []string {
+	var keys []string
+
+	var walk func(t reflect.Type, prefix string)
+	walk = func(t reflect.Type, prefix string) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			key := joinPath(prefix, strings.Split(field.Tag.Get("yaml"), ",")[0])
+
+			switch field.Type.Kind() {
+			case reflect.Struct:
+				walk(field.Type, key)
+			case reflect.Map:
+				keys = append(keys, key+".*")
+			default:
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	walk(reflect.TypeOf(UserConfig{}), "")
+	sort.Strings(keys)
+
+	return keys
+}
+
+// readUserDoc reads the user config as a generic document, along with its path.
+func readUserDoc() (map[string]interface{}, string, error) {
+	path, err := UserConfigPath()
+	if err != nil {
+		return nil, "", err
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return map[string]interface{}{}, path, nil
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	decoded, err := decodeYAML(raw)
+	if err != nil {
+		return nil, "", fmt.Errorf("%v: %v", path, err)
+	}
+
+	return stringKeys(decoded).(map[string]interface{}), path, nil
+}
+
+// pruneEmpty removes the maps in `doc` that are left empty.
+func pruneEmpty(doc map[string]interface{}) {
+	for k, v := range doc {
+		if m, ok := v.(map[string]interface{}); ok {
+			pruneEmpty(m)
+			if len(m) == 0 {
+				delete(doc, k)
+			}
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/winiceo/genv/test_pkg"
+)
+
+func TestLoadUserConfig(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	dir, err := ioutil.TempDir("", "envctl-user-config")
+	if err != nil {
+		t.Fatal("creating temp dir", nil, err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	os.Setenv("XDG_CONFIG_HOME", dir)
+
+	cfg, err := LoadUserConfig()
+	if err != nil {
+		t.Fatal("loading a missing user config", nil, err)
+	}
+
+	if cfg.Dotfiles.Path != "" {
+		t.Fatal("missing user config", UserConfig{}, cfg)
+	}
+
+	path := filepath.Join(dir, "envctl", "config.yaml")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal("creating config dir", nil, err)
+	}
+
+	raw := "dotfiles:\n  path: ~/dotfiles\n  install: ./install.sh\n"
+	if err := ioutil.WriteFile(path, []byte(raw), 0644); err != nil {
+		t.Fatal("writing user config", nil, err)
+	}
+
+	cfg, err = LoadUserConfig()
+	if err != nil {
+		t.Fatal("loading user config", nil, err)
+	}
+
+	expected := Dotfiles{Path: "~/dotfiles", Install: "./install.sh"}
+	if expected != cfg.Dotfiles {
+		t.Fatal("dotfiles", expected, cfg.Dotfiles)
+	}
+}
+
+func TestWithUserConfig(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	u := UserConfig{
+		Resources: Resources{
+			CPUs:    "2",
+			Memory:  "4g",
+			Ulimits: map[string]string{"nofile": "1024", "nproc": "512"},
+		},
+		Forward: []string{ForwardSSHAgent, ForwardGitConfig},
+	}
+
+	o := Opts{
+		Resources: Resources{
+			Memory:  "8g",
+			Ulimits: map[string]string{"nofile": "4096"},
+		},
+		Forward: []string{ForwardGPGAgent, ForwardSSHAgent},
+	}
+
+	expected := Opts{
+		Resources: Resources{
+			CPUs:    "2",
+			Memory:  "8g",
+			Ulimits: map[string]string{"nofile": "4096", "nproc": "512"},
+		},
+		Forward: []string{ForwardSSHAgent, ForwardGitConfig, ForwardGPGAgent},
+	}
+
+	actual := o.WithUserConfig(u)
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatal("merged config", expected, actual)
+	}
+
+	if !reflect.DeepEqual(Opts{}, Opts{}.WithUserConfig(UserConfig{})) {
+		t.Fatal("merging empty configs", Opts{}, Opts{}.WithUserConfig(UserConfig{}))
+	}
+}
+
+func TestMirrorImage(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	cases := map[string]string{
+		"ubuntu:latest":               "mirror.example.com/library/ubuntu:latest",
+		"bitnami/redis":               "mirror.example.com/bitnami/redis",
+		"ghcr.io/owner/image:1.0":     "ghcr.io/owner/image:1.0",
+		"localhost:5000/image":        "localhost:5000/image",
+		"localhost/image":             "localhost/image",
+		"registry.example.com/ubuntu": "registry.example.com/ubuntu",
+	}
+
+	for image, expected := range cases {
+		if actual := MirrorImage(image, "mirror.example.com/"); expected != actual {
+			t.Fatal("mirroring "+image, expected, actual)
+		}
+	}
+
+	if actual := MirrorImage("ubuntu", ""); actual != "ubuntu" {
+		t.Fatal("no mirror", "ubuntu", actual)
+	}
+}
+
+func TestUserSettings(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	dir, err := ioutil.TempDir("", "envctl-user-config")
+	if err != nil {
+		t.Fatal("creating temp dir", nil, err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	os.Setenv("XDG_CONFIG_HOME", dir)
+
+	settings := [][2]string{
+		{"resources.memory", "4g"},
+		{"resources.pids_limit", "512"},
+		{"resources.ulimits.nofile", "1024:2048"},
+		{"forward", "ssh_agent, git_config"},
+		{"dotfiles.path", "~/dotfiles"},
+	}
+
+	for _, s := range settings {
+		if err := SetUserSetting(s[0], s[1]); err != nil {
+			t.Fatal("setting "+s[0], nil, err)
+		}
+	}
+
+	if err := SetUserSetting("dotfiles.path", ""); err != nil {
+		t.Fatal("removing dotfiles.path", nil, err)
+	}
+
+	expected := UserConfig{
+		Resources: Resources{
+			Memory:    "4g",
+			PidsLimit: 512,
+			Ulimits:   map[string]string{"nofile": "1024:2048"},
+		},
+		Forward: []string{ForwardSSHAgent, ForwardGitConfig},
+	}
+
+	actual, err := LoadUserConfig()
+	if err != nil {
+		t.Fatal("loading user config", nil, err)
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatal("user config", expected, actual)
+	}
+
+	value, ok, err := GetUserSetting("forward")
+	if err != nil || !ok || value != "ssh_agent,git_config" {
+		t.Fatal("getting forward", "ssh_agent,git_config", value)
+	}
+
+	if _, ok, _ := GetUserSetting("dotfiles.path"); ok {
+		t.Fatal("getting a removed setting", false, ok)
+	}
+
+	errs := map[[2]string]string{
+		{"memory", "4g"}:             "unknown setting memory, should be one of " + strings.Join(UserSettings(), ", "),
+		{"resources.memory", "lots"}: `resources: memory should be a size like "512m" or "4g", not "lots"`,
+		{"output", "xml"}:            `unknown output "xml", should be one of text, json`,
+		{"dotfiles", "~/dotfiles"}:   "dotfiles is a group of settings, set them one by one",
+		{"detach_keys", "ctrl-foo"}:  `detach keys "ctrl-foo" aren't valid, should be like "ctrl-p,ctrl-q"`,
+	}
+
+	for s, msg := range errs {
+		err := SetUserSetting(s[0], s[1])
+		if err == nil || err.Error() != msg {
+			t.Fatal("setting "+s[0], msg, err)
+		}
+	}
+}
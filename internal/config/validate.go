@@ -0,0 +1,456 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Protocols are the layer 3 protocols ports can be exposed over.
+var Protocols = []string{"tcp", "udp", "sctp"}
+
+// Problem is something wrong with a config file, along with where it is. Line
+// and Column are 0 when they aren't known.
+type Problem struct {
+	File   string
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (p Problem) String() string {
+	switch {
+	case p.Line == 0:
+		return fmt.Sprintf("%v: %v", p.File, p.Msg)
+	case p.Column == 0:
+		return fmt.Sprintf("%v:%v: %v", p.File, p.Line, p.Msg)
+	}
+
+	return fmt.Sprintf("%v:%v:%v: %v", p.File, p.Line, p.Column, p.Msg)
+}
+
+// yamlLine matches the line numbers at the start of yaml syntax errors.
+var yamlLine = regexp.MustCompile(`^yaml: line (\d+): `)
+
+// Validate checks the config file at `path`, along with the files it extends
+// and its local overlay, and returns every problem it finds, sorted by where
+// they are. Each file is checked on its own, so problems point into the file
+// they're in. Required settings can come from any of the files though, so
+// they're checked once everything is merged, with `profile` selected.
+//
+// The error is only set when the files can't be checked at all, e.g. when one
+// of them can't be read.
+func Validate(path, profile string) ([]Problem, error) {
+	decode, err := decoderFor(path)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &validator{}
+
+	doc, err := resolveWith(path, decode, v.read)
+	if err != nil {
+		return nil, err
+	}
+
+	// Files that can't be decoded have already been reported, and the merged
+	// document can't be trusted to have what it needs without them.
+	if v.broken {
+		return v.sorted(), nil
+	}
+
+	if profile != "" {
+		doc, err = doc.WithProfile(profile)
+		if err != nil {
+			v.problems = append(v.problems, Problem{File: path, Msg: err.Error()})
+			return v.sorted(), nil
+		}
+	}
+
+	for _, key := range []string{"image", "shell"} {
+		if s, ok := doc.root[key].(sourced); ok && fmt.Sprintf("%v", s.value) != "" {
+			continue
+		}
+
+		v.problems = append(v.problems, Problem{
+			File:   path,
+			Line:   1,
+			Column: 1,
+			Msg:    fmt.Sprintf("missing %v", key),
+		})
+	}
+
+	return v.sorted(), nil
+}
+
+// validator collects the problems in each of the files it reads.
+type validator struct {
+	problems []Problem
+	broken   bool
+}
+
+func (v *validator) sorted() []Problem {
+	sort.SliceStable(v.problems, func(i, j int) bool {
+		a, b := v.problems[i], v.problems[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+
+		return a.Column < b.Column
+	})
+
+	return v.problems
+}
+
+// read is a reader that checks each file as it's read, instead of failing on
+// the first problem.
+func (v *validator) read(file string, decode decoder) (map[string]interface{}, error) {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, err := decode(raw)
+	if err != nil {
+		p := Problem{File: file, Msg: err.Error()}
+		if m := yamlLine.FindStringSubmatch(p.Msg); m != nil {
+			p.Line, _ = strconv.Atoi(m[1])
+			p.Msg = strings.TrimPrefix(p.Msg, m[0])
+		}
+
+		v.problems = append(v.problems, p)
+		v.broken = true
+
+		return map[string]interface{}{}, nil
+	}
+
+	doc := stringKeys(decoded).(map[string]interface{})
+	c := &fileChecker{file: file}
+
+	// Older files are checked as they'll be used, once they're upgraded.
+	// Their paths don't always match the file anymore, but the locations
+	// fall back to the closest path that does.
+	if _, err := migrate(doc); err != nil {
+		c.report("version", true, "%v", err)
+		v.problems = append(v.problems, c.problems...)
+		v.broken = true
+
+		return map[string]interface{}{}, nil
+	}
+
+	ext := strings.ToLower(filepath.Ext(file))
+	if ext == ".yaml" || ext == ".yml" {
+		c.locs = locateYAML(raw)
+	} else {
+		c.locs = locateKeys(raw, paths(doc, ""))
+	}
+
+	c.check(doc, reflect.TypeOf(Opts{}), "")
+
+	// Extends has to point at a config file for the rest of the files to be
+	// read. Anything else has been reported already, or is reported here.
+	if parent, ok := doc["extends"].(string); ok && parent != "" {
+		if !filepath.IsAbs(parent) {
+			parent = filepath.Join(filepath.Dir(file), parent)
+		}
+
+		if info, err := os.Stat(parent); err == nil && info.IsDir() {
+			parent = filepath.Join(parent, Filename)
+		}
+
+		if _, err := os.Stat(parent); err != nil {
+			c.report("extends", true, "can't extend %v: %v", doc["extends"], err)
+			delete(doc, "extends")
+		} else if _, err := decoderFor(parent); err != nil {
+			c.report("extends", true, "can't extend %v: %v", doc["extends"], err)
+			delete(doc, "extends")
+		}
+	} else {
+		delete(doc, "extends")
+	}
+
+	v.problems = append(v.problems, c.problems...)
+
+	return annotate(doc, file).(map[string]interface{}), nil
+}
+
+// paths returns the paths of everything in the decoded document `v`.
+func paths(v interface{}, prefix string) []string {
+	out := []string{}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			p := joinPath(prefix, k)
+			out = append(out, p)
+			out = append(out, paths(item, p)...)
+		}
+	case []interface{}:
+		for i, item := range v {
+			out = append(out, paths(item, joinPath(prefix, strconv.Itoa(i)))...)
+		}
+	}
+
+	return out
+}
+
+// fileChecker checks a single decoded config file.
+type fileChecker struct {
+	file     string
+	locs     locations
+	problems []Problem
+}
+
+// report notes a problem with the value at `path`. Problems with the value
+// itself, rather than its key, point at the value when it can be found.
+func (c *fileChecker) report(path string, atValue bool, format string, args ...interface{}) {
+	p := Problem{File: c.file, Msg: fmt.Sprintf(format, args...)}
+
+	if loc, ok := c.locs.find(path); ok {
+		p.Line = loc.Line
+		p.Column = loc.Column
+		if atValue && loc.ValueColumn > 0 {
+			p.Column = loc.ValueColumn
+		}
+	}
+
+	c.problems = append(c.problems, p)
+}
+
+// check checks that `v`, at `path` in the file, fits the type `t` it's decoded
+// into, and then that it makes sense.
+func (c *fileChecker) check(v interface{}, t reflect.Type, path string) {
+	if !c.checkType(v, t, path) {
+		return
+	}
+
+	if t == reflect.TypeOf(Opts{}) {
+		c.checkOpts(v.(map[string]interface{}), path)
+	}
+}
+
+// checkType checks that `v` fits `t`, and reports what doesn't. It returns
+// whether `v` is the right kind of value for `t` at all.
+func (c *fileChecker) checkType(v interface{}, t reflect.Type, path string) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if v == nil {
+		return false
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			c.report(path, true, "%v should be a map", describe(path))
+			return false
+		}
+
+		for _, k := range sortedKeys(obj) {
+			field, ok := fieldByTag(t, k)
+			if !ok || k == "-" {
+				c.report(joinPath(path, k), false, "unknown setting %v", k)
+				continue
+			}
+
+			c.check(obj[k], field.Type, joinPath(path, k))
+		}
+	case reflect.Map:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			c.report(path, true, "%v should be a map", describe(path))
+			return false
+		}
+
+		for _, k := range sortedKeys(obj) {
+			c.check(obj[k], t.Elem(), joinPath(path, k))
+		}
+	case reflect.Slice:
+		list, ok := v.([]interface{})
+		if !ok {
+			c.report(path, true, "%v should be a list", describe(path))
+			return false
+		}
+
+		for i, item := range list {
+			if i == 0 && item == ReplaceMarker {
+				continue
+			}
+
+			c.check(item, t.Elem(), joinPath(path, strconv.Itoa(i)))
+		}
+	case reflect.String:
+		switch v.(type) {
+		case map[string]interface{}, []interface{}:
+			c.report(path, true, "%v should be a string", describe(path))
+			return false
+		}
+	case reflect.Bool:
+		if _, ok := v.(bool); !ok {
+			c.report(path, true, "%v should be true or false", describe(path))
+			return false
+		}
+	case reflect.Int:
+		if _, ok := toInt(v); !ok {
+			c.report(path, true, "%v should be a whole number", describe(path))
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkOpts checks the settings in a config, or in one of its profiles, that
+// are the right type but can still be wrong.
+func (c *fileChecker) checkOpts(obj map[string]interface{}, prefix string) {
+	if prefix != "" {
+		for _, key := range []string{"profiles", "extends", "version"} {
+			if _, ok := obj[key]; ok {
+				c.report(joinPath(prefix, key), false, "profiles can't set %v", key)
+			}
+		}
+	}
+
+	for _, key := range []string{"image", "shell"} {
+		if s, ok := obj[key].(string); ok && strings.TrimSpace(s) == "" {
+			c.report(joinPath(prefix, key), true, "%v can't be empty", key)
+		}
+	}
+
+	if mount, ok := obj["mount"].(string); ok && !path.IsAbs(mount) {
+		c.report(joinPath(prefix, "mount"), true,
+			"mount should be an absolute path, not %q", mount)
+	}
+
+	forward, _ := obj["forward"].([]interface{})
+	for i, item := range forward {
+		if name, ok := item.(string); ok && name != ReplaceMarker && !contains(Forwards, name) {
+			c.report(joinPath(prefix, "forward."+strconv.Itoa(i)), true,
+				"can't forward %q, should be one of %v", name, strings.Join(Forwards, ", "))
+		}
+	}
+
+	if resources, ok := obj["resources"].(map[string]interface{}); ok {
+		c.checkResources(resources, joinPath(prefix, "resources"))
+	}
+
+	ports, _ := obj["ports"].(map[string]interface{})
+	for _, proto := range sortedKeys(ports) {
+		protoPath := joinPath(prefix, "ports."+proto)
+		if !isProtocol(proto) {
+			c.report(protoPath, false, "unknown protocol %q, should be one of %v",
+				proto, strings.Join(Protocols, ", "))
+			continue
+		}
+
+		list, _ := ports[proto].([]interface{})
+		for i, item := range list {
+			if i == 0 && item == ReplaceMarker {
+				continue
+			}
+
+			spec := PortSpec(fmt.Sprintf("%v", item))
+			if _, err := spec.Parse(); err != nil {
+				c.report(joinPath(protoPath, strconv.Itoa(i)), true, "%v", err)
+			}
+		}
+	}
+}
+
+// checkResources checks the resource limits in `obj`, at `prefix` in the file.
+func (c *fileChecker) checkResources(obj map[string]interface{}, prefix string) {
+	l := ResourceLimits{}
+	ok := true
+
+	for _, key := range sortedKeys(obj) {
+		if key == "ulimits" {
+			ulimits, _ := obj[key].(map[string]interface{})
+			for _, name := range sortedKeys(ulimits) {
+				key := "ulimits." + name
+				if err := parseResource(&l, key, fmt.Sprintf("%v", ulimits[name])); err != nil {
+					c.report(joinPath(prefix, key), true, "%v", err)
+					ok = false
+				}
+			}
+
+			continue
+		}
+
+		if _, known := fieldByTag(reflect.TypeOf(Resources{}), key); !known {
+			continue
+		}
+
+		if err := parseResource(&l, key, fmt.Sprintf("%v", obj[key])); err != nil {
+			c.report(joinPath(prefix, key), true, "%v", err)
+			ok = false
+		}
+	}
+
+	// Limits that only make sense together can only be checked when each of
+	// them makes sense on its own.
+	if ok {
+		if err := checkLimits(l); err != nil {
+			c.report(joinPath(prefix, "memory_swap"), true, "%v", err)
+		}
+	}
+}
+
+func isProtocol(name string) bool {
+	return contains(Protocols, name)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// toInt returns `v` as an int, if it's any kind of whole number.
+func toInt(v interface{}) (int, bool) {
+	switch v := v.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case uint64:
+		return int(v), true
+	}
+
+	return 0, false
+}
+
+// describe names the setting at `path` for messages.
+func describe(path string) string {
+	if path == "" {
+		return "the config"
+	}
+
+	return path
+}
+
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
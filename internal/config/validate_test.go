@@ -0,0 +1,164 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/winiceo/genv/test_pkg"
+)
+
+func problemStrings(problems []Problem, dir string) []string {
+	out := []string{}
+	for _, p := range problems {
+		p.File, _ = filepath.Rel(dir, p.File)
+		out = append(out, p.String())
+	}
+
+	return out
+}
+
+func TestValidate(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	dir := writeFiles(t, map[string]string{
+		"base.yaml": `---
+shell: /bin/bash
+mount: relative/path
+`,
+		"envctl.yaml": `---
+extends: base.yaml
+image: ubuntu
+cache_image: sometimes
+bootstrap:
+- make deps
+- [not, a, string]
+ports:
+  tcp: [80, 70000]
+  icmp:
+  - 1
+  udp:
+  - 0
+watch:
+  patterns: "**/*.go"
+profiles:
+  ci:
+    extends: other.yaml
+    mounts: /src
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	problems, err := Validate(filepath.Join(dir, "envctl.yaml"), "")
+	if err != nil {
+		t.Fatal("validating", nil, err)
+	}
+
+	expected := []string{
+		"base.yaml:3:8: mount should be an absolute path, not \"relative/path\"",
+		"envctl.yaml:4:14: cache_image should be true or false",
+		"envctl.yaml:7:3: bootstrap.1 should be a map",
+		"envctl.yaml:9:13: port \"70000\": 70000 is out of range, should be between 1 and 65535",
+		"envctl.yaml:10:3: unknown protocol \"icmp\", should be one of tcp, udp, sctp",
+		"envctl.yaml:13:5: port \"0\": 0 is out of range, should be between 1 and 65535",
+		"envctl.yaml:15:13: watch.patterns should be a list",
+		"envctl.yaml:18:5: profiles can't set extends",
+		"envctl.yaml:19:5: unknown setting mounts",
+	}
+
+	actual := problemStrings(problems, dir)
+	if strings.Join(expected, "\n") != strings.Join(actual, "\n") {
+		t.Fatal("problems", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+}
+
+func TestValidateMissing(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	dir := writeFiles(t, map[string]string{
+		"envctl.json": `{
+  "image": "ubuntu",
+  "ports": {
+    "tcp": [99999]
+  }
+}`,
+	})
+	defer os.RemoveAll(dir)
+
+	problems, err := Validate(filepath.Join(dir, "envctl.json"), "")
+	if err != nil {
+		t.Fatal("validating", nil, err)
+	}
+
+	expected := []string{
+		"envctl.json:1:1: missing shell",
+		"envctl.json:4:5: port \"99999\": 99999 is out of range, should be between 1 and 65535",
+	}
+
+	actual := problemStrings(problems, dir)
+	if strings.Join(expected, "\n") != strings.Join(actual, "\n") {
+		t.Fatal("problems", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+}
+
+func TestValidateSyntax(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	dir := writeFiles(t, map[string]string{
+		"envctl.yaml": "---\nimage: ubuntu\nshell: [oops\n",
+	})
+	defer os.RemoveAll(dir)
+
+	problems, err := Validate(filepath.Join(dir, "envctl.yaml"), "")
+	if err != nil {
+		t.Fatal("validating", nil, err)
+	}
+
+	if len(problems) != 1 || problems[0].Line == 0 {
+		t.Fatal("syntax problem", "a problem with a line", problems)
+	}
+}
+
+func TestSchema(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	raw, err := Schema()
+	if err != nil {
+		t.Fatal("generating schema", nil, err)
+	}
+
+	var schema struct {
+		Properties map[string]struct {
+			Type                 string                 `json:"type"`
+			Properties           map[string]interface{} `json:"properties"`
+			AdditionalProperties interface{}            `json:"additionalProperties"`
+		} `json:"properties"`
+	}
+
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		t.Fatal("decoding schema", nil, err)
+	}
+
+	for _, key := range []string{"image", "shell", "ports", "profiles", "watch"} {
+		if _, ok := schema.Properties[key]; !ok {
+			t.Fatal("schema for "+key, "a schema", nil)
+		}
+	}
+
+	ports := schema.Properties["ports"]
+	if len(ports.Properties) != len(Protocols) {
+		t.Fatal("protocols in the schema", len(Protocols), len(ports.Properties))
+	}
+
+	profile, _ := schema.Properties["profiles"].AdditionalProperties.(map[string]interface{})
+	props, _ := profile["properties"].(map[string]interface{})
+	if _, ok := props["image"]; !ok {
+		t.Fatal("image in the profile schema", "a schema", props)
+	}
+
+	if _, ok := props["profiles"]; ok {
+		t.Fatal("profiles in the profile schema", nil, props["profiles"])
+	}
+}
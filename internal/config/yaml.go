@@ -1,11 +1,6 @@
 package config
 
-import (
-	"errors"
-	"io/ioutil"
-
-	yaml "gopkg.in/yaml.v2"
-)
+import yaml "gopkg.in/yaml.v2"
 
 var t = true
 var f = false
@@ -18,39 +13,23 @@ var NoCacheImage = &f
 
 // YAML is a Loader for a YAML configuration file.
 type YAML struct {
-	Path string
+	Path    string
+	Profile string
 }
 
-// Load returns a new `Opts`` by reading the YAML file. If an error
-// happens along the way it returns it along with a zeroed `Opts`. If
-// something is missing that should be there, it'll return an error.
+// Load returns a new `Opts`` by reading the YAML file, along with any files it
+// extends and its local overlay. If an error happens along the way it returns
+// it along with a zeroed `Opts`. If something is missing that should be there,
+// it'll return an error.
 func (c YAML) Load() (Opts, error) {
-	f, err := ioutil.ReadFile(c.Path)
-	if err != nil {
-		return Opts{}, err
-	}
-
-	var cfg Opts
-	err = yaml.UnmarshalStrict(f, &cfg)
-	if err != nil {
-		return Opts{}, err
-	}
-
-	if cfg.Image == "" {
-		return Opts{}, errors.New("missing image")
-	}
-
-	if cfg.Shell == "" {
-		return Opts{}, errors.New("missing shell")
-	}
-
-	if cfg.CacheImage == nil {
-		cfg.CacheImage = CacheImage
-	}
+	return load(c.Path, decodeYAML, c.Profile)
+}
 
-	if cfg.User == "" {
-		cfg.User = "root"
+func decodeYAML(raw []byte) (map[string]interface{}, error) {
+	doc := map[string]interface{}{}
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, err
 	}
 
-	return cfg, nil
+	return doc, nil
 }
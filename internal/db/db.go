@@ -1,11 +1,14 @@
 package db
 
 import (
-	"bytes"
 	"encoding/json"
-	"io"
+	"errors"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
 
+	"github.com/winiceo/genv/internal/config"
 	"github.com/winiceo/genv/pkg/container"
 )
 
@@ -27,85 +30,134 @@ type Store interface {
 
 // Environment is just a container with its image under the hood. The container
 // is really what runs it. To store it, all that needs to be tracked is the
-// container and the image.
+// container and the image. The fingerprint of the config it was created from
+// is kept alongside it to tell when the config has changed since, along with
+// the profile that was selected, if any.
 type Environment struct {
 	Status    int                `json:"status"`
 	Container container.Metadata `json:"container"`
+	Config    config.Fingerprint `json:"config"`
+	Profile   string             `json:"profile,omitempty"`
 }
 
-// JSONStore implements a Store as a JSON file.
+// JSONStore implements a Store as a JSON file in a state directory. Nothing is
+// written to disk until an Environment is created, so commands that only read
+// the store don't leave empty state directories behind.
 type JSONStore struct {
-	File     *os.File
 	basepath string
 }
 
-func NewJSONStore(basepath string) (js *JSONStore, err error) {
-	js = &JSONStore{
-		basepath: basepath,
+// NewJSONStore returns a JSONStore keeping its file in the `basepath`
+// directory.
+func NewJSONStore(basepath string) (*JSONStore, error) {
+	if basepath == "" {
+		return nil, errors.New("missing state directory")
 	}
 
-	if _, err = os.Stat(basepath); err != nil {
-		err = os.Mkdir(basepath, os.ModePerm|os.ModeDir)
-		if err != nil {
-			return
-		}
-	}
-
-	if _, err = os.Stat(basepath + "envdata.json"); err != nil {
-		js.File, err = os.OpenFile(
-			basepath+"envdata.json",
-			os.O_CREATE|os.O_RDWR,
-			0666,
-		)
-		if err != nil {
-			return
-		}
-	} else {
-		js.File, err = os.OpenFile(
-			basepath+"envdata.json",
-			os.O_RDWR,
-			0666,
-		)
-		if err != nil {
-			return
-		}
-	}
+	return &JSONStore{basepath: basepath}, nil
+}
 
-	return
+func (js *JSONStore) path() string {
+	return filepath.Join(js.basepath, "envdata.json")
 }
 
-// Create writes an Environment to the file referenced by `js`.
+// Create writes an Environment to the file referenced by `js`, replacing
+// whatever was there before.
 func (js *JSONStore) Create(e Environment) error {
 	buf, err := json.Marshal(e)
 	if err != nil {
 		return err
 	}
 
-	_, err = io.Copy(js.File, bytes.NewBuffer(buf))
-	return err
+	if err := os.MkdirAll(js.basepath, os.ModePerm); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(js.path(), buf, 0644)
 }
 
 // Read creates an Environment by reading the file referenced by `js` and
-// returns it or an error if something went wrong. If the JSON Unmarshal returns
-// an error, no error is returned. It's treated as an empty environment. This
-// is because the subsequent call to Create will overwrite what's there when it
-// writes the new Environment.
+// returns it or an error if something went wrong. A missing file is an
+// environment that hasn't been created yet. If the JSON Unmarshal returns an
+// error, no error is returned either. It's treated as an empty environment.
+// This is because the subsequent call to Create will overwrite what's there
+// when it writes the new Environment. Ports stored the way they were before
+// they could be mapped are read as the mappings they stand for.
 func (js *JSONStore) Read() (Environment, error) {
-	buf := &bytes.Buffer{}
-	_, err := io.Copy(buf, js.File)
+	buf, err := ioutil.ReadFile(js.path())
+	if os.IsNotExist(err) {
+		return Environment{}, nil
+	}
+
 	if err != nil {
 		return Environment{}, err
 	}
 
 	var e Environment
-	json.Unmarshal(buf.Bytes(), &e)
+	json.Unmarshal(buf, &e)
+
+	var legacy legacyEnvironment
+	if err := json.Unmarshal(buf, &legacy); err == nil && len(legacy.Container.Ports) > 0 {
+		e.Container.Ports = legacy.ports()
+	}
+
+	return e, nil
+}
 
-	return e, err
+// legacyEnvironment is the part of an Environment that was stored differently
+// before ports could be mapped to other ports on the host. They were kept as
+// lists of ports by protocol, and each was bound to the same port on every
+// address of the host.
+type legacyEnvironment struct {
+	Container struct {
+		Ports map[string][]int `json:"ports"`
+	} `json:"container"`
 }
 
-// Delete writes an Environment with "status" set to StatusOff.
+// ports returns the legacy ports as the mappings they stand for.
+func (le legacyEnvironment) ports() []container.PortMapping {
+	protocols := []string{}
+	for protocol := range le.Container.Ports {
+		protocols = append(protocols, protocol)
+	}
+	sort.Strings(protocols)
+
+	mappings := []container.PortMapping{}
+	for _, protocol := range protocols {
+		for _, port := range le.Container.Ports[protocol] {
+			mappings = append(mappings, container.PortMapping{
+				Protocol:      protocol,
+				HostPort:      port,
+				ContainerPort: port,
+			})
+		}
+	}
+
+	return mappings
+}
+
+// Delete removes the file referenced by `js`. The state directory is removed
+// too, but only when nothing else is left in it, since it can be any directory
+// passed with --state-dir.
 func (js *JSONStore) Delete() error {
-	return os.RemoveAll(js.basepath)
+	if err := os.Remove(js.path()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	entries, err := ioutil.ReadDir(js.basepath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if len(entries) > 0 {
+		return nil
+	}
+
+	return os.Remove(js.basepath)
 }
 
 // Initialized checks to see if an environment has been initialized. Initialized
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/winiceo/genv/pkg/container"
+	"github.com/winiceo/genv/test_pkg"
+)
+
+func TestJSONStoreDelete(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	dir, err := ioutil.TempDir("", "envctl-db")
+	if err != nil {
+		t.Fatal("creating temp dir", nil, err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A state directory with only the state file in it is removed.
+	state := filepath.Join(dir, "state")
+	js, err := NewJSONStore(state)
+	if err != nil {
+		t.Fatal("creating store", nil, err)
+	}
+
+	if err := js.Create(Environment{Status: StatusReady}); err != nil {
+		t.Fatal("creating environment", nil, err)
+	}
+
+	if err := js.Delete(); err != nil {
+		t.Fatal("deleting environment", nil, err)
+	}
+
+	if _, err := os.Stat(state); !os.IsNotExist(err) {
+		t.Fatal("state directory after deleting", "not exist", err)
+	}
+
+	// Anything else in the state directory is left alone, along with the
+	// directory.
+	js, err = NewJSONStore(dir)
+	if err != nil {
+		t.Fatal("creating store", nil, err)
+	}
+
+	other := filepath.Join(dir, "notes.txt")
+	if err := ioutil.WriteFile(other, []byte("keep me"), 0644); err != nil {
+		t.Fatal("writing other file", nil, err)
+	}
+
+	if err := js.Create(Environment{Status: StatusReady}); err != nil {
+		t.Fatal("creating environment", nil, err)
+	}
+
+	if err := js.Delete(); err != nil {
+		t.Fatal("deleting environment", nil, err)
+	}
+
+	if _, err := os.Stat(js.path()); !os.IsNotExist(err) {
+		t.Fatal("state file after deleting", "not exist", err)
+	}
+
+	if _, err := os.Stat(other); err != nil {
+		t.Fatal("other file after deleting", nil, err)
+	}
+
+	// Deleting what was never created isn't an error.
+	js, err = NewJSONStore(filepath.Join(dir, "missing"))
+	if err != nil {
+		t.Fatal("creating store", nil, err)
+	}
+
+	if err := js.Delete(); err != nil {
+		t.Fatal("deleting missing environment", nil, err)
+	}
+}
+
+func TestJSONStoreReadLegacyPorts(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	dir, err := ioutil.TempDir("", "envctl-db")
+	if err != nil {
+		t.Fatal("creating temp dir", nil, err)
+	}
+	defer os.RemoveAll(dir)
+
+	js, err := NewJSONStore(dir)
+	if err != nil {
+		t.Fatal("creating store", nil, err)
+	}
+
+	raw := `{"status":1,"container":{"id":"test","ports":{"udp":[53],"tcp":[80,443]}}}`
+	if err := ioutil.WriteFile(js.path(), []byte(raw), 0644); err != nil {
+		t.Fatal("writing state", nil, err)
+	}
+
+	env, err := js.Read()
+	if err != nil {
+		t.Fatal("reading environment", nil, err)
+	}
+
+	if env.Container.ID != "test" {
+		t.Fatal("container ID", "test", env.Container.ID)
+	}
+
+	expected := []container.PortMapping{
+		{Protocol: "tcp", HostPort: 80, ContainerPort: 80},
+		{Protocol: "tcp", HostPort: 443, ContainerPort: 443},
+		{Protocol: "udp", HostPort: 53, ContainerPort: 53},
+	}
+	if !reflect.DeepEqual(expected, env.Container.Ports) {
+		t.Fatal("migrated ports", expected, env.Container.Ports)
+	}
+
+	// Ports stored as mappings are read as they are.
+	mapped := []container.PortMapping{
+		{Protocol: "tcp", HostIP: "127.0.0.1", HostPort: 8080, ContainerPort: 80},
+	}
+	if err := js.Create(Environment{Container: container.Metadata{Ports: mapped}}); err != nil {
+		t.Fatal("creating environment", nil, err)
+	}
+
+	env, err = js.Read()
+	if err != nil {
+		t.Fatal("reading environment", nil, err)
+	}
+
+	if !reflect.DeepEqual(mapped, env.Container.Ports) {
+		t.Fatal("ports", mapped, env.Container.Ports)
+	}
+}
@@ -0,0 +1,182 @@
+package dotenv
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Error is a problem with an entry in a dotenv file.
+type Error struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v:%v: %v", e.File, e.Line, e.Msg)
+}
+
+// Read parses the dotenv file at `path`.
+func Read(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Parse(f, path)
+}
+
+// Parse parses dotenv formatted variables from `r`. `name` is what errors say
+// the variables came from. The format is the one most tools agree on:
+//
+// - each line is a KEY=value pair, optionally prefixed with "export"
+// - blank lines and lines starting with # are ignored
+// - unquoted values end at a " #" comment, and surrounding space is trimmed
+// - single quoted values are taken literally
+// - double quoted values can use \n, \t, \r, \", \\ and \$ escapes
+// - quoted values can span several lines
+//
+// If the same key is there more than once, the last one wins.
+func Parse(r io.Reader, name string) (map[string]string, error) {
+	lines := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimSuffix(scanner.Text(), "\r"))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	vars := map[string]string{}
+	for i := 0; i < len(lines); i++ {
+		// Errors point at the line an entry starts on, even when it spans
+		// several lines.
+		start := i
+		fail := func(format string, args ...interface{}) error {
+			return &Error{File: name, Line: start + 1, Msg: fmt.Sprintf(format, args...)}
+		}
+
+		line := strings.TrimSpace(lines[i])
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		if strings.HasPrefix(line, "export ") || strings.HasPrefix(line, "export\t") {
+			line = strings.TrimSpace(line[len("export"):])
+		}
+
+		eq := strings.Index(line, "=")
+		if eq < 0 {
+			return nil, fail("expected KEY=value, got %q", line)
+		}
+
+		key := strings.TrimSpace(line[:eq])
+		if !isName(key) {
+			return nil, fail("invalid variable name %q", key)
+		}
+
+		value := strings.TrimSpace(line[eq+1:])
+		if value == "" || (value[0] != '"' && value[0] != '\'') {
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+
+			vars[key] = value
+			continue
+		}
+
+		// Quoted values can go on for several lines, so keep adding lines
+		// until the closing quote turns up.
+		quote := value[0]
+		raw := value[1:]
+		end := closingQuote(raw, quote)
+		for end < 0 && i+1 < len(lines) {
+			i++
+			raw += "\n" + lines[i]
+			end = closingQuote(raw, quote)
+		}
+
+		if end < 0 {
+			return nil, fail("unterminated quoted value for %v", key)
+		}
+
+		rest := strings.TrimSpace(raw[end+1:])
+		if rest != "" && rest[0] != '#' {
+			return nil, fail("unexpected %q after quoted value for %v", rest, key)
+		}
+
+		if quote == '"' {
+			vars[key] = unescape(raw[:end])
+		} else {
+			vars[key] = raw[:end]
+		}
+	}
+
+	return vars, nil
+}
+
+// closingQuote returns the index of the first `quote` in `s` that isn't
+// escaped, or -1 if there isn't one. Only double quotes can be escaped.
+func closingQuote(s string, quote byte) int {
+	for i := 0; i < len(s); i++ {
+		if quote == '"' && s[i] == '\\' {
+			i++
+			continue
+		}
+
+		if s[i] == quote {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func unescape(s string) string {
+	out := &strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			out.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		switch s[i] {
+		case 'n':
+			out.WriteByte('\n')
+		case 't':
+			out.WriteByte('\t')
+		case 'r':
+			out.WriteByte('\r')
+		case '"', '\\', '$':
+			out.WriteByte(s[i])
+		default:
+			out.WriteByte('\\')
+			out.WriteByte(s[i])
+		}
+	}
+
+	return out.String()
+}
+
+func isName(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for i, c := range s {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case i > 0 && (c >= '0' && c <= '9' || c == '.'):
+		default:
+			return false
+		}
+	}
+
+	return true
+}
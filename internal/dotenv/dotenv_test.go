@@ -0,0 +1,73 @@
+package dotenv
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/winiceo/genv/test_pkg"
+)
+
+func TestParse(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	in := `# a comment
+
+PLAIN=value
+export EXPORTED=yes
+SPACED = some value  # trailing comment
+HASH=a#b
+EMPTY=
+SINGLE='literal $HOME \n'
+DOUBLE="tab\there \"quoted\""
+MULTI="first
+second"  # comment
+dotted.name=ok
+PLAIN=again
+`
+
+	actual, err := Parse(strings.NewReader(in), ".env")
+	if err != nil {
+		t.Fatal("error parsing", nil, err)
+	}
+
+	expected := map[string]string{
+		"PLAIN":       "again",
+		"EXPORTED":    "yes",
+		"SPACED":      "some value",
+		"HASH":        "a#b",
+		"EMPTY":       "",
+		"SINGLE":      `literal $HOME \n`,
+		"DOUBLE":      "tab\there \"quoted\"",
+		"MULTI":       "first\nsecond",
+		"dotted.name": "ok",
+	}
+
+	if len(expected) != len(actual) {
+		t.Fatal("number of variables", len(expected), len(actual))
+	}
+
+	for k, v := range expected {
+		if actual[k] != v {
+			t.Fatal("value of "+k, v, actual[k])
+		}
+	}
+}
+
+func TestParseErrors(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	cases := map[string]string{
+		"A=1\nnope\n":           ".env:2: expected KEY=value, got \"nope\"",
+		"A=1\n\n1BAD=x\n":       ".env:3: invalid variable name \"1BAD\"",
+		"A=1\nB=\"open\nmore\n": ".env:2: unterminated quoted value for B",
+		"A='done' extra\n":      ".env:1: unexpected \"extra\" after quoted value for A",
+		"A=\"x\ny\" z\nB=2\n":   ".env:1: unexpected \"z\" after quoted value for A",
+	}
+
+	for in, expected := range cases {
+		_, err := Parse(strings.NewReader(in), ".env")
+		if err == nil || err.Error() != expected {
+			t.Fatal("error parsing "+in, expected, err)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package hostport
+
+import (
+	"net"
+	"strconv"
+)
+
+// Checker finds out which ports on the host are free.
+type Checker interface {
+	// Free returns whether `port` can be bound over `proto` on `ip`.
+	Free(proto, ip string, port int) bool
+	// Allocate returns a port that's free over `proto` on `ip`.
+	Allocate(proto, ip string) (int, error)
+}
+
+// System checks the ports of the machine envctl runs on, by trying to bind
+// them. Docker has to be running on the same machine for that to tell anything
+// about the ports Docker is going to bind.
+//
+// Go can't bind SCTP ports, so SCTP ports are always assumed to be free, and
+// are allocated from the free TCP ports.
+type System struct{}
+
+// Free implements Checker.
+func (System) Free(proto, ip string, port int) bool {
+	addr := net.JoinHostPort(ip, strconv.Itoa(port))
+
+	switch proto {
+	case "tcp":
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return false
+		}
+
+		l.Close()
+	case "udp":
+		c, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return false
+		}
+
+		c.Close()
+	}
+
+	return true
+}
+
+// Allocate implements Checker. The port is only known to be free when it's
+// allocated, so another process can still take it before Docker binds it.
+func (System) Allocate(proto, ip string) (int, error) {
+	addr := net.JoinHostPort(ip, "0")
+
+	if proto == "udp" {
+		c, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return 0, err
+		}
+		defer c.Close()
+
+		return c.LocalAddr().(*net.UDPAddr).Port, nil
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
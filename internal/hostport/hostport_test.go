@@ -0,0 +1,45 @@
+package hostport
+
+import (
+	"net"
+	"testing"
+
+	"github.com/winiceo/genv/test_pkg"
+)
+
+func TestSystemFree(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("listening", nil, err)
+	}
+	defer l.Close()
+
+	port := l.Addr().(*net.TCPAddr).Port
+
+	if (System{}).Free("tcp", "127.0.0.1", port) {
+		t.Fatal("port in use", false, true)
+	}
+
+	l.Close()
+
+	if !(System{}).Free("tcp", "127.0.0.1", port) {
+		t.Fatal("port no longer in use", true, false)
+	}
+}
+
+func TestSystemAllocate(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	for _, proto := range []string{"tcp", "udp", "sctp"} {
+		port, err := (System{}).Allocate(proto, "127.0.0.1")
+		if err != nil {
+			t.Fatal(proto, nil, err)
+		}
+
+		if !(System{}).Free(proto, "127.0.0.1", port) {
+			t.Fatal(proto+" port allocated", true, false)
+		}
+	}
+}
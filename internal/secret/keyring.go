@@ -0,0 +1,160 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Keyring is anywhere secrets can be looked up by service and key.
+type Keyring interface {
+	Get(service, key string) (string, error)
+}
+
+// DefaultKeyring returns the keyring secrets should be looked up in. That's the
+// file in ENVCTL_KEYRING_FILE if it's set, or the system's keyring if envctl
+// knows how to talk to it. Anywhere else it falls back to a file in the user's
+// data directory.
+func DefaultKeyring() Keyring {
+	if path := os.Getenv("ENVCTL_KEYRING_FILE"); path != "" {
+		return FileKeyring{Path: path}
+	}
+
+	if sys, ok := systemKeyring(); ok {
+		return sys
+	}
+
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return FileKeyring{}
+		}
+
+		dir = filepath.Join(home, ".local", "share")
+	}
+
+	return FileKeyring{Path: filepath.Join(dir, "envctl", "keyring.json")}
+}
+
+// commandKeyring looks secrets up by running a command that prints them.
+type commandKeyring struct {
+	args func(service, key string) []string
+}
+
+func (k commandKeyring) Get(service, key string) (string, error) {
+	args := k.args(service, key)
+
+	stdout := &bytes.Buffer{}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = stdout
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("no %v in the keyring for %v: %v", key, service, err)
+	}
+
+	return trimNewline(stdout.String()), nil
+}
+
+// systemKeyring returns a Keyring backed by the system's keyring: the login
+// keychain on macOS, and the Secret Service through secret-tool on Linux.
+func systemKeyring() (Keyring, bool) {
+	switch runtime.GOOS {
+	case "darwin":
+		if _, err := exec.LookPath("security"); err == nil {
+			return commandKeyring{args: func(service, key string) []string {
+				return []string{
+					"security", "find-generic-password",
+					"-s", service, "-a", key, "-w",
+				}
+			}}, true
+		}
+	case "linux":
+		if _, err := exec.LookPath("secret-tool"); err == nil {
+			return commandKeyring{args: func(service, key string) []string {
+				return []string{
+					"secret-tool", "lookup",
+					"service", service, "key", key,
+				}
+			}}, true
+		}
+	}
+
+	return nil, false
+}
+
+// FileKeyring is a Keyring kept in a JSON file, mapping services to keys to
+// values. It's meant for tests and for machines without a keyring, so it
+// doesn't do anything to protect the secrets beyond keeping the file private.
+type FileKeyring struct {
+	Path string
+}
+
+// Get returns the value of `key` under `service`.
+func (k FileKeyring) Get(service, key string) (string, error) {
+	all, err := k.read()
+	if err != nil {
+		return "", err
+	}
+
+	v, ok := all[service][key]
+	if !ok {
+		return "", fmt.Errorf("no %v in %v for %v", key, k.Path, service)
+	}
+
+	return v, nil
+}
+
+// Set stores `value` as `key` under `service`, creating the file if needed.
+func (k FileKeyring) Set(service, key, value string) error {
+	all, err := k.read()
+	if err != nil {
+		return err
+	}
+
+	if all[service] == nil {
+		all[service] = map[string]string{}
+	}
+	all[service][key] = value
+
+	buf, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(k.Path), 0700); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(k.Path, buf, 0600)
+}
+
+func (k FileKeyring) read() (map[string]map[string]string, error) {
+	if strings.TrimSpace(k.Path) == "" {
+		return nil, errors.New("no keyring file")
+	}
+
+	all := map[string]map[string]string{}
+
+	buf, err := ioutil.ReadFile(k.Path)
+	if os.IsNotExist(err) {
+		return all, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(buf, &all); err != nil {
+		return nil, fmt.Errorf("%v: %v", k.Path, err)
+	}
+
+	return all, nil
+}
@@ -0,0 +1,122 @@
+package secret
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// schemes are the prefixes that make a variable's value a reference to a
+// secret rather than the value itself.
+var schemes = []string{"file://", "cmd://", "keyring://"}
+
+// IsRef returns whether `value` is a reference to a secret.
+func IsRef(value string) bool {
+	for _, scheme := range schemes {
+		if strings.HasPrefix(value, scheme) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Resolver looks up the values of secret references.
+type Resolver struct {
+	// Dir is what relative paths and commands are relative to.
+	Dir string
+	// Keyring is where keyring references are looked up.
+	Keyring Keyring
+}
+
+// Resolve returns the value `ref` refers to:
+//
+// - file://path is the contents of the file at path
+// - cmd://command is the output of running command in a shell
+// - keyring://service/key is the value of key in the keyring under service
+//
+// A single trailing newline is dropped from files and command output, since
+// there's nearly always one there and it's never part of the secret.
+func (r Resolver) Resolve(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, "file://"):
+		return r.file(strings.TrimPrefix(ref, "file://"))
+	case strings.HasPrefix(ref, "cmd://"):
+		return r.command(strings.TrimPrefix(ref, "cmd://"))
+	case strings.HasPrefix(ref, "keyring://"):
+		return r.keyring(strings.TrimPrefix(ref, "keyring://"))
+	}
+
+	return "", fmt.Errorf("%q isn't a secret reference", ref)
+}
+
+func (r Resolver) file(path string) (string, error) {
+	if strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+
+		path = filepath.Join(home, path[2:])
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(r.Dir, path)
+	}
+
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return trimNewline(string(buf)), nil
+}
+
+func (r Resolver) command(command string) (string, error) {
+	if strings.TrimSpace(command) == "" {
+		return "", errors.New("cmd:// needs a command to run")
+	}
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Dir = r.Dir
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.Stdin = os.Stdin
+
+	// Only stderr goes into the error, since stdout could be the secret.
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("running %q: %v: %v", command, err, msg)
+		}
+
+		return "", fmt.Errorf("running %q: %v", command, err)
+	}
+
+	return trimNewline(stdout.String()), nil
+}
+
+func (r Resolver) keyring(path string) (string, error) {
+	i := strings.LastIndex(path, "/")
+	if i <= 0 || i == len(path)-1 {
+		return "", fmt.Errorf("keyring://%v should be keyring://service/key", path)
+	}
+
+	if r.Keyring == nil {
+		return "", errors.New("no keyring available")
+	}
+
+	return r.Keyring.Get(path[:i], path[i+1:])
+}
+
+func trimNewline(s string) string {
+	s = strings.TrimSuffix(s, "\n")
+	return strings.TrimSuffix(s, "\r")
+}
@@ -0,0 +1,70 @@
+package secret
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/winiceo/genv/test_pkg"
+)
+
+func TestResolve(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	dir, err := ioutil.TempDir("", "envctl-secret")
+	if err != nil {
+		t.Fatal("creating temp dir", nil, err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "token"), []byte("from-file\n"), 0600)
+	if err != nil {
+		t.Fatal("writing secret file", nil, err)
+	}
+
+	keyring := FileKeyring{Path: filepath.Join(dir, "keyring.json")}
+	if err := keyring.Set("db/prod", "password", "from-keyring"); err != nil {
+		t.Fatal("setting keyring secret", nil, err)
+	}
+
+	r := Resolver{Dir: dir, Keyring: keyring}
+
+	cases := map[string]string{
+		"file://token":                          "from-file",
+		"file://" + filepath.Join(dir, "token"): "from-file",
+		"cmd://echo from-cmd":                   "from-cmd",
+		"cmd://cat token":                       "from-file",
+		"keyring://db/prod/password":            "from-keyring",
+	}
+
+	for ref, expected := range cases {
+		if !IsRef(ref) {
+			t.Fatal("whether "+ref+" is a reference", true, false)
+		}
+
+		actual, err := r.Resolve(ref)
+		if err != nil {
+			t.Fatal("resolving "+ref, nil, err)
+		}
+
+		if expected != actual {
+			t.Fatal("resolving "+ref, expected, actual)
+		}
+	}
+
+	for _, ref := range []string{
+		"file://missing",
+		"cmd://exit 1",
+		"keyring://db/prod/nope",
+		"keyring://nokey",
+	} {
+		if _, err := r.Resolve(ref); err == nil {
+			t.Fatal("resolving "+ref, "an error", err)
+		}
+	}
+
+	if IsRef("https://example.com") {
+		t.Fatal("whether a URL is a reference", false, true)
+	}
+}
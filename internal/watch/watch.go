@@ -0,0 +1,213 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watcher watches every directory under a root directory and batches up the
+// changes it sees. Editors and tools tend to touch a file several times when
+// saving it, so changes are only sent once things have been quiet for a while.
+type Watcher struct {
+	root     string
+	debounce time.Duration
+	skip     []string
+	fs       *fsnotify.Watcher
+
+	changes chan []string
+	errors  chan error
+	done    chan struct{}
+}
+
+// skipDirs are never watched, wherever they are. They either change all the
+// time or belong to tools, and watching them would only trigger useless runs.
+var skipDirs = map[string]bool{
+	".git": true,
+}
+
+// New starts watching `root`. Each batch of changes is sent on Changes() once
+// no new change has come in for `debounce`. Nothing in the directories in
+// `skip`, like where envctl keeps its state, is watched.
+func New(root string, debounce time.Duration, skip ...string) (*Watcher, error) {
+	fs, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Watcher{
+		root:     root,
+		debounce: debounce,
+		skip:     skip,
+		fs:       fs,
+		changes:  make(chan []string),
+		errors:   make(chan error),
+		done:     make(chan struct{}),
+	}
+
+	if err := w.addTree(root); err != nil {
+		fs.Close()
+		return nil, err
+	}
+
+	go w.loop()
+
+	return w, nil
+}
+
+// Changes returns the channel batches of changed paths are sent on. The paths
+// are relative to the root directory and use forward slashes.
+func (w *Watcher) Changes() <-chan []string {
+	return w.changes
+}
+
+// Errors returns the channel errors from the underlying watcher are sent on.
+func (w *Watcher) Errors() <-chan error {
+	return w.errors
+}
+
+// AddDir watches the directory `dir` as well, but not the ones in it. It's for
+// directories outside of the root, whose changes start with "../".
+func (w *Watcher) AddDir(dir string) error {
+	return w.fs.Add(dir)
+}
+
+// Close stops watching.
+func (w *Watcher) Close() error {
+	close(w.done)
+	return w.fs.Close()
+}
+
+func (w *Watcher) addTree(root string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			return nil
+		}
+
+		if path != root && (skipDirs[info.Name()] || w.skipped(path)) {
+			return filepath.SkipDir
+		}
+
+		return w.fs.Add(path)
+	})
+}
+
+// skipped returns whether `path` is one of the directories that are skipped,
+// or in one of them.
+func (w *Watcher) skipped(path string) bool {
+	for _, dir := range w.skip {
+		rel, err := filepath.Rel(dir, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (w *Watcher) loop() {
+	pending := map[string]bool{}
+
+	timer := time.NewTimer(w.debounce)
+	timer.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case ev, ok := <-w.fs.Events:
+			if !ok {
+				return
+			}
+
+			if w.skipped(ev.Name) {
+				continue
+			}
+
+			// New directories have to be watched too, or anything created in
+			// them later on would go unnoticed.
+			if ev.Op&fsnotify.Create == fsnotify.Create {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					w.addTree(ev.Name)
+				}
+			}
+
+			rel, err := filepath.Rel(w.root, ev.Name)
+			if err != nil {
+				continue
+			}
+
+			pending[filepath.ToSlash(rel)] = true
+			timer.Reset(w.debounce)
+		case err, ok := <-w.fs.Errors:
+			if !ok {
+				return
+			}
+
+			select {
+			case w.errors <- err:
+			case <-w.done:
+				return
+			}
+		case <-timer.C:
+			batch := make([]string, 0, len(pending))
+			for path := range pending {
+				batch = append(batch, path)
+			}
+			pending = map[string]bool{}
+
+			select {
+			case w.changes <- batch:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+// Match reports whether the slash separated `path` matches `pattern`. Patterns
+// use the syntax of filepath.Match, plus "**", which matches any number of
+// directories. A pattern without a slash is matched against the file name
+// alone, so "*.go" matches Go files anywhere in the tree.
+func Match(pattern, path string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := filepath.Match(pattern, filepath.Base(path))
+		return ok
+	}
+
+	return matchParts(strings.Split(pattern, "/"), strings.Split(path, "/"))
+}
+
+func matchParts(pattern, path []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(path); i++ {
+				if matchParts(pattern[1:], path[i:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(path) == 0 {
+			return false
+		}
+
+		if ok, _ := filepath.Match(pattern[0], path[0]); !ok {
+			return false
+		}
+
+		pattern = pattern[1:]
+		path = path[1:]
+	}
+
+	return len(path) == 0
+}
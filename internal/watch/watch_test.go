@@ -0,0 +1,127 @@
+package watch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/winiceo/genv/test_pkg"
+)
+
+func TestMatch(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	cases := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/root.go", true},
+		{"*.go", "README.md", false},
+		{"cmd/*.go", "cmd/root.go", true},
+		{"cmd/*.go", "internal/config/yaml.go", false},
+		{"**/*.go", "internal/config/yaml.go", true},
+		{"**/*.go", "main.go", true},
+		{"internal/**", "internal/config/yaml.go", true},
+		{"internal/**/yaml.go", "internal/yaml.go", true},
+		{"internal/**/yaml.go", "cmd/yaml.go", false},
+	}
+
+	for _, c := range cases {
+		if Match(c.pattern, c.path) != c.match {
+			t.Fatal(c.pattern+" matching "+c.path, c.match, !c.match)
+		}
+	}
+}
+
+func TestWatcherBatchesChanges(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	root, err := ioutil.TempDir("", "envctl-watch")
+	if err != nil {
+		t.Fatal("creating temp dir", nil, err)
+	}
+	defer os.RemoveAll(root)
+
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal("creating sub dir", nil, err)
+	}
+
+	w, err := New(root, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal("starting watcher", nil, err)
+	}
+	defer w.Close()
+
+	for i := 0; i < 3; i++ {
+		err := ioutil.WriteFile(filepath.Join(root, "sub", "a.txt"), []byte{byte(i)}, 0644)
+		if err != nil {
+			t.Fatal("writing file", nil, err)
+		}
+	}
+
+	select {
+	case batch := <-w.Changes():
+		if len(batch) != 1 || batch[0] != "sub/a.txt" {
+			t.Fatal("changed files", []string{"sub/a.txt"}, batch)
+		}
+	case err := <-w.Errors():
+		t.Fatal("watching files", nil, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("changed files", []string{"sub/a.txt"}, "nothing")
+	}
+}
+
+func TestWatcherSkipsDirs(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	root, err := ioutil.TempDir("", "envctl-watch")
+	if err != nil {
+		t.Fatal("creating temp dir", nil, err)
+	}
+	defer os.RemoveAll(root)
+
+	for _, dir := range []string{"state", "sub"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal("creating dir", nil, err)
+		}
+	}
+
+	// One state directory is there from the start, and the other one is
+	// created later on, like it is by the first create.
+	state, later := filepath.Join(root, "state"), filepath.Join(root, "later")
+
+	w, err := New(root, 100*time.Millisecond, state, later)
+	if err != nil {
+		t.Fatal("starting watcher", nil, err)
+	}
+	defer w.Close()
+
+	if err := os.Mkdir(later, 0755); err != nil {
+		t.Fatal("creating dir", nil, err)
+	}
+
+	for _, file := range []string{
+		filepath.Join(state, "envdata.json"),
+		filepath.Join(later, "envdata.json"),
+		filepath.Join(root, "sub", "a.txt"),
+	} {
+		if err := ioutil.WriteFile(file, []byte("{}"), 0644); err != nil {
+			t.Fatal("writing file", nil, err)
+		}
+	}
+
+	select {
+	case batch := <-w.Changes():
+		if len(batch) != 1 || batch[0] != "sub/a.txt" {
+			t.Fatal("changed files", []string{"sub/a.txt"}, batch)
+		}
+	case err := <-w.Errors():
+		t.Fatal("watching files", nil, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("changed files", []string{"sub/a.txt"}, "nothing")
+	}
+}
@@ -1,38 +1,183 @@
 package container
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
 
 // Metadata is what's returned by the container functions. It contains
 // everything that a consumer of this package needs to know about containers
 // being managed.
+//
+// Envs holds the values of the container's variables, which can be secrets, so
+// it's never serialized. Variables describes where each of them came from
+// instead.
+//
+// Forwards are mounted into the container along with Mount, to forward things
+// like the SSH agent from the host.
+//
+// HostUser is set when the container runs as a copy of the user on the host,
+// in which case it's created in the image and User is its name.
 type Metadata struct {
-	ID        string           `json:"id"`
-	ImageID   string           `json:"image_id"`
-	BaseName  string           `json:"base_name"`
-	BaseImage string           `json:"base_image"`
-	Shell     string           `json:"shell"`
-	Mount     Mount            `json:"mount"`
-	Envs      []string         `json:"envs"`
-	NoCache   bool             `json:"no_cache"`
-	User      string           `json:"user"`
-	Ports     map[string][]int `json:"ports"`
+	ID        string        `json:"id"`
+	ImageID   string        `json:"image_id"`
+	BaseName  string        `json:"base_name"`
+	BaseImage string        `json:"base_image"`
+	Shell     string        `json:"shell"`
+	Mount     Mount         `json:"mount"`
+	Forwards  []Mount       `json:"forwards,omitempty"`
+	Envs      []string      `json:"-"`
+	Variables []Variable    `json:"variables,omitempty"`
+	NoCache   bool          `json:"no_cache"`
+	User      string        `json:"user"`
+	HostUser  *HostUser     `json:"host_user,omitempty"`
+	Ports     []PortMapping `json:"ports"`
+	Resources Resources     `json:"resources"`
+}
+
+// HostUser is a user on the host, to be created in the container with the same
+// IDs, so that files written to the mount belong to them on the host too.
+type HostUser struct {
+	Name string `json:"name"`
+	UID  int    `json:"uid"`
+	GID  int    `json:"gid"`
+	Home string `json:"home"`
+}
+
+// Variable is the name of one of a container's variables along with where its
+// value came from, e.g. the config file, an env file or a secret reference.
+type Variable struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	Secret bool   `json:"secret,omitempty"`
+}
+
+// PortMapping maps a port in the container to a port on the host. Auto is set
+// when the host port was picked by envctl, rather than by the config.
+type PortMapping struct {
+	Protocol      string `json:"protocol"`
+	HostIP        string `json:"host_ip"`
+	HostPort      int    `json:"host_port"`
+	ContainerPort int    `json:"container_port"`
+	Auto          bool   `json:"auto,omitempty"`
+}
+
+func (p PortMapping) String() string {
+	return fmt.Sprintf("%v -> %v/%v",
+		net.JoinHostPort(p.HostIP, strconv.Itoa(p.HostPort)),
+		p.ContainerPort, p.Protocol)
+}
+
+// Resources limit what the container can use of the host. Zero values aren't
+// limited. CPUs are in billionths of a CPU, sizes are in bytes.
+type Resources struct {
+	NanoCPUs   int64    `json:"nano_cpus,omitempty"`
+	Memory     int64    `json:"memory,omitempty"`
+	MemorySwap int64    `json:"memory_swap,omitempty"`
+	PidsLimit  int64    `json:"pids_limit,omitempty"`
+	ShmSize    int64    `json:"shm_size,omitempty"`
+	Ulimits    []Ulimit `json:"ulimits,omitempty"`
+}
+
+// Ulimit is a ulimit processes in the container start with.
+type Ulimit struct {
+	Name string `json:"name"`
+	Soft int64  `json:"soft"`
+	Hard int64  `json:"hard"`
 }
 
 // Mount is directory on the host paired with a volume mount point.
 type Mount struct {
 	Source      string `json:"source"`
 	Destination string `json:"destination"`
+	ReadOnly    bool   `json:"read_only,omitempty"`
+}
+
+// Session is a login session in a container, which keeps running when it's
+// detached from, so that it can be attached to again.
+type Session struct {
+	Name     string    `json:"name"`
+	Attached bool      `json:"attached"`
+	Created  time.Time `json:"created"`
 }
 
+// AttachOptions are the options for attaching to a container.
+type AttachOptions struct {
+	// Session is the name of the session to attach to. A new session is
+	// started when it's empty.
+	Session string
+	// DetachKeys is the key sequence that detaches from the session, written
+	// like "ctrl-p,ctrl-q".
+	DetachKeys string
+	// Record is where the session is recorded to, if anywhere.
+	Record Recorder
+}
+
+// Recorder records a session: its output is written to it, and it's told
+// whenever the session's terminal is resized.
+type Recorder interface {
+	io.Writer
+	Resize(width, height uint) error
+}
+
+// DetachedError is returned by Controller.Attach when the session was detached
+// from, rather than ended. Session is empty when it couldn't be kept running,
+// in which case it was ended rather than left where it can't be reached.
+type DetachedError struct {
+	Session string
+}
+
+func (e *DetachedError) Error() string {
+	if e.Session == "" {
+		return "detached from a session that can't be attached to again, so it was ended"
+	}
+
+	return fmt.Sprintf("detached from session %v", e.Session)
+}
+
+// ErrNoSessions is returned by Controller.Sessions when a container can't keep
+// sessions, since there's no tmux in it.
+var ErrNoSessions = errors.New("sessions need tmux, which isn't installed in the environment")
+
 // Controller can control containers. This includes allowing consumers to
 // attach to the container.
 type Controller interface {
+	// Create and Recreate return the metadata of whatever exists afterwards,
+	// even when they fail partway, so that it can be saved and removed.
 	Create(Metadata) (Metadata, error)
+	Recreate(Metadata) (Metadata, error)
+	// Remove removes whatever the metadata has an ID for.
 	Remove(Metadata) error
-	Attach(Metadata) error
+	Attach(Metadata, AttachOptions) error
+	// Sessions lists the sessions in a container, which are only kept while
+	// it's running.
+	Sessions(Metadata) ([]Session, error)
 	Run(Metadata, []string) error
+	// CopyTo extracts a tar archive into a directory in the container.
+	CopyTo(Metadata, string, io.Reader) error
+	// CopyFrom returns a tar archive of a file or directory in the container,
+	// which it's named by the base name of in the archive.
+	CopyFrom(Metadata, string) (io.ReadCloser, error)
+	// Stat describes a file in the container, or returns an error when
+	// there's nothing there.
+	Stat(Metadata, string) (PathStat, error)
+}
+
+// PathStat describes a file in a container.
+type PathStat struct {
+	Name string
+	Mode os.FileMode
 }
 
 func (m Mount) String() string {
+	if m.ReadOnly {
+		return fmt.Sprintf("%v:%v:ro", m.Source, m.Destination)
+	}
+
 	return fmt.Sprintf("%v:%v", m.Source, m.Destination)
 }
@@ -3,93 +3,138 @@ package docker
 import (
 	"context"
 	"fmt"
-	"io"
-	"os"
-	gosignal "os/signal"
 
 	"github.com/winiceo/genv/pkg/container"
 	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/pkg/signal"
 	"github.com/docker/docker/pkg/term"
 )
 
-// Attach attaches the terminal session of the currently running
-// program to the container interactively.
-func (c *Controller) Attach(m container.Metadata) error {
-	restoreStdout, restoreStdin, err := c.makeRawTerminal()
+// Attach attaches the terminal session of the currently running program to a
+// session in the container with the given metadata, interactively. A new
+// session of the shell is started unless the options name one to attach to
+// again. Every session gets a TTY of its own, so any number of them can run
+// side by side without seeing each other's input.
+//
+// Sessions run in tmux when the container has it, so that they can be
+// detached from and attached to again. Without it, the shell is started on
+// its own, and ended if it's detached from anyway, since nothing could attach
+// to it again.
+//
+// Without a TTY, the shell reads its commands from stdin, and its stdout and
+// stderr are kept apart. It's never run in tmux then, which needs a terminal,
+// and an error is returned if it fails, so that it can be scripted.
+func (c *Controller) Attach(m container.Metadata, opts container.AttachOptions) error {
+	ctx := context.Background()
+	tty := c.useTTY(true)
+
+	if opts.Session != "" && !tty {
+		return fmt.Errorf("attaching to a session needs a terminal")
+	}
+
+	err := c.client.ContainerStart(ctx, m.ID, types.ContainerStartOptions{})
 	if err != nil {
 		return err
 	}
 
-	acfg := types.ContainerAttachOptions{
-		Stream: true,
-		Stdin:  true,
-		Stdout: true,
-		Stderr: true,
+	name := opts.Session
+	cmd := []string{"tmux", "attach-session", "-d", "-t", "=" + name}
+
+	if !tty {
+		cmd = []string{m.Shell}
+	} else if name == "" {
+		sessions, err := c.Sessions(m)
+		switch {
+		case err == container.ErrNoSessions:
+			cmd = []string{m.Shell}
+		case err != nil:
+			return err
+		default:
+			// The session is started before attaching to it, so that a name
+			// another login took in the meantime can be told apart from the
+			// session failing.
+			name, err = c.newSession(m, sessions)
+			if err != nil {
+				return err
+			}
+			cmd = []string{"tmux", "attach-session", "-d", "-t", "=" + name}
+		}
+	}
+
+	pidFile := newPIDFile()
+	defer c.removePIDFile(m, pidFile)
+
+	cfg := types.ExecConfig{
+		User:         m.User,
+		AttachStdin:  true,
+		AttachStderr: true,
+		AttachStdout: true,
+		Cmd:          withPIDFile(pidFile, cmd),
+		Tty:          tty,
+	}
+
+	// There's no detaching without a terminal, and the keys could just as well
+	// be part of what's piped in. There's no attaching again without tmux, so
+	// the keys are only Docker's own then, which it can't be told not to use.
+	if tty && name != "" {
+		cfg.DetachKeys = opts.DetachKeys
 	}
 
-	resp, err := c.client.ContainerAttach(context.Background(), m.ID, acfg)
-	defer resp.Close()
+	exec, err := c.client.ContainerExecCreate(ctx, m.ID, cfg)
 	if err != nil {
 		return err
 	}
 
-	errchan := make(chan error)
-	donechan := make(chan struct{})
+	if tty {
+		restore, err := c.makeRawTerminal()
+		if err != nil {
+			return err
+		}
+		defer restore()
+	}
 
-	err = c.client.ContainerStart(
-		context.Background(),
-		m.ID,
-		types.ContainerStartOptions{},
-	)
+	// Attaching to an exec starts it.
+	resp, err := c.client.ContainerExecAttach(ctx, exec.ID, cfg)
 	if err != nil {
 		return err
 	}
 
-	c.mirrorContainerTTY(m.ID)
+	s := execSession{
+		ID:      exec.ID,
+		PIDFile: pidFile,
+		Stdin:   true,
+		TTY:     tty,
+		Record:  opts.Record,
+	}
 
-	go func() {
-		_, err := io.Copy(c.stdout.stream, resp.Reader)
-		if err != nil {
-			errchan <- err
-			restoreStdout()
-			return
-		}
+	if err := c.stream(ctx, m, s, resp); err != nil {
+		return err
+	}
 
-		restoreStdout()
-		donechan <- struct{}{}
-	}()
+	// The stream ends when the session does, or when it's detached from, in
+	// which case it's still running.
+	inspect, err := c.client.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return err
+	}
 
-	go func() {
-		_, err := io.Copy(resp.Conn, c.stdin.stream)
-		if err != nil {
-			errchan <- err
-			restoreStdin()
-			return
-		}
+	if !tty && inspect.ExitCode != 0 {
+		return fmt.Errorf("%v exited with code %v", m.Shell, inspect.ExitCode)
+	}
 
-		restoreStdin()
-		resp.CloseWrite()
-	}()
-
-	// Depending on the underlying image's entrypoint, there could be cases
-	// where there's no command prompt. This could trick the user into thinking
-	// that the process is hung, when in fact there just hasn't been anything
-	// to write to stdout.
-	fmt.Fprintf(
-		c.stdout.stream,
-		"If you don't see a command prompt, try pressing enter.\r\n",
-	)
-
-	select {
-	case err = <-errchan:
-		if err != nil {
-			return err
-		}
-	case <-donechan:
+	if !inspect.Running {
+		return nil
 	}
 
-	return nil
+	// The tmux client is left running in the detached exec, which would
+	// otherwise still count as attached to the session. A shell on its own is
+	// hung up on, like when its terminal is closed.
+	if name != "" {
+		c.output(m, []string{"tmux", "detach-client", "-s", "=" + name})
+	} else {
+		c.output(m, []string{"sh", "-c", `kill -s HUP "$(cat "$0")"`, pidFile})
+	}
+
+	return &container.DetachedError{Session: name}
 }
 
 // makeRawTerminal sets the terminal currently pointed to by stdin and stdout
@@ -97,33 +142,43 @@ func (c *Controller) Attach(m container.Metadata) error {
 // container over the attach socket. If anything goes wrong, it returns an error
 // and tries to restore the terminal to its previous state, but it might not
 // succeed in doing so depending on what the issue was. If it was successful,
-// it returns two callback functions for the caller to restore the terminal
-// back to its previous state when ready. The first is for stdout, the second
-// is for stderr.
-func (c *Controller) makeRawTerminal() (func() error, func() error, error) {
+// it returns a callback function for the caller to restore the terminal back
+// to its previous state when ready, which is best deferred so that it runs
+// however the session ends.
+func (c *Controller) makeRawTerminal() (func(), error) {
 	// This stuff is required to make interactive sessions in the container
 	// less buggy. For example, without it, any command typed at the prompt will
 	// get repeated out before printing the execution results.
-	oldStdout, err := term.MakeRaw(c.stdout.fd)
-	if err != nil {
-		return nil, nil, err
-	}
+	//
+	// Only what's a terminal can be made raw, which isn't everything when a
+	// TTY is asked for anyway.
+	restoreStdout := func() {}
+	if c.stdout.isTerm {
+		oldStdout, err := term.MakeRaw(c.stdout.fd)
+		if err != nil {
+			return nil, err
+		}
 
-	restoreStdout := func() error {
-		return term.RestoreTerminal(c.stdout.fd, oldStdout)
+		restoreStdout = func() { term.RestoreTerminal(c.stdout.fd, oldStdout) }
 	}
 
-	oldStdin, err := term.MakeRaw(c.stdin.fd)
-	if err != nil {
-		term.RestoreTerminal(c.stdout.fd, oldStdout)
-		return nil, nil, err
+	restoreStdin := func() {}
+	if c.stdin.isTerm {
+		oldStdin, err := term.MakeRaw(c.stdin.fd)
+		if err != nil {
+			restoreStdout()
+			return nil, err
+		}
+
+		restoreStdin = func() { term.RestoreTerminal(c.stdin.fd, oldStdin) }
 	}
 
-	restoreStdin := func() error {
-		return term.RestoreTerminal(c.stdin.fd, oldStdin)
+	restore := func() {
+		restoreStdin()
+		restoreStdout()
 	}
 
-	return restoreStdout, restoreStdin, nil
+	return restore, nil
 }
 
 func (ts *termStream) getTTYSize() (uint, uint) {
@@ -135,34 +190,3 @@ func (ts *termStream) getTTYSize() (uint, uint) {
 	}
 	return uint(ws.Width), uint(ws.Height)
 }
-
-// mirrorContainerTTY handles keeping the tty dimensions in sync from the host
-// to the container.
-func (c *Controller) mirrorContainerTTY(cntid string) error {
-	handleTerminalResize := func() {
-		width, height := c.stdout.getTTYSize()
-		if width == 0 && height == 0 {
-			return
-		}
-
-		options := types.ResizeOptions{
-			Width:  width,
-			Height: height,
-		}
-
-		c.client.ContainerResize(context.Background(), cntid, options)
-	}
-
-	// Run this the first time to establish the link between the container's TTY
-	// and the terminal emulator's TTY.
-	handleTerminalResize()
-
-	sigchan := make(chan os.Signal, 1)
-	gosignal.Notify(sigchan, signal.SIGWINCH)
-	go func() {
-		for range sigchan {
-			handleTerminalResize()
-		}
-	}()
-	return nil
-}
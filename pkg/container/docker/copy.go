@@ -0,0 +1,39 @@
+package docker
+
+import (
+	"context"
+	"io"
+
+	"github.com/winiceo/genv/pkg/container"
+	"github.com/docker/docker/api/types"
+)
+
+// CopyTo extracts the tar archive `content` into the directory `dir` in the
+// container with the given metadata, which has to exist already.
+func (c *Controller) CopyTo(m container.Metadata, dir string, content io.Reader) error {
+	return c.client.CopyToContainer(
+		context.Background(),
+		m.ID,
+		dir,
+		content,
+		types.CopyToContainerOptions{},
+	)
+}
+
+// CopyFrom returns a tar archive of the file or directory at `p` in the
+// container with the given metadata, where it's named by the base name of `p`.
+// It's up to the caller to close it.
+func (c *Controller) CopyFrom(m container.Metadata, p string) (io.ReadCloser, error) {
+	content, _, err := c.client.CopyFromContainer(context.Background(), m.ID, p)
+	return content, err
+}
+
+// Stat describes the file at `p` in the container with the given metadata.
+func (c *Controller) Stat(m container.Metadata, p string) (container.PathStat, error) {
+	stat, err := c.client.ContainerStatPath(context.Background(), m.ID, p)
+	if err != nil {
+		return container.PathStat{}, err
+	}
+
+	return container.PathStat{Name: stat.Name, Mode: stat.Mode}, nil
+}
@@ -7,8 +7,10 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"strconv"
 
 	"github.com/docker/go-connections/nat"
+	units "github.com/docker/go-units"
 
 	"github.com/winiceo/genv/pkg/container"
 	"github.com/alecthomas/template"
@@ -18,14 +20,24 @@ import (
 	"github.com/google/uuid"
 )
 
+// Create builds the image for the given metadata and creates a container from
+// it. When creating the container fails, the metadata returned still has the
+// image that was built, so that it can be removed.
 func (c *Controller) Create(m container.Metadata) (container.Metadata, error) {
 	img, err := c.buildImage(m)
 	if err != nil {
-		return container.Metadata{}, err
+		return m, err
 	}
 
 	m.ImageID = img
 
+	return c.createContainer(m)
+}
+
+// createContainer creates a container from the image referenced by the given
+// metadata, which has to be built already. The metadata is returned without a
+// container ID when it fails.
+func (c *Controller) createContainer(m container.Metadata) (container.Metadata, error) {
 	cpmap := getContainerPortMappings(m.Ports)
 	hpmap := getHostPortMappings(m.Ports)
 
@@ -41,9 +53,14 @@ func (c *Controller) Create(m container.Metadata) (container.Metadata, error) {
 	hcfg := &docker.HostConfig{
 		Binds:        make([]string, 1),
 		PortBindings: hpmap,
+		Resources:    getResources(m.Resources),
+		ShmSize:      m.Resources.ShmSize,
 	}
 
 	hcfg.Binds[0] = m.Mount.String()
+	for _, f := range m.Forwards {
+		hcfg.Binds = append(hcfg.Binds, f.String())
+	}
 
 	ncfg := &network.NetworkingConfig{}
 
@@ -55,17 +72,29 @@ func (c *Controller) Create(m container.Metadata) (container.Metadata, error) {
 		m.BaseName,
 	)
 	if err != nil {
-		return container.Metadata{}, err
+		return m, err
 	}
 
 	m.ID = cnt.ID
 	return m, nil
 }
 
-var dockerfileTpl = `FROM {{ .BaseImage }}
+// dockerfileTpl builds the image for an environment. Host users are written
+// straight into /etc/passwd and /etc/group, since not every image has useradd.
+// Their group is only added when there isn't one with the same ID already, and
+// any user that has their name already is replaced.
+//
+// The entrypoint does nothing but keep the container running, until it's
+// stopped. Shells are started next to it for every login, so leaving one
+// doesn't stop the container, or any of the others.
+var dockerfileTpl = `FROM {{ .BaseImage }}{{ with .HostUser }}
+	RUN grep -q '^[^:]*:[^:]*:{{ .GID }}:' /etc/group || echo '{{ .Name }}:x:{{ .GID }}:' >> /etc/group && \
+		sed -i '/^{{ .Name }}:/d' /etc/passwd && \
+		echo '{{ .Name }}:x:{{ .UID }}:{{ .GID }}::{{ .Home }}:{{ $.Shell }}' >> /etc/passwd && \
+		mkdir -p '{{ .Home }}' && chown {{ .UID }}:{{ .GID }} '{{ .Home }}'{{ end }}
 	VOLUME ["{{ .Mount.Destination }}"]
 	WORKDIR "{{ .Mount.Destination }}"
-	ENTRYPOINT ["{{ .Shell }}"]`
+	ENTRYPOINT ["/bin/sh", "-c", "trap 'exit 0' TERM; while :; do sleep 3600 & wait $!; done"]`
 
 // buildImage will build an image based on the passed in ImageConfig. It returns
 // the name of the built image, as <cfg.BaseName:UUID>, or an error.
@@ -144,33 +173,50 @@ func getBuildContext(raw *bytes.Buffer) (*bytes.Buffer, error) {
 	return padded, nil
 }
 
-func getContainerPortMappings(l3map map[string][]int) map[nat.Port]struct{} {
+func getContainerPortMappings(ports []container.PortMapping) map[nat.Port]struct{} {
 	mappings := map[nat.Port]struct{}{}
 
-	for layer, plist := range l3map {
-		for _, p := range plist {
-			pstr := nat.Port(fmt.Sprintf("%v/%v", p, layer))
-			mappings[pstr] = struct{}{}
-		}
+	for _, p := range ports {
+		pstr := nat.Port(fmt.Sprintf("%v/%v", p.ContainerPort, p.Protocol))
+		mappings[pstr] = struct{}{}
 	}
 
 	return mappings
 }
 
-func getHostPortMappings(l3map map[string][]int) nat.PortMap {
+func getHostPortMappings(ports []container.PortMapping) nat.PortMap {
 	mappings := nat.PortMap{}
 
-	for layer, plist := range l3map {
-		for _, p := range plist {
-			pstr := nat.Port(fmt.Sprintf("%v/%v", p, layer))
-
-			bind := nat.PortBinding{
-				HostPort: string(pstr),
-			}
+	for _, p := range ports {
+		pstr := nat.Port(fmt.Sprintf("%v/%v", p.ContainerPort, p.Protocol))
 
-			mappings[pstr] = []nat.PortBinding{bind}
+		bind := nat.PortBinding{
+			HostIP:   p.HostIP,
+			HostPort: strconv.Itoa(p.HostPort),
 		}
+
+		// A container port can be bound to more than one host port.
+		mappings[pstr] = append(mappings[pstr], bind)
 	}
 
 	return mappings
 }
+
+func getResources(r container.Resources) docker.Resources {
+	resources := docker.Resources{
+		NanoCPUs:   r.NanoCPUs,
+		Memory:     r.Memory,
+		MemorySwap: r.MemorySwap,
+		PidsLimit:  r.PidsLimit,
+	}
+
+	for _, u := range r.Ulimits {
+		resources.Ulimits = append(resources.Ulimits, &units.Ulimit{
+			Name: u.Name,
+			Soft: u.Soft,
+			Hard: u.Hard,
+		})
+	}
+
+	return resources
+}
@@ -3,8 +3,11 @@ package docker
 import (
 	"archive/tar"
 	"io"
+	"reflect"
 	"testing"
 
+	"github.com/docker/go-connections/nat"
+
 	"github.com/winiceo/genv/pkg/container"
 	"github.com/winiceo/genv/test_pkg"
 )
@@ -29,7 +32,46 @@ func TestBuildDockerfile(got *testing.T) {
 	expected := `FROM scratch
 	VOLUME ["/test-path"]
 	WORKDIR "/test-path"
-	ENTRYPOINT ["/testsh"]`
+	ENTRYPOINT ["/bin/sh", "-c", "trap 'exit 0' TERM; while :; do sleep 3600 & wait $!; done"]`
+
+	actual := buf.String()
+	if expected != actual {
+		t.Fatal("Dockerfile build", expected, actual)
+	}
+}
+
+func TestBuildDockerfileHostUser(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	testm := container.Metadata{
+		BaseImage: "scratch",
+		Mount: container.Mount{
+			Source:      "",
+			Destination: "/test-path",
+		},
+		Shell: "/testsh",
+		User:  "alice",
+		HostUser: &container.HostUser{
+			Name: "alice",
+			UID:  1000,
+			GID:  1001,
+			Home: "/home/alice",
+		},
+	}
+
+	buf, err := buildDockerfile(testm)
+	if err != nil {
+		t.Fatal("errors", nil, err)
+	}
+
+	expected := `FROM scratch
+	RUN grep -q '^[^:]*:[^:]*:1001:' /etc/group || echo 'alice:x:1001:' >> /etc/group && \
+		sed -i '/^alice:/d' /etc/passwd && \
+		echo 'alice:x:1000:1001::/home/alice:/testsh' >> /etc/passwd && \
+		mkdir -p '/home/alice' && chown 1000:1001 '/home/alice'
+	VOLUME ["/test-path"]
+	WORKDIR "/test-path"
+	ENTRYPOINT ["/bin/sh", "-c", "trap 'exit 0' TERM; while :; do sleep 3600 & wait $!; done"]`
 
 	actual := buf.String()
 	if expected != actual {
@@ -78,3 +120,38 @@ func TestGetBuildContext(got *testing.T) {
 		h, err = tarrd.Next()
 	}
 }
+
+func TestGetPortMappings(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	ports := []container.PortMapping{
+		{Protocol: "tcp", HostIP: "127.0.0.1", HostPort: 8080, ContainerPort: 80},
+		{Protocol: "tcp", HostIP: "0.0.0.0", HostPort: 8081, ContainerPort: 80},
+		{Protocol: "udp", HostIP: "127.0.0.1", HostPort: 5353, ContainerPort: 53},
+	}
+
+	expectedExposed := map[nat.Port]struct{}{
+		"80/tcp": struct{}{},
+		"53/udp": struct{}{},
+	}
+
+	actualExposed := getContainerPortMappings(ports)
+	if !reflect.DeepEqual(expectedExposed, actualExposed) {
+		t.Fatal("exposed ports", expectedExposed, actualExposed)
+	}
+
+	expectedBound := nat.PortMap{
+		"80/tcp": []nat.PortBinding{
+			{HostIP: "127.0.0.1", HostPort: "8080"},
+			{HostIP: "0.0.0.0", HostPort: "8081"},
+		},
+		"53/udp": []nat.PortBinding{
+			{HostIP: "127.0.0.1", HostPort: "5353"},
+		},
+	}
+
+	actualBound := getHostPortMappings(ports)
+	if !reflect.DeepEqual(expectedBound, actualBound) {
+		t.Fatal("bound ports", expectedBound, actualBound)
+	}
+}
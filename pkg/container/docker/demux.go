@@ -0,0 +1,58 @@
+package docker
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// The streams in Docker's multiplexed output, which is what an exec without a
+// TTY writes. Each frame starts with a header of stream, three bytes of
+// padding, and the size of the frame as a big endian uint32.
+const (
+	streamStdin  = 0
+	streamStdout = 1
+	streamStderr = 2
+	streamSystem = 3
+
+	frameHeaderLen = 8
+)
+
+// demux copies the multiplexed output in `r` to `stdout` and `stderr`, until
+// `r` ends. Errors Docker writes into the output itself are returned.
+func demux(stdout, stderr io.Writer, r io.Reader) error {
+	header := make([]byte, frameHeaderLen)
+
+	for {
+		if _, err := io.ReadFull(r, header); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+
+		var w io.Writer
+		switch header[0] {
+		case streamStdin, streamStdout:
+			w = stdout
+		case streamStderr:
+			w = stderr
+		case streamSystem:
+			msg := make([]byte, size)
+			if _, err := io.ReadFull(r, msg); err != nil {
+				return err
+			}
+
+			return fmt.Errorf("error from Docker: %s", msg)
+		default:
+			return fmt.Errorf("unknown stream %v in exec output", header[0])
+		}
+
+		if _, err := io.CopyN(w, r, size); err == io.EOF {
+			return io.ErrUnexpectedEOF
+		} else if err != nil {
+			return err
+		}
+	}
+}
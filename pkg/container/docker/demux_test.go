@@ -0,0 +1,57 @@
+package docker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/winiceo/genv/test_pkg"
+)
+
+// frame returns `content` as a frame of multiplexed output on `stream`.
+func frame(stream byte, content string) []byte {
+	header := make([]byte, frameHeaderLen)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(content)))
+
+	return append(header, content...)
+}
+
+func TestDemux(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	in := &bytes.Buffer{}
+	in.Write(frame(streamStdout, "hello "))
+	in.Write(frame(streamStderr, "oops\n"))
+	in.Write(frame(streamStdout, "world\n"))
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	if err := demux(stdout, stderr, in); err != nil {
+		t.Fatal("demuxing", nil, err)
+	}
+
+	if stdout.String() != "hello world\n" {
+		t.Fatal("stdout", "hello world\n", stdout.String())
+	}
+
+	if stderr.String() != "oops\n" {
+		t.Fatal("stderr", "oops\n", stderr.String())
+	}
+}
+
+func TestDemuxErrors(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	cases := map[string][]byte{
+		"error from Docker: no such exec": frame(streamSystem, "no such exec"),
+		"unknown stream 7 in exec output": frame(7, "?"),
+		"unexpected EOF":                  frame(streamStdout, "cut short")[:12],
+	}
+
+	for expected, in := range cases {
+		err := demux(&bytes.Buffer{}, &bytes.Buffer{}, bytes.NewReader(in))
+		if err == nil || err.Error() != expected {
+			t.Fatal("demuxing", expected, err)
+		}
+	}
+}
@@ -14,11 +14,16 @@ type Controller struct {
 	stdin  termStream
 	stdout termStream
 	stderr termStream
+
+	// tty overrides whether execs get a TTY, which otherwise depends on
+	// whether envctl runs in a terminal.
+	tty *bool
 }
 
 type termStream struct {
 	stream *os.File
 	fd     uintptr
+	isTerm bool
 }
 
 // NewController returns a `*Controller` with stdin, stdout and stderr initialized.
@@ -28,14 +33,32 @@ func NewController() (*Controller, error) {
 		return nil, err
 	}
 
-	stdinfd, _ := term.GetFdInfo(os.Stdin)
-	stdoutfd, _ := term.GetFdInfo(os.Stdout)
-	stderrfd, _ := term.GetFdInfo(os.Stderr)
+	stdinfd, stdinTerm := term.GetFdInfo(os.Stdin)
+	stdoutfd, stdoutTerm := term.GetFdInfo(os.Stdout)
+	stderrfd, stderrTerm := term.GetFdInfo(os.Stderr)
 
 	return &Controller{
 		client: cli,
-		stdin:  termStream{stream: os.Stdin, fd: stdinfd},
-		stdout: termStream{stream: os.Stdout, fd: stdoutfd},
-		stderr: termStream{stream: os.Stderr, fd: stderrfd},
+		stdin:  termStream{stream: os.Stdin, fd: stdinfd, isTerm: stdinTerm},
+		stdout: termStream{stream: os.Stdout, fd: stdoutfd, isTerm: stdoutTerm},
+		stderr: termStream{stream: os.Stderr, fd: stderrfd, isTerm: stderrTerm},
 	}, nil
 }
+
+// SetTTY sets whether execs get a TTY, whether envctl runs in a terminal or
+// not.
+func (c *Controller) SetTTY(tty bool) {
+	c.tty = &tty
+}
+
+// useTTY returns whether an exec gets a TTY. Unless it's been set otherwise,
+// they get one when stdout is a terminal, along with stdin if it's used.
+// Otherwise there's nothing to size the TTY by, and the output would end up
+// with the carriage returns and escape codes only a terminal understands.
+func (c *Controller) useTTY(stdin bool) bool {
+	if c.tty != nil {
+		return *c.tty
+	}
+
+	return c.stdout.isTerm && (c.stdin.isTerm || !stdin)
+}
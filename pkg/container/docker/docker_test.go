@@ -0,0 +1,49 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/winiceo/genv/test_pkg"
+)
+
+func TestUseTTY(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	cases := []struct {
+		stdin, stdout bool
+		usesStdin     bool
+		expected      bool
+	}{
+		{stdin: true, stdout: true, usesStdin: true, expected: true},
+		{stdin: false, stdout: true, usesStdin: true, expected: false},
+		{stdin: false, stdout: true, usesStdin: false, expected: true},
+		{stdin: true, stdout: false, usesStdin: true, expected: false},
+		{stdin: true, stdout: false, usesStdin: false, expected: false},
+	}
+
+	for _, tc := range cases {
+		c := &Controller{
+			stdin:  termStream{isTerm: tc.stdin},
+			stdout: termStream{isTerm: tc.stdout},
+		}
+
+		if actual := c.useTTY(tc.usesStdin); tc.expected != actual {
+			t.Fatal("TTY", tc, actual)
+		}
+	}
+
+	c := &Controller{}
+	c.SetTTY(true)
+	if !c.useTTY(true) {
+		t.Fatal("forced TTY", true, false)
+	}
+
+	c = &Controller{
+		stdin:  termStream{isTerm: true},
+		stdout: termStream{isTerm: true},
+	}
+	c.SetTTY(false)
+	if c.useTTY(false) {
+		t.Fatal("no TTY", false, true)
+	}
+}
@@ -0,0 +1,34 @@
+package docker
+
+import (
+	"context"
+
+	"github.com/winiceo/genv/pkg/container"
+	"github.com/docker/docker/api/types"
+)
+
+// Recreate replaces the container with the given metadata with a new one
+// created from the same image. The image is kept, so this is a lot quicker
+// than removing the environment and creating it again. A container that's
+// already gone, after a recreate that failed, is just created.
+//
+// When the new container can't be created, the metadata returned has the
+// image but no container, since the old one is gone.
+func (c *Controller) Recreate(m container.Metadata) (container.Metadata, error) {
+	if m.ID != "" {
+		err := c.client.ContainerRemove(
+			context.Background(),
+			m.ID,
+			types.ContainerRemoveOptions{
+				RemoveVolumes: true,
+				Force:         true,
+			},
+		)
+		if err != nil {
+			return m, err
+		}
+	}
+
+	m.ID = ""
+	return c.createContainer(m)
+}
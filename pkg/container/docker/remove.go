@@ -9,25 +9,35 @@ import (
 	"github.com/docker/docker/api/types/filters"
 )
 
-// Remove removes the container with the given metadata.
+// Remove removes the container with the given metadata, along with its image.
+// Either can be missing from the metadata, when creating the environment
+// failed partway, in which case only what's there is removed.
 func (c *Controller) Remove(m container.Metadata) error {
-	cnt, err := c.client.ContainerInspect(context.Background(), m.ID)
-	if err != nil {
-		return err
+	if m.ID != "" {
+		cnt, err := c.client.ContainerInspect(context.Background(), m.ID)
+		if err != nil {
+			return err
+		}
+
+		if cnt.ContainerJSONBase.State.Running {
+			timeout := 10 * time.Second
+			err := c.client.ContainerStop(context.Background(), m.ID,
+				&timeout)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
-	if cnt.ContainerJSONBase.State.Running {
-		timeout := 10 * time.Second
-		err := c.client.ContainerStop(context.Background(), m.ID,
-			&timeout)
-		if err != nil {
+	// An empty reference would match every image there is.
+	if m.ImageID != "" {
+		if err := c.removeImage(m.ImageID); err != nil {
 			return err
 		}
 	}
 
-	err = c.removeImage(m.ImageID)
-	if err != nil {
-		return err
+	if m.ID == "" {
+		return nil
 	}
 
 	return c.client.ContainerRemove(
@@ -0,0 +1,164 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/winiceo/genv/pkg/container"
+	"github.com/docker/docker/api/types"
+)
+
+// listSessions lists the tmux sessions in a container, one per line, or exits
+// with 127 when there's no tmux. tmux fails when it has no sessions, since its
+// server isn't running then.
+const listSessions = `command -v tmux >/dev/null 2>&1 || exit 127
+tmux list-sessions -F '#{session_attached} #{session_created} #{session_name}' 2>/dev/null || true`
+
+// Sessions lists the sessions in the container with the given metadata. A
+// container that isn't running has none.
+func (c *Controller) Sessions(m container.Metadata) ([]container.Session, error) {
+	info, err := c.client.ContainerInspect(context.Background(), m.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.State == nil || !info.State.Running {
+		return nil, nil
+	}
+
+	out, code, err := c.output(m, []string{"sh", "-c", listSessions})
+	if err != nil {
+		return nil, err
+	}
+
+	switch code {
+	case 0:
+	case 127:
+		return nil, container.ErrNoSessions
+	default:
+		return nil, fmt.Errorf("listing sessions: %v", strings.TrimSpace(out))
+	}
+
+	return parseSessions(out), nil
+}
+
+// parseSessions parses the output of listSessions.
+func parseSessions(out string) []container.Session {
+	sessions := []container.Session{}
+
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), " ", 3)
+		if len(fields) != 3 {
+			continue
+		}
+
+		attached, _ := strconv.Atoi(fields[0])
+		created, _ := strconv.ParseInt(fields[1], 10, 64)
+
+		sessions = append(sessions, container.Session{
+			Name:     fields[2],
+			Attached: attached > 0,
+			Created:  time.Unix(created, 0),
+		})
+	}
+
+	return sessions
+}
+
+// freeSessionName returns the lowest number that isn't the name of one of the
+// sessions, to name a new one by.
+func freeSessionName(sessions []container.Session) string {
+	taken := map[string]bool{}
+	for _, s := range sessions {
+		taken[s.Name] = true
+	}
+
+	n := 1
+	for taken[strconv.Itoa(n)] {
+		n++
+	}
+
+	return strconv.Itoa(n)
+}
+
+// sessionTries is how many names a new session is tried under before giving
+// up, in case others keep taking them first.
+const sessionTries = 10
+
+// newSession starts a detached tmux session of the shell in the container with
+// the given metadata, and returns its name. The name is picked from the
+// sessions listed beforehand, so another login starting at the same time can
+// take it first. tmux refuses a duplicate, so the next free name is tried then.
+func (c *Controller) newSession(m container.Metadata, sessions []container.Session) (string, error) {
+	return startSession(sessions, func(name string) (string, int, error) {
+		return c.output(m, []string{
+			"tmux", "new-session", "-d", "-s", name, m.Shell,
+			";", "set-option", "status", "off",
+		})
+	})
+}
+
+// startSession starts a session with `start` under the lowest free name, trying
+// the next one for as long as tmux reports the name as taken.
+func startSession(sessions []container.Session, start func(name string) (string, int, error)) (string, error) {
+	for i := 0; i < sessionTries; i++ {
+		name := freeSessionName(sessions)
+
+		out, code, err := start(name)
+		if err != nil {
+			return "", err
+		}
+
+		if code == 0 {
+			return name, nil
+		}
+
+		if !strings.Contains(out, "duplicate session") {
+			return "", fmt.Errorf("starting a session: %v", strings.TrimSpace(out))
+		}
+
+		sessions = append(sessions, container.Session{Name: name})
+	}
+
+	return "", fmt.Errorf("starting a session: every name tried was taken")
+}
+
+// output runs `cmd` in the container with the given metadata, and returns what
+// it wrote along with its exit code. It's run with a TTY, so that stdout and
+// stderr come back as they are rather than multiplexed.
+func (c *Controller) output(m container.Metadata, cmd []string) (string, int, error) {
+	cfg := types.ExecConfig{
+		User:         m.User,
+		AttachStderr: true,
+		AttachStdout: true,
+		Cmd:          cmd,
+		Tty:          true,
+	}
+
+	exec, err := c.client.ContainerExecCreate(context.Background(), m.ID, cfg)
+	if err != nil {
+		return "", 0, err
+	}
+
+	resp, err := c.client.ContainerExecAttach(context.Background(), exec.ID, cfg)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Close()
+
+	out, err := ioutil.ReadAll(resp.Reader)
+	if err != nil {
+		return "", 0, err
+	}
+
+	inspect, err := c.client.ContainerExecInspect(context.Background(), exec.ID)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return strings.Replace(string(out), "\r\n", "\n", -1), inspect.ExitCode, nil
+}
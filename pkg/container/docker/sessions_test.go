@@ -0,0 +1,100 @@
+package docker
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/winiceo/genv/pkg/container"
+	"github.com/winiceo/genv/test_pkg"
+)
+
+func TestParseSessions(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	out := "1 1577934245 1\n0 1577934300 my session\n"
+
+	expected := []container.Session{
+		{Name: "1", Attached: true, Created: time.Unix(1577934245, 0)},
+		{Name: "my session", Created: time.Unix(1577934300, 0)},
+	}
+
+	actual := parseSessions(out)
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatal("sessions", expected, actual)
+	}
+
+	if actual := parseSessions(""); len(actual) != 0 {
+		t.Fatal("no sessions", []container.Session{}, actual)
+	}
+}
+
+func TestFreeSessionName(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	cases := []struct {
+		taken    []string
+		expected string
+	}{
+		{nil, "1"},
+		{[]string{"1", "2"}, "3"},
+		{[]string{"2", "work"}, "1"},
+		{[]string{"1", "3"}, "2"},
+	}
+
+	for _, c := range cases {
+		sessions := []container.Session{}
+		for _, name := range c.taken {
+			sessions = append(sessions, container.Session{Name: name})
+		}
+
+		if actual := freeSessionName(sessions); c.expected != actual {
+			t.Fatal("free session name", c.expected, actual)
+		}
+	}
+}
+
+func TestStartSession(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	// Names another login takes first are skipped for the next free one.
+	taken := map[string]bool{"2": true, "3": true}
+	tried := []string{}
+	start := func(name string) (string, int, error) {
+		tried = append(tried, name)
+		if taken[name] {
+			return "duplicate session: " + name + "\r\n", 1, nil
+		}
+		return "", 0, nil
+	}
+
+	sessions := []container.Session{{Name: "1"}}
+	name, err := startSession(sessions, start)
+	if err != nil {
+		t.Fatal("starting session", nil, err)
+	}
+
+	if name != "4" {
+		t.Fatal("session name", "4", name)
+	}
+
+	expected := []string{"2", "3", "4"}
+	if !reflect.DeepEqual(expected, tried) {
+		t.Fatal("names tried", expected, tried)
+	}
+
+	// Any other failure isn't retried.
+	tried = []string{}
+	start = func(name string) (string, int, error) {
+		tried = append(tried, name)
+		return "open terminal failed: not a terminal\r\n", 1, nil
+	}
+
+	if _, err := startSession(nil, start); err == nil {
+		t.Fatal("starting session", "error", err)
+	}
+
+	if len(tried) != 1 {
+		t.Fatal("names tried", 1, len(tried))
+	}
+}
@@ -0,0 +1,217 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	gosignal "os/signal"
+	"syscall"
+
+	"github.com/winiceo/genv/pkg/container"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/signal"
+	"github.com/google/uuid"
+)
+
+// forwardedSignals are the signals that are passed on to the process of an
+// exec, by the names kill knows them by.
+var forwardedSignals = map[os.Signal]string{
+	syscall.SIGINT:  "INT",
+	syscall.SIGTERM: "TERM",
+	syscall.SIGHUP:  "HUP",
+}
+
+// execSession is an exec that's attached to.
+type execSession struct {
+	ID string
+	// PIDFile is where the PID of the exec's process is in the container.
+	PIDFile string
+	// Stdin is whether stdin goes to the exec.
+	Stdin bool
+	// TTY is whether the exec has a TTY. Without one, its output is
+	// multiplexed.
+	TTY bool
+	// Record is where the session is recorded to, if anywhere.
+	Record container.Recorder
+}
+
+// stream copies the output of the exec session `s`, which `resp` is attached
+// to, to stdout and stderr, and stdin to the exec if it takes it. It returns
+// once the output ends or `ctx` is done, and stops everything it started on
+// the way out: the connection is closed, and the signals are let go of.
+//
+// While the exec runs, the signals in forwardedSignals are passed on to its
+// process, and the exec's TTY, if it has one, is kept the same size as the
+// terminal.
+func (c *Controller) stream(
+	ctx context.Context,
+	m container.Metadata,
+	s execSession,
+	resp types.HijackedResponse,
+) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Closing the connection is what stops the copies below, which can't be
+	// cancelled otherwise.
+	go func() {
+		<-ctx.Done()
+		resp.Close()
+	}()
+
+	if s.TTY {
+		c.mirrorExecTTY(ctx, s.ID, s.Record)
+	}
+
+	forwarded := c.forwardSignals(ctx, m, s.PIDFile)
+
+	var stdout, stderr io.Writer = c.stdout.stream, c.stderr.stream
+	if s.Record != nil {
+		stdout = io.MultiWriter(stdout, s.Record)
+		stderr = io.MultiWriter(stderr, s.Record)
+	}
+
+	outdone := make(chan error, 1)
+	go func() {
+		if !s.TTY {
+			outdone <- demux(stdout, stderr, resp.Reader)
+			return
+		}
+
+		_, err := io.Copy(stdout, resp.Reader)
+		outdone <- err
+	}()
+
+	// There's no way to interrupt a read from stdin, so this copy is left
+	// behind once the output ends. It stops with envctl, which is straight
+	// after that.
+	if s.Stdin {
+		go func() {
+			io.Copy(resp.Conn, c.stdin.stream)
+			resp.CloseWrite()
+		}()
+	}
+
+	select {
+	case err := <-outdone:
+		if err != nil {
+			return err
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	// Whatever stopped because of a signal didn't finish, which envctl
+	// wouldn't have either if it hadn't passed the signal on.
+	select {
+	case sig := <-forwarded:
+		return fmt.Errorf("stopped by a signal: %v", sig)
+	default:
+		return nil
+	}
+}
+
+// mirrorExecTTY handles keeping the tty dimensions in sync from the host to the
+// exec session with the given ID, until `ctx` is done. The sizes are recorded
+// to `rec` too, if it's set.
+func (c *Controller) mirrorExecTTY(ctx context.Context, execID string, rec container.Recorder) {
+	handleTerminalResize := func() {
+		width, height := c.stdout.getTTYSize()
+		if width == 0 && height == 0 {
+			return
+		}
+
+		if rec != nil {
+			rec.Resize(width, height)
+		}
+
+		options := types.ResizeOptions{
+			Width:  width,
+			Height: height,
+		}
+
+		c.client.ContainerExecResize(ctx, execID, options)
+	}
+
+	// Run this the first time to establish the link between the exec's TTY
+	// and the terminal emulator's TTY.
+	handleTerminalResize()
+
+	sigchan := make(chan os.Signal, 1)
+	gosignal.Notify(sigchan, signal.SIGWINCH)
+	go func() {
+		defer gosignal.Stop(sigchan)
+
+		for {
+			select {
+			case <-sigchan:
+				handleTerminalResize()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// forwardSignals passes the signals envctl gets on to the process whose PID is
+// in `pidFile`, until `ctx` is done. Docker can only signal the main process of
+// a container, so they're sent with kill from inside it. The returned channel
+// gets the first signal that was passed on.
+func (c *Controller) forwardSignals(
+	ctx context.Context,
+	m container.Metadata,
+	pidFile string,
+) <-chan os.Signal {
+	sigchan := make(chan os.Signal, 1)
+	for sig := range forwardedSignals {
+		gosignal.Notify(sigchan, sig)
+	}
+
+	forwarded := make(chan os.Signal, 1)
+
+	go func() {
+		defer gosignal.Stop(sigchan)
+
+		for {
+			select {
+			case sig := <-sigchan:
+				// It's noted before it's passed on, so that it's there
+				// by the time the process has stopped.
+				select {
+				case forwarded <- sig:
+				default:
+				}
+
+				c.output(m, []string{
+					"sh", "-c", `kill -s "$0" "$(cat "$1")"`,
+					forwardedSignals[sig], pidFile,
+				})
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return forwarded
+}
+
+// newPIDFile returns a path in the container to keep the PID of an exec in.
+func newPIDFile() string {
+	return "/tmp/envctl-" + uuid.New().String() + ".pid"
+}
+
+// withPIDFile wraps `cmd` so that its PID is written to `pidFile` before it
+// runs. It's still run even when the file can't be written, since that only
+// means signals can't be forwarded to it.
+func withPIDFile(pidFile string, cmd []string) []string {
+	return append(
+		[]string{"sh", "-c", `{ echo $$ > "$0"; } 2>/dev/null; exec "$@"`, pidFile},
+		cmd...,
+	)
+}
+
+// removePIDFile removes the PID file of an exec once it's done.
+func (c *Controller) removePIDFile(m container.Metadata, pidFile string) {
+	c.output(m, []string{"rm", "-f", pidFile})
+}
@@ -0,0 +1,48 @@
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/winiceo/genv/test_pkg"
+)
+
+func TestWithPIDFile(got *testing.T) {
+	t := test_pkg.NewT(got)
+
+	dir, err := ioutil.TempDir("", "envctl-pid")
+	if err != nil {
+		t.Fatal("creating temp dir", nil, err)
+	}
+	defer os.RemoveAll(dir)
+
+	pidFile := filepath.Join(dir, "exec.pid")
+	cmd := withPIDFile(pidFile, []string{"sh", "-c", `echo $$ "$0"`, "an argument"})
+
+	out, err := exec.Command(cmd[0], cmd[1:]...).Output()
+	if err != nil {
+		t.Fatal("running command", nil, err)
+	}
+
+	pid, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal("reading PID file", nil, err)
+	}
+
+	expected := strings.TrimSpace(string(pid)) + " an argument\n"
+	if expected != string(out) {
+		t.Fatal("output", expected, string(out))
+	}
+
+	// The command still runs when the PID can't be written.
+	cmd = withPIDFile(filepath.Join(dir, "missing", "exec.pid"), []string{"echo", "ran"})
+
+	out, err = exec.Command(cmd[0], cmd[1:]...).CombinedOutput()
+	if err != nil || string(out) != "ran\n" {
+		t.Fatal("output without PID file", "ran\n", string(out))
+	}
+}